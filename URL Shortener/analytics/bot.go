@@ -0,0 +1,251 @@
+package analytics
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+)
+
+// Các nhóm bot được gắn vào ClickEvent.BotCategory
+const (
+	BotCategoryPreview    = "preview"    // Bot tải trước link để hiện preview (Slack, Facebook, Twitter...)
+	BotCategoryCrawler    = "crawler"    // Search engine, SEO crawler, AI crawler
+	BotCategoryMonitor    = "monitor"    // Dịch vụ kiểm tra uptime
+	BotCategoryTool       = "tool"       // HTTP client, thư viện, trình duyệt headless
+	BotCategorySuspicious = "suspicious" // Thiếu header mà trình duyệt thật luôn gửi
+	BotCategoryPrefetch   = "prefetch"   // Trình duyệt tải trước link, người dùng chưa click
+	BotCategoryBurst      = "burst"      // Một IP click dồn dập vượt ngưỡng
+)
+
+// botSignature là một đoạn User-Agent (chữ thường) nhận diện bot
+type botSignature struct {
+	token    string
+	category string
+}
+
+// botSignatures được so khớp theo thứ tự, chữ ký cụ thể đứng trước chữ ký chung
+// Không liệt kê trình duyệt nhúng trong app (Zalo, LINE, Pinterest...): đó là người dùng thật
+var botSignatures = []botSignature{
+	// Link preview của ứng dụng chat và mạng xã hội
+	{"slackbot", BotCategoryPreview},
+	{"slack-imgproxy", BotCategoryPreview},
+	{"facebookexternalhit", BotCategoryPreview},
+	{"facebookcatalog", BotCategoryPreview},
+	{"meta-externalagent", BotCategoryPreview},
+	{"twitterbot", BotCategoryPreview},
+	{"linkedinbot", BotCategoryPreview},
+	{"whatsapp", BotCategoryPreview},
+	{"telegrambot", BotCategoryPreview},
+	{"discordbot", BotCategoryPreview},
+	{"skypeuripreview", BotCategoryPreview},
+	{"microsoftpreview", BotCategoryPreview},
+	{"teamsbot", BotCategoryPreview},
+	{"redditbot", BotCategoryPreview},
+	{"pinterestbot", BotCategoryPreview},
+	{"embedly", BotCategoryPreview},
+	{"iframely", BotCategoryPreview},
+	{"outbrain", BotCategoryPreview},
+	{"vkshare", BotCategoryPreview},
+	{"google-pagerenderer", BotCategoryPreview},
+
+	// Dịch vụ giám sát uptime
+	{"uptimerobot", BotCategoryMonitor},
+	{"pingdom", BotCategoryMonitor},
+	{"statuscake", BotCategoryMonitor},
+	{"site24x7", BotCategoryMonitor},
+	{"datadogsynthetics", BotCategoryMonitor},
+	{"newrelicpinger", BotCategoryMonitor},
+	{"stackdrivermonitoring", BotCategoryMonitor},
+	{"betteruptime", BotCategoryMonitor},
+	{"freshping", BotCategoryMonitor},
+	{"hetrixtools", BotCategoryMonitor},
+	{"checkly", BotCategoryMonitor},
+	{"kube-probe", BotCategoryMonitor},
+	{"elb-healthchecker", BotCategoryMonitor},
+
+	// HTTP client, thư viện và trình duyệt tự động
+	{"curl/", BotCategoryTool},
+	{"wget/", BotCategoryTool},
+	{"python-requests", BotCategoryTool},
+	{"python-urllib", BotCategoryTool},
+	{"aiohttp", BotCategoryTool},
+	{"httpx", BotCategoryTool},
+	{"go-http-client", BotCategoryTool},
+	{"okhttp", BotCategoryTool},
+	{"java/", BotCategoryTool},
+	{"apache-httpclient", BotCategoryTool},
+	{"libwww-perl", BotCategoryTool},
+	{"node-fetch", BotCategoryTool},
+	{"axios/", BotCategoryTool},
+	{"undici", BotCategoryTool},
+	{"postmanruntime", BotCategoryTool},
+	{"insomnia", BotCategoryTool},
+	{"headlesschrome", BotCategoryTool},
+	{"phantomjs", BotCategoryTool},
+	{"puppeteer", BotCategoryTool},
+	{"playwright", BotCategoryTool},
+	{"selenium", BotCategoryTool},
+	{"scrapy", BotCategoryTool},
+
+	// Chữ ký chung của crawler (Baiduspider, Yahoo! Slurp, ia_archiver...)
+	// Tên kết thúc bằng "bot" (Googlebot, bingbot, GPTBot) được nhận diện riêng bởi hasBotToken
+	{"crawl", BotCategoryCrawler},
+	{"spider", BotCategoryCrawler},
+	{"slurp", BotCategoryCrawler},
+	{"archiver", BotCategoryCrawler},
+	{"mediapartners-google", BotCategoryCrawler},
+	{"adsbot-google", BotCategoryCrawler},
+}
+
+// maxTrackedIPs giới hạn số IP được đếm burst để bộ nhớ không tăng vô hạn khi bị quét từ nhiều IP
+const maxTrackedIPs = 100000
+
+// ipWindow đếm số click của một IP trong cửa sổ hiện tại
+type ipWindow struct {
+	start time.Time
+	count int
+}
+
+// BotClassifierImpl phân loại click từ bot dựa trên User-Agent, header và tần suất theo IP
+// Bộ đếm burst nằm trong process nên mỗi replica đếm riêng phần traffic của mình
+type BotClassifierImpl struct {
+	burstLimit  int
+	burstWindow time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*ipWindow
+	lastSweep time.Time
+}
+
+// NewBotClassifier tạo classifier, burstLimit <= 0 thì không kiểm tra tần suất theo IP
+func NewBotClassifier(burstLimit int, burstWindow time.Duration) *BotClassifierImpl {
+	if burstWindow <= 0 {
+		burstWindow = 10 * time.Second
+	}
+	return &BotClassifierImpl{
+		burstLimit:  burstLimit,
+		burstWindow: burstWindow,
+		windows:     make(map[string]*ipWindow),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Classify trả về nhóm bot của click, chuỗi rỗng nếu là người dùng thật
+func (c *BotClassifierImpl) Classify(click *models.ClickRequest) string {
+	// Đếm mọi click của IP, kể cả click đã nhận ra là bot, để tần suất phản ánh đúng traffic của IP
+	burst := c.countBurst(click.IPAddress)
+
+	if category := classifyUserAgent(click.UserAgent); category != "" {
+		return category
+	}
+
+	purpose := strings.ToLower(click.Purpose)
+	if strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "prerender") {
+		return BotCategoryPrefetch
+	}
+
+	// Trình duyệt thật luôn gửi User-Agent, Accept và Accept-Language
+	if click.UserAgent == "" || click.Accept == "" || click.AcceptLanguage == "" {
+		return BotCategorySuspicious
+	}
+
+	if burst {
+		return BotCategoryBurst
+	}
+	return ""
+}
+
+// classifyUserAgent so khớp User-Agent với các chữ ký bot đã biết
+func classifyUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	ua := strings.ToLower(userAgent)
+	for _, signature := range botSignatures {
+		if strings.Contains(ua, signature.token) {
+			return signature.category
+		}
+	}
+	if hasBotToken(ua) {
+		return BotCategoryCrawler
+	}
+	return ""
+}
+
+// hasBotToken kiểm tra User-Agent (chữ thường) có tên sản phẩm kết thúc bằng "bot" như
+// "Googlebot/2.1", "PetalBot;", "Googlebot-Image" hay "my-bot".
+// Không so khớp mọi chuỗi con "bot" vì tên thiết bị thật cũng chứa nó (CUBOT_X30, CUBOT P50)
+func hasBotToken(ua string) bool {
+	const token = "bot"
+	offset := 0
+	for {
+		i := strings.Index(ua[offset:], token)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(token)
+		if end == len(ua) || strings.IndexByte("/;+@-", ua[end]) >= 0 || (start > 0 && ua[start-1] == '-') {
+			return true
+		}
+		offset = end
+	}
+}
+
+// countBurst tăng bộ đếm của IP, trả về true nếu IP vượt burstLimit trong cửa sổ hiện tại
+func (c *BotClassifierImpl) countBurst(ip string) bool {
+	if c.burstLimit <= 0 || ip == "" {
+		return false
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(now)
+
+	window, ok := c.windows[ip]
+	if !ok {
+		if len(c.windows) >= maxTrackedIPs {
+			return false
+		}
+		window = &ipWindow{start: now}
+		c.windows[ip] = window
+	}
+	if now.Sub(window.start) >= c.burstWindow {
+		window.start = now
+		window.count = 0
+	}
+
+	window.count++
+	return window.count > c.burstLimit
+}
+
+// sweep xóa các cửa sổ đã hết hạn, tối đa một lần mỗi burstWindow; caller phải giữ mu
+func (c *BotClassifierImpl) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.burstWindow {
+		return
+	}
+	c.lastSweep = now
+
+	for ip, window := range c.windows {
+		if now.Sub(window.start) >= c.burstWindow {
+			delete(c.windows, ip)
+		}
+	}
+}
+
+// GetStats trả về cấu hình và số IP đang được theo dõi
+func (c *BotClassifierImpl) GetStats() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return map[string]interface{}{
+		"burst_limit":  c.burstLimit,
+		"burst_window": c.burstWindow.String(),
+		"tracked_ips":  len(c.windows),
+	}
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+// browserClick tạo click có đủ header như trình duyệt thật
+func browserClick(ip, userAgent string) *models.ClickRequest {
+	return &models.ClickRequest{
+		IPAddress:      ip,
+		UserAgent:      userAgent,
+		Accept:         "text/html,application/xhtml+xml",
+		AcceptLanguage: "vi-VN,vi;q=0.9",
+	}
+}
+
+// TestBotClassifier_Classify tests user-agent signatures and header checks
+func TestBotClassifier_Classify(t *testing.T) {
+	classifier := NewBotClassifier(0, 0)
+
+	tests := []struct {
+		name  string
+		click *models.ClickRequest
+		want  string
+	}{
+		{"Browser", browserClick("1.1.1.1", chromeUA), ""},
+		{"Slack preview", browserClick("1.1.1.1", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"), BotCategoryPreview},
+		{"Facebook preview", browserClick("1.1.1.1", "facebookexternalhit/1.1"), BotCategoryPreview},
+		{"Googlebot", browserClick("1.1.1.1", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"), BotCategoryCrawler},
+		{"Petal crawler", browserClick("1.1.1.1", "Mozilla/5.0 (Linux; Android 7.0;) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; PetalBot;+https://webmaster.petalsearch.com/site/petalbot)"), BotCategoryCrawler},
+		{"Google image crawler", browserClick("1.1.1.1", "Googlebot-Image/1.0"), BotCategoryCrawler},
+		{"Cubot phone", browserClick("1.1.1.1", "Mozilla/5.0 (Linux; Android 10; CUBOT_X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36"), ""},
+		{"Cubot phone with space", browserClick("1.1.1.1", "Mozilla/5.0 (Linux; Android 13; CUBOT P60 Build/TP1A.220624.014) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.163 Mobile Safari/537.36"), ""},
+		{"Uptime monitor", browserClick("1.1.1.1", "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)"), BotCategoryMonitor},
+		{"curl", browserClick("1.1.1.1", "curl/8.5.0"), BotCategoryTool},
+		{"Headless Chrome", browserClick("1.1.1.1", "Mozilla/5.0 HeadlessChrome/126.0.0.0 Safari/537.36"), BotCategoryTool},
+		{"Missing Accept-Language", &models.ClickRequest{IPAddress: "1.1.1.1", UserAgent: chromeUA, Accept: "*/*"}, BotCategorySuspicious},
+		{"Missing User-Agent", &models.ClickRequest{IPAddress: "1.1.1.1"}, BotCategorySuspicious},
+		{"Prefetch", &models.ClickRequest{IPAddress: "1.1.1.1", UserAgent: chromeUA, Accept: "*/*", AcceptLanguage: "en", Purpose: "prefetch"}, BotCategoryPrefetch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifier.Classify(tt.click); got != tt.want {
+				t.Errorf("Classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBotClassifier_Burst tests an IP is flagged once it exceeds the burst limit and recovers after the window
+func TestBotClassifier_Burst(t *testing.T) {
+	classifier := NewBotClassifier(3, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if got := classifier.Classify(browserClick("2.2.2.2", chromeUA)); got != "" {
+			t.Fatalf("click %d classified as %q, want human", i, got)
+		}
+	}
+	if got := classifier.Classify(browserClick("2.2.2.2", chromeUA)); got != BotCategoryBurst {
+		t.Errorf("click over limit classified as %q, want %q", got, BotCategoryBurst)
+	}
+
+	// IP khác không bị ảnh hưởng
+	if got := classifier.Classify(browserClick("3.3.3.3", chromeUA)); got != "" {
+		t.Errorf("other IP classified as %q, want human", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := classifier.Classify(browserClick("2.2.2.2", chromeUA)); got != "" {
+		t.Errorf("click after window classified as %q, want human", got)
+	}
+}
@@ -0,0 +1,213 @@
+package analytics
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/models"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoRecord là các trường đọc từ database GeoIP2/GeoLite2 City (hoặc Country)
+type geoRecord struct {
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// GeoIPResolverImpl tra cứu vị trí của IP trong file MMDB (định dạng MaxMind) nằm trên đĩa
+//
+// File được kiểm tra lại tối đa mỗi checkInterval; khi mtime hoặc kích thước thay đổi
+// (ví dụ geoipupdate tải bản mới) database được nạp lại mà không cần restart.
+// Nạp lỗi thì tiếp tục dùng bản cũ
+type GeoIPResolverImpl struct {
+	path          string
+	checkInterval time.Duration
+
+	mu      sync.RWMutex // Giữ RLock trong lúc tra cứu để reader không bị đóng giữa chừng
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+
+	checkMu   sync.Mutex // Chỉ một goroutine kiểm tra/nạp lại file tại một thời điểm
+	lastCheck time.Time
+
+	lookups uint64
+	misses  uint64
+	reloads uint64
+	errors  uint64
+}
+
+// NewGeoIPResolver mở database GeoIP tại path
+// File chưa tồn tại hoặc lỗi thì chỉ log cảnh báo, database được nạp khi file xuất hiện
+func NewGeoIPResolver(path string, checkInterval time.Duration) *GeoIPResolverImpl {
+	if checkInterval <= 0 {
+		checkInterval = time.Minute
+	}
+
+	r := &GeoIPResolverImpl{
+		path:          path,
+		checkInterval: checkInterval,
+		lastCheck:     time.Now(),
+	}
+	if err := r.reload(); err != nil {
+		log.Printf("⚠️ GeoIP database unavailable, clicks will have no location until it loads: %v", err)
+	}
+	return r
+}
+
+// Lookup trả về quốc gia, vùng và thành phố của IP
+// Trả về false nếu IP không hợp lệ, không có trong database hoặc database chưa được nạp
+func (r *GeoIPResolverImpl) Lookup(ipAddress string) (*models.GeoLocation, bool) {
+	r.checkForUpdate()
+
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return nil, false
+	}
+
+	atomic.AddUint64(&r.lookups, 1)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.reader == nil {
+		atomic.AddUint64(&r.misses, 1)
+		return nil, false
+	}
+
+	var record geoRecord
+	_, found, err := r.reader.LookupNetwork(ip, &record)
+	if err != nil {
+		atomic.AddUint64(&r.errors, 1)
+		return nil, false
+	}
+	if !found {
+		atomic.AddUint64(&r.misses, 1)
+		return nil, false
+	}
+
+	location := &models.GeoLocation{
+		Country: localizedName(record.Country.Names, record.Country.IsoCode),
+		City:    localizedName(record.City.Names, ""),
+	}
+	if len(record.Subdivisions) > 0 {
+		location.Region = localizedName(record.Subdivisions[0].Names, record.Subdivisions[0].IsoCode)
+	}
+	return location, true
+}
+
+// Close đóng database
+func (r *GeoIPResolverImpl) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
+
+// GetStats trả về thông tin database đang dùng và số lần tra cứu
+func (r *GeoIPResolverImpl) GetStats() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := map[string]interface{}{
+		"path":           r.path,
+		"loaded":         r.reader != nil,
+		"check_interval": r.checkInterval.String(),
+		"lookups":        atomic.LoadUint64(&r.lookups),
+		"misses":         atomic.LoadUint64(&r.misses),
+		"errors":         atomic.LoadUint64(&r.errors),
+		"reloads":        atomic.LoadUint64(&r.reloads),
+	}
+	if r.reader != nil {
+		stats["database_type"] = r.reader.Metadata.DatabaseType
+		stats["build_time"] = time.Unix(int64(r.reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339)
+	}
+	return stats
+}
+
+// checkForUpdate nạp lại database nếu file thay đổi, tối đa một lần mỗi checkInterval
+// Goroutine khác đang kiểm tra thì bỏ qua để không chặn việc tra cứu
+func (r *GeoIPResolverImpl) checkForUpdate() {
+	if !r.checkMu.TryLock() {
+		return
+	}
+	defer r.checkMu.Unlock()
+
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return
+	}
+
+	r.mu.RLock()
+	changed := r.reader == nil || !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+	r.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		log.Printf("⚠️ Failed to reload GeoIP database, keeping the previous one: %v", err)
+	}
+}
+
+// reload mở file và thay database đang dùng
+func (r *GeoIPResolverImpl) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+
+	reader, err := maxminddb.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	r.mu.Lock()
+	previous := r.reader
+	r.reader = reader
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+		atomic.AddUint64(&r.reloads, 1)
+	}
+
+	log.Printf("🌍 Loaded GeoIP database %s (%s, built %s)", r.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format("2006-01-02"))
+	return nil
+}
+
+// localizedName lấy tên tiếng Anh, không có thì dùng fallback (thường là mã ISO)
+func localizedName(names map[string]string, fallback string) string {
+	if name := names["en"]; name != "" {
+		return name
+	}
+	return fallback
+}
@@ -0,0 +1,80 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyFixture chép database mẫu vào thư mục tạm qua file tạm + rename, giống cách geoipupdate thay file
+func copyFixture(t *testing.T, fixture string, dst string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		t.Fatalf("failed to rename fixture: %v", err)
+	}
+}
+
+// TestGeoIPResolver_Lookup tests country, region and city lookups for IPv4 and IPv6
+func TestGeoIPResolver_Lookup(t *testing.T) {
+	resolver := NewGeoIPResolver(filepath.Join("testdata", "GeoIP2-City-Test.mmdb"), time.Minute)
+	defer resolver.Close()
+
+	location, ok := resolver.Lookup("113.160.12.34")
+	if !ok || location.Country != "Vietnam" || location.Region != "Hanoi" || location.City != "Hanoi" {
+		t.Errorf("Lookup(113.160.12.34) = (%+v, %v), want Vietnam/Hanoi/Hanoi", location, ok)
+	}
+
+	location, ok = resolver.Lookup("81.2.69.160")
+	if !ok || location.Country != "United Kingdom" || location.Region != "England" || location.City != "London" {
+		t.Errorf("Lookup(81.2.69.160) = (%+v, %v), want United Kingdom/England/London", location, ok)
+	}
+
+	// Bản ghi chỉ có quốc gia
+	location, ok = resolver.Lookup("2400:4050::1")
+	if !ok || location.Country != "Japan" || location.City != "" {
+		t.Errorf("Lookup(2400:4050::1) = (%+v, %v), want Japan", location, ok)
+	}
+
+	for _, ip := range []string{"10.0.0.1", "not-an-ip", ""} {
+		if location, ok := resolver.Lookup(ip); ok {
+			t.Errorf("Lookup(%q) = %+v, want not found", ip, location)
+		}
+	}
+}
+
+// TestGeoIPResolver_HotReload tests the database is reloaded after the file is replaced and loaded once it appears
+func TestGeoIPResolver_HotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+
+	// Chưa có file: không lỗi, chỉ chưa tra được
+	resolver := NewGeoIPResolver(path, 10*time.Millisecond)
+	defer resolver.Close()
+	if _, ok := resolver.Lookup("113.160.12.34"); ok {
+		t.Fatalf("Expected lookup to fail before the database exists")
+	}
+
+	copyFixture(t, "GeoIP2-City-Test.mmdb", path)
+	time.Sleep(20 * time.Millisecond)
+	if location, ok := resolver.Lookup("113.160.12.34"); !ok || location.City != "Hanoi" {
+		t.Fatalf("Lookup after file appeared = (%+v, %v), want Hanoi", location, ok)
+	}
+
+	copyFixture(t, "GeoIP2-City-Test-Updated.mmdb", path)
+	time.Sleep(20 * time.Millisecond)
+	if location, ok := resolver.Lookup("113.160.12.34"); !ok || location.City != "Da Nang" {
+		t.Errorf("Lookup after file changed = (%+v, %v), want Da Nang", location, ok)
+	}
+	if stats := resolver.GetStats(); stats["reloads"] != uint64(1) || stats["loaded"] != true {
+		t.Errorf("Unexpected stats after reload: %v", stats)
+	}
+}
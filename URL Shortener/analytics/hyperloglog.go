@@ -0,0 +1,101 @@
+package analytics
+
+import (
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// hllPrecision giống Redis: 2^14 thanh ghi, sai số chuẩn khoảng 0.81%
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+	// hllSparseLimit là số thanh ghi khác 0 tối đa ở dạng sparse (4 byte mỗi thanh ghi),
+	// vượt quá thì chuyển sang mảng đầy đủ 16KB
+	hllSparseLimit = 1024
+)
+
+// HyperLogLog ước lượng số phần tử khác nhau với bộ nhớ cố định
+//
+// Link ít người xem chỉ cần vài chục byte: các thanh ghi khác 0 được giữ trong slice sắp xếp
+// theo index, chỉ chuyển sang mảng đầy đủ khi có nhiều hơn hllSparseLimit thanh ghi.
+// Không an toàn khi dùng đồng thời, caller tự khóa
+type HyperLogLog struct {
+	sparse []uint32 // index<<8 | rank, sắp xếp theo index
+	dense  []uint8  // nil khi còn ở dạng sparse
+}
+
+// NewHyperLogLog tạo HyperLogLog rỗng
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// AddHash thêm một phần tử đã được băm ra 64 bit phân bố đều
+func (h *HyperLogLog) AddHash(hash uint64) {
+	index := uint32(hash >> (64 - hllPrecision))
+	// Bit đánh dấu đảm bảo rank không vượt quá 64 - hllPrecision + 1
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	if h.dense != nil {
+		if rank > h.dense[index] {
+			h.dense[index] = rank
+		}
+		return
+	}
+
+	i := sort.Search(len(h.sparse), func(i int) bool { return h.sparse[i]>>8 >= index })
+	if i < len(h.sparse) && h.sparse[i]>>8 == index {
+		if rank > uint8(h.sparse[i]) {
+			h.sparse[i] = index<<8 | uint32(rank)
+		}
+		return
+	}
+
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = index<<8 | uint32(rank)
+
+	if len(h.sparse) > hllSparseLimit {
+		h.toDense()
+	}
+}
+
+// Count trả về số phần tử khác nhau ước lượng
+func (h *HyperLogLog) Count() uint64 {
+	sum := 0.0
+	zeros := 0
+
+	if h.dense != nil {
+		for _, rank := range h.dense {
+			if rank == 0 {
+				zeros++
+			}
+			sum += math.Ldexp(1, -int(rank))
+		}
+	} else {
+		zeros = hllRegisters - len(h.sparse)
+		sum = float64(zeros)
+		for _, entry := range h.sparse {
+			sum += math.Ldexp(1, -int(uint8(entry)))
+		}
+	}
+
+	m := float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Ít phần tử thì linear counting chính xác hơn
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// toDense chuyển các thanh ghi sang mảng đầy đủ
+func (h *HyperLogLog) toDense() {
+	h.dense = make([]uint8, hllRegisters)
+	for _, entry := range h.sparse {
+		h.dense[entry>>8] = uint8(entry)
+	}
+	h.sparse = nil
+}
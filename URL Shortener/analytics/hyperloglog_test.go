@@ -0,0 +1,36 @@
+package analytics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestHyperLogLog_Count tests the estimate stays within 2% in both sparse and dense form and ignores duplicates
+func TestHyperLogLog_Count(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{0, 1, 100, 1000, 10000, 200000} {
+		hll := NewHyperLogLog()
+		hashes := make([]uint64, n)
+		for i := range hashes {
+			hashes[i] = rng.Uint64()
+			hll.AddHash(hashes[i])
+		}
+		// Thêm lại cùng phần tử không làm tăng số đếm
+		for _, hash := range hashes {
+			hll.AddHash(hash)
+		}
+
+		got := hll.Count()
+		if n == 0 {
+			if got != 0 {
+				t.Errorf("Count() of empty = %d, want 0", got)
+			}
+			continue
+		}
+		if diff := math.Abs(float64(got)-float64(n)) / float64(n); diff > 0.02 {
+			t.Errorf("Count() = %d for %d elements, error %.2f%% > 2%%", got, n, diff*100)
+		}
+	}
+}
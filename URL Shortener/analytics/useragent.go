@@ -0,0 +1,191 @@
+package analytics
+
+import "strings"
+
+// Các loại thiết bị được gắn vào ClickEvent.DeviceType
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceTV      = "tv"
+	DeviceConsole = "console"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgentInfo là kết quả phân tích một User-Agent
+type UserAgentInfo struct {
+	DeviceType     string
+	OSFamily       string
+	OSVersion      string
+	BrowserFamily  string
+	BrowserVersion string
+}
+
+// uaPattern nhận diện một họ OS/trình duyệt: token đứng ngay trước số phiên bản
+type uaPattern struct {
+	token  string
+	family string
+}
+
+// browserPatterns được so khớp theo thứ tự: Edge, Opera, Samsung... đều chứa "Chrome/" và "Safari/"
+// nên phải đứng trước Chrome, Chrome đứng trước Safari
+var browserPatterns = []uaPattern{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera/", "Opera"},
+	{"coc_coc_browser/", "Coc Coc"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"ucbrowser/", "UC Browser"},
+	{"yabrowser/", "Yandex Browser"},
+	{"miuibrowser/", "MIUI Browser"},
+	{"zalo/", "Zalo"},
+	{"fbav/", "Facebook"},
+	{"instagram ", "Instagram"},
+	{"fxios/", "Firefox"},
+	{"firefox/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+}
+
+// windowsVersions ánh xạ phiên bản Windows NT sang tên thương mại
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// ParseUserAgent phân tích User-Agent thành loại thiết bị, OS và trình duyệt
+// Trường nào không nhận diện được thì để rỗng (DeviceType là "unknown")
+func ParseUserAgent(userAgent string) UserAgentInfo {
+	ua := strings.ToLower(userAgent)
+
+	info := UserAgentInfo{}
+	info.OSFamily, info.OSVersion = parseOS(ua)
+	info.BrowserFamily, info.BrowserVersion = parseBrowser(ua)
+	info.DeviceType = parseDevice(ua, info.OSFamily)
+	return info
+}
+
+// parseOS nhận diện hệ điều hành và phiên bản
+func parseOS(ua string) (string, string) {
+	switch {
+	case strings.Contains(ua, "windows phone"):
+		return "Windows Phone", versionAfter(ua, "windows phone ")
+	case strings.Contains(ua, "windows nt "):
+		nt := versionAfter(ua, "windows nt ")
+		if name, ok := windowsVersions[nt]; ok {
+			return "Windows", name
+		}
+		return "Windows", nt
+	case strings.Contains(ua, "windows"):
+		return "Windows", ""
+	case strings.Contains(ua, "iphone os "):
+		return "iOS", versionAfter(ua, "iphone os ")
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod") || strings.Contains(ua, "iphone"):
+		return "iOS", versionAfter(ua, "cpu os ")
+	case strings.Contains(ua, "mac os x"):
+		return "macOS", versionAfter(ua, "mac os x ")
+	case strings.Contains(ua, "android"):
+		return "Android", versionAfter(ua, "android ")
+	case strings.Contains(ua, "harmonyos"):
+		return "HarmonyOS", versionAfter(ua, "harmonyos ")
+	case strings.Contains(ua, "cros "):
+		return "Chrome OS", ""
+	case strings.Contains(ua, "linux"):
+		return "Linux", ""
+	}
+	return "", ""
+}
+
+// parseBrowser nhận diện trình duyệt và phiên bản
+func parseBrowser(ua string) (string, string) {
+	for _, pattern := range browserPatterns {
+		if strings.Contains(ua, pattern.token) {
+			return pattern.family, versionAfter(ua, pattern.token)
+		}
+	}
+	// Safari ghi phiên bản ở "Version/x.y", token "Safari/" là phiên bản WebKit
+	if strings.Contains(ua, "safari/") && strings.Contains(ua, "version/") {
+		return "Safari", versionAfter(ua, "version/")
+	}
+	return "", ""
+}
+
+// parseDevice nhận diện loại thiết bị
+func parseDevice(ua string, osFamily string) string {
+	switch {
+	case ua == "":
+		return DeviceUnknown
+	case containsAny(ua, "playstation", "xbox", "nintendo"):
+		return DeviceConsole
+	case containsAny(ua, "smart-tv", "smarttv", "googletv", "appletv", "hbbtv", "roku", "crkey", "web0s"):
+		return DeviceTV
+	case containsAny(ua, "ipad", "tablet", "kindle", "silk/", "playbook"):
+		return DeviceTablet
+	case osFamily == "Android" && !strings.Contains(ua, "mobile"):
+		// Điện thoại Android luôn có "Mobile", tablet Android thì không
+		return DeviceTablet
+	case containsAny(ua, "mobile", "iphone", "ipod", "windows phone", "blackberry", "opera mini"):
+		return DeviceMobile
+	case osFamily == "Windows" || osFamily == "macOS" || osFamily == "Linux" || osFamily == "Chrome OS":
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+// maxVersionDigits giới hạn số chữ số của mỗi phần phiên bản để "major.minor" (tối đa 15 ký tự)
+// luôn vừa cột os_version/browser_version VARCHAR(16), kể cả với User-Agent giả mạo
+const maxVersionDigits = 7
+
+// versionAfter lấy phiên bản (tối đa major.minor) đứng ngay sau token, "_" được đổi thành "."
+// Chữ số vượt quá maxVersionDigits của mỗi phần bị bỏ
+func versionAfter(ua string, token string) string {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return ""
+	}
+	rest := ua[i+len(token):]
+
+	var version strings.Builder
+	dots := 0
+	digits := 0
+	for end := 0; end < len(rest); end++ {
+		ch := rest[end]
+		if ch == '.' || ch == '_' {
+			dots++
+			if dots == 2 {
+				break
+			}
+			version.WriteByte('.')
+			digits = 0
+		} else if ch >= '0' && ch <= '9' {
+			if digits < maxVersionDigits {
+				version.WriteByte(ch)
+			}
+			digits++
+		} else {
+			break
+		}
+	}
+	return strings.TrimRight(version.String(), ".")
+}
+
+// containsAny kiểm tra chuỗi có chứa một trong các token không
+func containsAny(s string, tokens ...string) bool {
+	for _, token := range tokens {
+		if strings.Contains(s, token) {
+			return true
+		}
+	}
+	return false
+}
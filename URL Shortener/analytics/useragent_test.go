@@ -0,0 +1,72 @@
+package analytics
+
+import "testing"
+
+// TestParseUserAgent tests device, OS and browser detection on common user agents
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      UserAgentInfo
+	}{
+		{
+			name:      "Chrome on Windows",
+			userAgent: chromeUA,
+			want:      UserAgentInfo{DeviceDesktop, "Windows", "10", "Chrome", "126.0"},
+		},
+		{
+			name:      "Safari on iPhone",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want:      UserAgentInfo{DeviceMobile, "iOS", "17.5", "Safari", "17.5"},
+		},
+		{
+			name:      "Safari on iPad",
+			userAgent: "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want:      UserAgentInfo{DeviceTablet, "iOS", "16.6", "Safari", "16.6"},
+		},
+		{
+			name:      "Samsung Internet on Android phone",
+			userAgent: "Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0.0.0 Mobile Safari/537.36",
+			want:      UserAgentInfo{DeviceMobile, "Android", "14", "Samsung Internet", "25.0"},
+		},
+		{
+			name:      "Chrome on Android tablet",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want:      UserAgentInfo{DeviceTablet, "Android", "13", "Chrome", "126.0"},
+		},
+		{
+			name:      "Edge on macOS",
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.2592.87",
+			want:      UserAgentInfo{DeviceDesktop, "macOS", "10.15", "Edge", "126.0"},
+		},
+		{
+			name:      "Firefox on Linux",
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want:      UserAgentInfo{DeviceDesktop, "Linux", "", "Firefox", "127.0"},
+		},
+		{
+			name:      "Coc Coc on Windows",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) coc_coc_browser/123.0.184 Chrome/117.0.5938.169 Safari/537.36",
+			want:      UserAgentInfo{DeviceDesktop, "Windows", "10", "Coc Coc", "123.0"},
+		},
+		{
+			// Phiên bản dài bất thường bị cắt để vừa cột VARCHAR(16)
+			name:      "Oversized versions",
+			userAgent: "Mozilla/5.0 (Linux; Android 123456789012345678.98765432109876; Pixel) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/99999999999999999999.12345678901234567890 Mobile Safari/537.36",
+			want:      UserAgentInfo{DeviceMobile, "Android", "1234567.9876543", "Chrome", "9999999.1234567"},
+		},
+		{
+			name:      "Empty",
+			userAgent: "",
+			want:      UserAgentInfo{DeviceType: DeviceUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("ParseUserAgent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
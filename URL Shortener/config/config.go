@@ -3,29 +3,46 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config chứa tất cả cấu hình của ứng dụng
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	App      AppConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	Cache     CacheConfig
+	Janitor   JanitorConfig
+	Analytics AnalyticsConfig
+	App       AppConfig
 }
 
 type ServerConfig struct {
 	Port    string
 	BaseURL string
+	// ReadTimeout là thời gian tối đa đọc một request (cả header và body)
+	ReadTimeout time.Duration
+	// WriteTimeout là thời gian tối đa xử lý và ghi response
+	WriteTimeout time.Duration
+	// IdleTimeout là thời gian giữ kết nối keep-alive không hoạt động
+	IdleTimeout time.Duration
+	// ShutdownTimeout là thời gian chờ các request đang chạy hoàn thành khi tắt server
+	ShutdownTimeout time.Duration
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
+	Driver      string // "postgres", "sqlite" hoặc "memory"
+	Host        string
+	Port        string
+	User        string
+	Password    string
+	DBName      string
+	SQLitePath  string // Đường dẫn file khi Driver = "sqlite"
+	AutoMigrate bool   // Tự chạy "migrate up" khi khởi động
+	// QueryTimeout là thời gian tối đa của mỗi truy vấn database (0 = không giới hạn)
+	QueryTimeout time.Duration
 }
 
 type RedisConfig struct {
@@ -33,10 +50,83 @@ type RedisConfig struct {
 	Port     string
 	Password string
 	DB       int
+	Timeout  time.Duration // Thời gian tối đa của mỗi lệnh Redis (dial, read, write)
+}
+
+type CacheConfig struct {
+	Driver string // "redis" hoặc "memory"
+	// LocalSize là số link tối đa giữ trong LRU của process trước Redis (0 = tắt)
+	LocalSize int
+	// LocalTTL là thời gian tối đa một link nằm trong LRU local
+	LocalTTL time.Duration
+	// NegativeTTL là thời gian cache kết quả "short code không tồn tại" (0 = tắt)
+	NegativeTTL time.Duration
+	// BreakerThreshold là số lỗi Redis liên tiếp trước khi ngắt mạch và bỏ qua cache
+	BreakerThreshold int
+	// BreakerRetryInterval là chu kỳ thử kết nối lại Redis khi mạch đang ngắt
+	BreakerRetryInterval time.Duration
+	// WarmUpSize là số link nóng nạp sẵn vào cache khi khởi động và khi Redis kết nối lại (0 = tắt)
+	WarmUpSize int
+}
+
+// JanitorConfig cấu hình job dọn dẹp link hết hạn chạy nền
+type JanitorConfig struct {
+	Enabled bool
+	// Interval là khoảng thời gian giữa hai lần quét
+	Interval time.Duration
+	// GracePeriod là thời gian link hết hạn vẫn được giữ trước khi bị xóa
+	GracePeriod time.Duration
+	// BatchSize là số link tối đa xử lý trong một lượt truy vấn
+	BatchSize int
+	// ArchiveAnalytics chép click events sang click_events_archive trước khi purge
+	ArchiveAnalytics bool
+}
+
+// AnalyticsConfig cấu hình worker ghi click events bất đồng bộ
+type AnalyticsConfig struct {
+	// Workers là số goroutine xử lý click events
+	Workers int
+	// QueueSize là số click events tối đa chờ trong queue, queue đầy thì event bị bỏ
+	QueueSize int
+	// DrainTimeout là thời gian tối đa xử lý nốt queue khi tắt server
+	DrainTimeout time.Duration
+	// Queue là nơi chứa click events chờ ghi: "memory", "spool" (file trên đĩa, không mất khi restart)
+	// hoặc "redis" (Redis Stream dùng chung giữa các replica)
+	Queue string
+	// SpoolDir là thư mục chứa các segment của spool
+	SpoolDir string
+	// SpoolSegmentSize là kích thước tối đa của một file segment (byte)
+	SpoolSegmentSize int64
+	// SpoolMaxSize giới hạn tổng dung lượng spool (byte), vượt quá thì click mới bị bỏ
+	SpoolMaxSize int64
+	// SpoolFsync là chính sách fsync: "always", "interval" hoặc "never"
+	SpoolFsync string
+	// SpoolFsyncInterval là chu kỳ fsync khi SpoolFsync = "interval"
+	SpoolFsyncInterval time.Duration
+	// StreamMaxLen giới hạn số click chờ trong Redis Stream
+	StreamMaxLen int64
+	// StreamClaimTimeout là thời gian click chưa Ack trước khi consumer khác nhận xử lý lại
+	StreamClaimTimeout time.Duration
+	// StreamMaxDeliveries là số lần giao tối đa trước khi click bị chuyển sang dead-letter stream
+	StreamMaxDeliveries int
+	// BotBurstLimit là số click tối đa từ một IP trong BotBurstWindow, vượt quá thì bị coi là bot
+	BotBurstLimit int
+	// BotBurstWindow là cửa sổ thời gian đếm click theo IP
+	BotBurstWindow time.Duration
+	// GeoIPDatabase là đường dẫn file MMDB (GeoLite2/GeoIP2 City), rỗng = không tra vị trí
+	GeoIPDatabase string
+	// GeoIPCheckInterval là chu kỳ kiểm tra file MMDB thay đổi để nạp lại
+	GeoIPCheckInterval time.Duration
+	// VisitorSalt được trộn vào hash IP + User-Agent khi đếm người xem duy nhất,
+	// phải giống nhau giữa các replica
+	VisitorSalt string
 }
 
 type AppConfig struct {
 	ShortCodeLength int
+	// DeletedCodeRetention là thời gian short code của link đã xóa vẫn được giữ
+	// (link có thể khôi phục); sau đó code được purge khi có người dùng lại
+	DeletedCodeRetention time.Duration
 }
 
 // LoadConfig đọc cấu hình từ file .env
@@ -46,27 +136,83 @@ func LoadConfig() (*Config, error) {
 
 	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
 	shortCodeLength, _ := strconv.Atoi(getEnv("SHORT_CODE_LENGTH", "6"))
+	cacheLocalSize, _ := strconv.Atoi(getEnv("CACHE_LOCAL_SIZE", "1000"))
+	breakerThreshold, _ := strconv.Atoi(getEnv("CACHE_BREAKER_THRESHOLD", "5"))
+	warmUpSize, _ := strconv.Atoi(getEnv("CACHE_WARMUP_SIZE", "1000"))
+	janitorBatchSize, _ := strconv.Atoi(getEnv("JANITOR_BATCH_SIZE", "500"))
+	analyticsWorkers, _ := strconv.Atoi(getEnv("ANALYTICS_WORKERS", "4"))
+	analyticsQueueSize, _ := strconv.Atoi(getEnv("ANALYTICS_QUEUE_SIZE", "10000"))
+	spoolSegmentMB, _ := strconv.ParseInt(getEnv("ANALYTICS_SPOOL_SEGMENT_MB", "16"), 10, 64)
+	spoolMaxMB, _ := strconv.ParseInt(getEnv("ANALYTICS_SPOOL_MAX_MB", "1024"), 10, 64)
+	streamMaxLen, _ := strconv.ParseInt(getEnv("ANALYTICS_STREAM_MAX_LEN", "1000000"), 10, 64)
+	streamMaxDeliveries, _ := strconv.Atoi(getEnv("ANALYTICS_STREAM_MAX_DELIVERIES", "5"))
+	botBurstLimit, _ := strconv.Atoi(getEnv("ANALYTICS_BOT_BURST_LIMIT", "20"))
 
 	config := &Config{
 		Server: ServerConfig{
-			Port:    getEnv("PORT", "8080"),
-			BaseURL: getEnv("BASE_URL", "http://localhost:8080"),
+			Port:            getEnv("PORT", "8080"),
+			BaseURL:         getEnv("BASE_URL", "http://localhost:8080"),
+			ReadTimeout:     getDuration("SERVER_READ_TIMEOUT", 10*time.Second),
+			WriteTimeout:    getDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:     getDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			ShutdownTimeout: getDuration("SERVER_SHUTDOWN_TIMEOUT", 20*time.Second),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "password"),
-			DBName:   getEnv("DB_NAME", "url_shortener"),
+			Driver:       getEnv("DB_DRIVER", "postgres"),
+			Host:         getEnv("DB_HOST", "localhost"),
+			Port:         getEnv("DB_PORT", "5432"),
+			User:         getEnv("DB_USER", "postgres"),
+			Password:     getEnv("DB_PASSWORD", "password"),
+			DBName:       getEnv("DB_NAME", "url_shortener"),
+			SQLitePath:   getEnv("DB_SQLITE_PATH", "url_shortener.db"),
+			AutoMigrate:  getEnv("DB_AUTO_MIGRATE", "true") == "true",
+			QueryTimeout: getDuration("DB_QUERY_TIMEOUT", 3*time.Second),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       redisDB,
+			Timeout:  getDuration("REDIS_TIMEOUT", 200*time.Millisecond),
+		},
+		Cache: CacheConfig{
+			Driver:               getEnv("CACHE_DRIVER", "redis"),
+			LocalSize:            cacheLocalSize,
+			LocalTTL:             getDuration("CACHE_LOCAL_TTL", 30*time.Second),
+			NegativeTTL:          getDuration("CACHE_NEGATIVE_TTL", time.Minute),
+			BreakerThreshold:     breakerThreshold,
+			BreakerRetryInterval: getDuration("CACHE_BREAKER_RETRY_INTERVAL", 5*time.Second),
+			WarmUpSize:           warmUpSize,
+		},
+		Janitor: JanitorConfig{
+			Enabled:          getEnv("JANITOR_ENABLED", "true") == "true",
+			Interval:         getDuration("JANITOR_INTERVAL", time.Hour),
+			GracePeriod:      getDuration("JANITOR_GRACE_PERIOD", 24*time.Hour),
+			BatchSize:        janitorBatchSize,
+			ArchiveAnalytics: getEnv("JANITOR_ARCHIVE_ANALYTICS", "false") == "true",
+		},
+		Analytics: AnalyticsConfig{
+			Workers:             analyticsWorkers,
+			QueueSize:           analyticsQueueSize,
+			DrainTimeout:        getDuration("ANALYTICS_DRAIN_TIMEOUT", 10*time.Second),
+			Queue:               getEnv("ANALYTICS_QUEUE", "memory"),
+			SpoolDir:            getEnv("ANALYTICS_SPOOL_DIR", "data/spool"),
+			SpoolSegmentSize:    spoolSegmentMB << 20,
+			SpoolMaxSize:        spoolMaxMB << 20,
+			SpoolFsync:          getEnv("ANALYTICS_SPOOL_FSYNC", "interval"),
+			SpoolFsyncInterval:  getDuration("ANALYTICS_SPOOL_FSYNC_INTERVAL", time.Second),
+			StreamMaxLen:        streamMaxLen,
+			StreamClaimTimeout:  getDuration("ANALYTICS_STREAM_CLAIM_TIMEOUT", time.Minute),
+			StreamMaxDeliveries: streamMaxDeliveries,
+			BotBurstLimit:       botBurstLimit,
+			BotBurstWindow:      getDuration("ANALYTICS_BOT_BURST_WINDOW", 10*time.Second),
+			GeoIPDatabase:       getEnv("ANALYTICS_GEOIP_DB", ""),
+			GeoIPCheckInterval:  getDuration("ANALYTICS_GEOIP_CHECK_INTERVAL", time.Minute),
+			VisitorSalt:         getEnv("ANALYTICS_VISITOR_SALT", ""),
 		},
 		App: AppConfig{
-			ShortCodeLength: shortCodeLength,
+			ShortCodeLength:      shortCodeLength,
+			DeletedCodeRetention: getDuration("DELETED_CODE_RETENTION", 30*24*time.Hour),
 		},
 	}
 
@@ -79,3 +225,11 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getDuration đọc biến môi trường dạng time.Duration (ví dụ "30s", "720h")
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"fmt"
+
+	"url-shortener/config"
+
+	"gorm.io/gorm"
+)
+
+// SQLDatabase là interface chung cho các SQL backend (PostgreSQL, SQLite)
+type SQLDatabase interface {
+	// Gorm trả về GORM connection để khởi tạo repositories
+	Gorm() *gorm.DB
+
+	// AutoMigrate thực hiện auto migration cho các models
+	AutoMigrate(models ...interface{}) error
+
+	// Close đóng kết nối database
+	Close() error
+}
+
+// NewSQLDatabase mở kết nối database theo cfg.Driver
+func NewSQLDatabase(cfg config.DatabaseConfig) (SQLDatabase, error) {
+	switch cfg.Driver {
+	case "postgres", "":
+		return NewPostgresDB(cfg)
+	case "sqlite":
+		return NewSQLiteDB(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+}
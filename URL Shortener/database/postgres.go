@@ -40,6 +40,11 @@ func (p *PostgresDB) AutoMigrate(models ...interface{}) error {
 	return p.DB.AutoMigrate(models...)
 }
 
+// Gorm trả về GORM connection bên dưới
+func (p *PostgresDB) Gorm() *gorm.DB {
+	return p.DB
+}
+
 // Close đóng kết nối database
 func (p *PostgresDB) Close() error {
 	sqlDB, err := p.DB.DB()
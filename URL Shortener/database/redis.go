@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"url-shortener/config"
@@ -12,59 +13,310 @@ import (
 )
 
 // RedisClient là wrapper cho Redis client
+// Mọi lệnh nhận context của request để bị hủy khi client ngắt kết nối hoặc hết thời gian
 type RedisClient struct {
 	Client *redis.Client
-	Ctx    context.Context
 }
 
-// NewRedisClient tạo kết nối mới đến Redis
+// NewRedisClient tạo kết nối mới đến Redis, trả về lỗi nếu không ping được
 func NewRedisClient(cfg config.RedisConfig) (*RedisClient, error) {
-	ctx := context.Background()
-
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	client := ConnectRedis(cfg)
 
 	// Kiểm tra kết nối
-	_, err := client.Ping(ctx).Result()
-	if err != nil {
+	if err := client.Ping(context.Background()); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	log.Println("✅ Connected to Redis successfully")
 
+	return client, nil
+}
+
+// ConnectRedis tạo Redis client mà không kiểm tra kết nối
+// Connection pool tự kết nối lại khi Redis sẵn sàng, dùng khi Redis là tùy chọn
+func ConnectRedis(cfg config.RedisConfig) *RedisClient {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+		// Timeout ngắn để Redis chậm không làm chậm redirect
+		DialTimeout:  cfg.Timeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		PoolTimeout:  cfg.Timeout,
+		MaxRetries:   -1, // Không retry, circuit breaker quyết định khi nào thử lại
+	})
+
 	return &RedisClient{
 		Client: client,
-		Ctx:    ctx,
-	}, nil
+	}
+}
+
+// Ping kiểm tra kết nối tới Redis
+func (r *RedisClient) Ping(ctx context.Context) error {
+	return r.Client.Ping(ctx).Err()
 }
 
 // Set lưu giá trị vào Redis với TTL
-func (r *RedisClient) Set(key, value string, expiration time.Duration) error {
-	return r.Client.Set(r.Ctx, key, value, expiration).Err()
+func (r *RedisClient) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	return r.Client.Set(ctx, key, value, expiration).Err()
+}
+
+// SetNX chỉ lưu giá trị nếu key chưa tồn tại, trả về true nếu đã lưu
+func (r *RedisClient) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, key, value, expiration).Result()
+}
+
+// PipelineItem là một key cần ghi trong SetNXPipelined
+type PipelineItem struct {
+	Key        string
+	Value      string
+	Expiration time.Duration
+}
+
+// SetNXPipelined ghi nhiều key (SET NX) trong một round trip, trả về các key đã được lưu
+func (r *RedisClient) SetNXPipelined(ctx context.Context, items []PipelineItem) ([]string, error) {
+	cmds := make([]*redis.BoolCmd, len(items))
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			cmds[i] = pipe.SetNX(ctx, item.Key, item.Value, item.Expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make([]string, 0, len(items))
+	for i, cmd := range cmds {
+		if cmd.Val() {
+			stored = append(stored, items[i].Key)
+		}
+	}
+	return stored, nil
 }
 
 // Get lấy giá trị từ Redis
-func (r *RedisClient) Get(key string) (string, error) {
-	return r.Client.Get(r.Ctx, key).Result()
+func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
+	return r.Client.Get(ctx, key).Result()
 }
 
 // Delete xóa key từ Redis
-func (r *RedisClient) Delete(key string) error {
-	return r.Client.Del(r.Ctx, key).Err()
+func (r *RedisClient) Delete(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, key).Err()
+}
+
+// DeleteMatching xóa mọi key khớp pattern bằng SCAN (không chặn Redis như KEYS), trả về số key đã xóa
+func (r *RedisClient) DeleteMatching(ctx context.Context, pattern string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := r.Client.Scan(ctx, cursor, pattern, 1000).Result()
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) > 0 {
+			n, err := r.Client.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
 }
 
 // Exists kiểm tra key có tồn tại không
-func (r *RedisClient) Exists(key string) (bool, error) {
-	result, err := r.Client.Exists(r.Ctx, key).Result()
+func (r *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
+	result, err := r.Client.Exists(ctx, key).Result()
 	return result > 0, err
 }
 
 // Incr tăng giá trị của key
-func (r *RedisClient) Incr(key string) (int64, error) {
-	return r.Client.Incr(r.Ctx, key).Result()
+func (r *RedisClient) Incr(ctx context.Context, key string) (int64, error) {
+	return r.Client.Incr(ctx, key).Result()
+}
+
+// Publish gửi message tới một channel pub/sub
+func (r *RedisClient) Publish(ctx context.Context, channel, message string) error {
+	return r.Client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe đăng ký nhận message từ các channel pub/sub
+func (r *RedisClient) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return r.Client.Subscribe(ctx, channels...)
+}
+
+// XAdd thêm message vào stream, stream dài hơn maxLen (xấp xỉ) thì message cũ nhất bị cắt
+func (r *RedisClient) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	return r.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: values,
+	}).Result()
+}
+
+// XAddPipelined thêm nhiều message vào stream trong một round trip
+func (r *RedisClient) XAddPipelined(ctx context.Context, stream string, maxLen int64, messages []map[string]interface{}) error {
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, values := range messages {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				MaxLen: maxLen,
+				Approx: true,
+				Values: values,
+			})
+		}
+		return nil
+	})
+	return err
+}
+
+// XGroupCreate tạo consumer group (và stream nếu chưa có), bỏ qua lỗi khi group đã tồn tại
+func (r *RedisClient) XGroupCreate(ctx context.Context, stream, group string) error {
+	err := r.Client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// XReadGroup đọc tối đa count message mới cho consumer, chờ tối đa block (block < 0: không chờ)
+// Trả về redis.Nil khi hết thời gian chờ mà không có message
+func (r *RedisClient) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []redis.XMessage
+	for _, s := range streams {
+		messages = append(messages, s.Messages...)
+	}
+	return messages, nil
+}
+
+// XPendingIdle liệt kê tối đa count message đã giao nhưng chưa Ack quá idle
+func (r *RedisClient) XPendingIdle(ctx context.Context, stream, group string, idle time.Duration, count int64) ([]redis.XPendingExt, error) {
+	return r.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Idle:   idle,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+}
+
+// XClaim chuyển các message chưa Ack quá minIdle sang consumer khác
+func (r *RedisClient) XClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids []string) ([]redis.XMessage, error) {
+	return r.Client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// XClaimJustID nhận các message cho consumer bất kể thời gian idle và đặt lại thời gian idle về 0
+// JUSTID: không trả về nội dung message và không tăng số lần giao
+func (r *RedisClient) XClaimJustID(ctx context.Context, stream, group, consumer string, ids []string) error {
+	return r.Client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		Messages: ids,
+	}).Err()
+}
+
+// XGet lấy một message theo ID, trả về redis.Nil nếu message đã bị xóa
+func (r *RedisClient) XGet(ctx context.Context, stream, id string) (*redis.XMessage, error) {
+	messages, err := r.Client.XRangeN(ctx, stream, id, id, 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, redis.Nil
+	}
+	return &messages[0], nil
+}
+
+// XAckDel xác nhận và xóa các message khỏi stream trong một round trip
+func (r *RedisClient) XAckDel(ctx context.Context, stream, group string, ids ...string) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, group, ids...)
+		pipe.XDel(ctx, stream, ids...)
+		return nil
+	})
+	return err
+}
+
+// XLen trả về số message trong stream
+func (r *RedisClient) XLen(ctx context.Context, stream string) (int64, error) {
+	return r.Client.XLen(ctx, stream).Result()
+}
+
+// XPendingCount trả về số message đã giao nhưng chưa Ack của consumer group
+func (r *RedisClient) XPendingCount(ctx context.Context, stream, group string) (int64, error) {
+	pending, err := r.Client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return 0, err
+	}
+	return pending.Count, nil
+}
+
+// HLLItem là các phần tử cần thêm vào một HyperLogLog trong PFAddPipelined
+type HLLItem struct {
+	Key        string
+	Elements   []interface{}
+	Expiration time.Duration // 0 = không hết hạn
+}
+
+// PFAddPipelined thêm phần tử vào nhiều HyperLogLog (và đặt TTL) trong một round trip
+func (r *RedisClient) PFAddPipelined(ctx context.Context, items []HLLItem) error {
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			pipe.PFAdd(ctx, item.Key, item.Elements...)
+			if item.Expiration > 0 {
+				pipe.Expire(ctx, item.Key, item.Expiration)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// PFCountEach đếm riêng từng HyperLogLog trong một round trip
+// (PFCOUNT nhiều key một lúc trả về số phần tử của hợp các key)
+func (r *RedisClient) PFCountEach(ctx context.Context, keys []string) ([]int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := r.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.PFCount(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(keys))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
 }
 
 // Close đóng kết nối Redis
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis tạo RedisClient kết nối tới miniredis chạy trong process
+func newTestRedis(t *testing.T) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := ConnectRedis(config.RedisConfig{Host: server.Host(), Port: server.Port(), Timeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+// TestRedisClient_Streams tests the stream helpers used by the click queue
+func TestRedisClient_Streams(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestRedis(t)
+	start := time.Now()
+	server.SetTime(start)
+
+	if err := client.XGroupCreate(ctx, "s", "g"); err != nil {
+		t.Fatalf("XGroupCreate returned error: %v", err)
+	}
+	if err := client.XGroupCreate(ctx, "s", "g"); err != nil {
+		t.Errorf("XGroupCreate on an existing group = %v, want nil", err)
+	}
+
+	first, err := client.XAdd(ctx, "s", 100, map[string]interface{}{"event": "1"})
+	if err != nil {
+		t.Fatalf("XAdd returned error: %v", err)
+	}
+	second, _ := client.XAdd(ctx, "s", 100, map[string]interface{}{"event": "2"})
+
+	messages, err := client.XReadGroup(ctx, "s", "g", "alice", 10, -1)
+	if err != nil || len(messages) != 2 || messages[0].ID != first || messages[1].Values["event"] != "2" {
+		t.Fatalf("XReadGroup = (%+v, %v)", messages, err)
+	}
+	if _, err := client.XReadGroup(ctx, "s", "g", "alice", 10, -1); !errors.Is(err, redis.Nil) {
+		t.Errorf("XReadGroup with no new messages = %v, want redis.Nil", err)
+	}
+	if pending, _ := client.XPendingCount(ctx, "s", "g"); pending != 2 {
+		t.Errorf("XPendingCount = %d, want 2", pending)
+	}
+
+	// Chỉ message idle quá thời gian chờ mới được liệt kê và nhận lại
+	if idle, _ := client.XPendingIdle(ctx, "s", "g", time.Minute, 10); len(idle) != 0 {
+		t.Errorf("XPendingIdle before timeout = %+v, want none", idle)
+	}
+	server.SetTime(start.Add(2 * time.Minute))
+	idle, err := client.XPendingIdle(ctx, "s", "g", time.Minute, 10)
+	if err != nil || len(idle) != 2 || idle[0].Consumer != "alice" || idle[0].RetryCount != 1 {
+		t.Fatalf("XPendingIdle = (%+v, %v)", idle, err)
+	}
+
+	claimed, err := client.XClaim(ctx, "s", "g", "bob", time.Minute, []string{first})
+	if err != nil || len(claimed) != 1 || claimed[0].Values["event"] != "1" {
+		t.Fatalf("XClaim = (%+v, %v)", claimed, err)
+	}
+
+	// XClaimJustID đặt lại thời gian idle nên message không còn bị coi là bị bỏ dở
+	if err := client.XClaimJustID(ctx, "s", "g", "alice", []string{second}); err != nil {
+		t.Fatalf("XClaimJustID returned error: %v", err)
+	}
+	if idle, _ := client.XPendingIdle(ctx, "s", "g", time.Minute, 10); len(idle) != 0 {
+		t.Errorf("XPendingIdle after claims = %+v, want none", idle)
+	}
+
+	message, err := client.XGet(ctx, "s", second)
+	if err != nil || message.Values["event"] != "2" {
+		t.Errorf("XGet = (%+v, %v)", message, err)
+	}
+
+	if err := client.XAckDel(ctx, "s", "g", first, second); err != nil {
+		t.Fatalf("XAckDel returned error: %v", err)
+	}
+	if length, _ := client.XLen(ctx, "s"); length != 0 {
+		t.Errorf("XLen after XAckDel = %d, want 0", length)
+	}
+	if pending, _ := client.XPendingCount(ctx, "s", "g"); pending != 0 {
+		t.Errorf("XPendingCount after XAckDel = %d, want 0", pending)
+	}
+	if _, err := client.XGet(ctx, "s", first); !errors.Is(err, redis.Nil) {
+		t.Errorf("XGet of a deleted message = %v, want redis.Nil", err)
+	}
+
+	err = client.XAddPipelined(ctx, "s", 100, []map[string]interface{}{{"event": "3"}, {"event": "4"}})
+	if err != nil {
+		t.Fatalf("XAddPipelined returned error: %v", err)
+	}
+	if length, _ := client.XLen(ctx, "s"); length != 2 {
+		t.Errorf("XLen after XAddPipelined = %d, want 2", length)
+	}
+}
+
+// TestRedisClient_DeleteMatching tests only keys matching the pattern are deleted
+func TestRedisClient_DeleteMatching(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestRedis(t)
+
+	for i := 0; i < 2500; i++ {
+		server.Set(fmt.Sprintf("url:code%d", i), "{}")
+	}
+	server.Set("visitors:1", "x")
+
+	// Cursor SCAN của miniredis là vị trí trong danh sách key nên xóa giữa chừng làm bỏ sót key
+	// (Redis thật thì không), chạy lại tới khi không còn key khớp
+	var deleted int64
+	for pass := 0; pass < 5; pass++ {
+		n, err := client.DeleteMatching(ctx, "url:*")
+		if err != nil {
+			t.Fatalf("DeleteMatching returned error: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		deleted += n
+	}
+	if deleted != 2500 {
+		t.Errorf("DeleteMatching deleted %d keys, want 2500", deleted)
+	}
+	if keys := server.Keys(); len(keys) != 1 || keys[0] != "visitors:1" {
+		t.Errorf("keys after DeleteMatching = %v, want only visitors:1", keys)
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"url-shortener/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLiteDB là wrapper cho GORM connection tới file SQLite nhúng
+// Driver thuần Go nên vẫn build được với CGO_ENABLED=0
+type SQLiteDB struct {
+	DB *gorm.DB
+}
+
+// NewSQLiteDB mở (hoặc tạo mới) file SQLite theo cấu hình
+func NewSQLiteDB(cfg config.DatabaseConfig) (*SQLiteDB, error) {
+	// foreign_keys: SQLite mặc định tắt ràng buộc khóa ngoại
+	// journal_mode WAL + busy_timeout: cho phép đọc song song với ghi
+	dsn := fmt.Sprintf(
+		"%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)",
+		cfg.SQLitePath,
+	)
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite chỉ cho một writer tại một thời điểm; với ":memory:" mỗi connection
+	// lại là một database riêng nên phải giữ đúng một connection
+	sqlDB.SetMaxOpenConns(1)
+
+	log.Printf("✅ Opened SQLite database at %s", cfg.SQLitePath)
+
+	return &SQLiteDB{DB: db}, nil
+}
+
+// AutoMigrate thực hiện auto migration cho các models
+func (s *SQLiteDB) AutoMigrate(models ...interface{}) error {
+	return s.DB.AutoMigrate(models...)
+}
+
+// Gorm trả về GORM connection bên dưới
+func (s *SQLiteDB) Gorm() *gorm.DB {
+	return s.DB
+}
+
+// Close đóng kết nối database
+func (s *SQLiteDB) Close() error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"url-shortener/interfaces"
+	"url-shortener/models"
+	"url-shortener/repository"
+	"url-shortener/workers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler xử lý các endpoint vận hành (job nền, cache, ...)
+type AdminHandler struct {
+	janitor     *workers.ExpiredLinkJanitor
+	warmer      *workers.CacheWarmer
+	clickWorker *workers.ClickAnalyticsWorker
+	cacheStats  interfaces.CacheStats // nil khi dùng cache in-memory
+	warmUpSize  int                   // Số link warm-up mặc định
+}
+
+// maxWarmUpLimit giới hạn số link một lần warm-up qua admin endpoint
+const maxWarmUpLimit = 100000
+
+// NewAdminHandler tạo instance mới của AdminHandler
+func NewAdminHandler(
+	janitor *workers.ExpiredLinkJanitor,
+	warmer *workers.CacheWarmer,
+	clickWorker *workers.ClickAnalyticsWorker,
+	cacheStats interfaces.CacheStats,
+	warmUpSize int,
+) *AdminHandler {
+	if warmUpSize <= 0 {
+		warmUpSize = 1000
+	}
+
+	return &AdminHandler{
+		janitor:     janitor,
+		warmer:      warmer,
+		clickWorker: clickWorker,
+		cacheStats:  cacheStats,
+		warmUpSize:  warmUpSize,
+	}
+}
+
+// GetCacheStats trả về số hit/miss của từng tầng cache và lần warm-up gần nhất
+// GET /api/admin/cache
+func (h *AdminHandler) GetCacheStats(c *gin.Context) {
+	stats := gin.H{"last_warm_up": h.warmer.LastReport()}
+	if h.cacheStats != nil {
+		for key, value := range h.cacheStats.GetStats() {
+			stats[key] = value
+		}
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// WarmUpCache nạp sẵn các link được click nhiều nhất vào cache
+// POST /api/admin/cache/warmup?limit=1000
+func (h *AdminHandler) WarmUpCache(c *gin.Context) {
+	limit := h.warmUpSize
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxWarmUpLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_limit",
+				Message: "limit must be between 1 and " + strconv.Itoa(maxWarmUpLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	report, err := h.warmer.WarmUp(c.Request.Context(), limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, repository.ErrCacheUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, models.ErrorResponse{
+			Error:   "warm_up_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetJanitorStats trả về cấu hình và kết quả lần quét gần nhất của janitor
+// GET /api/admin/janitor
+func (h *AdminHandler) GetJanitorStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.janitor.GetStats())
+}
+
+// RunJanitor chạy janitor ngay lập tức và trả về báo cáo
+// POST /api/admin/janitor/run
+func (h *AdminHandler) RunJanitor(c *gin.Context) {
+	c.JSON(http.StatusOK, h.janitor.RunOnce(c.Request.Context()))
+}
+
+// GetAnalyticsStats trả về trạng thái click worker và queue (số event chờ, bị bỏ, ...)
+// GET /api/admin/analytics
+func (h *AdminHandler) GetAnalyticsStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.clickWorker.GetStats())
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"url-shortener/interfaces"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler báo trạng thái của service và các dependency
+type HealthHandler struct {
+	checks map[string]interfaces.HealthChecker
+}
+
+// NewHealthHandler tạo instance mới của HealthHandler
+// checks là các dependency tùy chọn, service vẫn phục vụ khi chúng lỗi (degraded)
+func NewHealthHandler(checks map[string]interfaces.HealthChecker) *HealthHandler {
+	return &HealthHandler{
+		checks: checks,
+	}
+}
+
+// HealthCheck kiểm tra trạng thái server
+// GET /health
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	status := "healthy"
+	dependencies := make(map[string]string, len(h.checks))
+
+	for name, check := range h.checks {
+		if check.Healthy() {
+			dependencies[name] = "up"
+			continue
+		}
+		dependencies[name] = "down"
+		status = "degraded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       status,
+		"service":      "url-shortener",
+		"dependencies": dependencies,
+	})
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"url-shortener/interfaces"
 	"url-shortener/models"
 	"url-shortener/services"
 
@@ -12,11 +15,11 @@ import (
 
 // URLHandler xử lý các HTTP requests
 type URLHandler struct {
-	urlService *services.URLServiceImpl
+	urlService interfaces.URLService
 }
 
 // NewURLHandler tạo instance mới của URLHandler
-func NewURLHandler(urlService *services.URLServiceImpl) *URLHandler {
+func NewURLHandler(urlService interfaces.URLService) *URLHandler {
 	return &URLHandler{
 		urlService: urlService,
 	}
@@ -35,21 +38,30 @@ func (h *URLHandler) CreateShortURL(c *gin.Context) {
 		return
 	}
 
-	// Validate URL
-	if !isValidURL(req.OriginalURL) {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid_url",
-			Message: "URL must start with http:// or https://",
-		})
-		return
-	}
-
-	response, err := h.urlService.CreateShortURL(&req)
+	response, err := h.urlService.CreateShortURL(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "creation_failed",
-			Message: err.Error(),
-		})
+		switch {
+		case errors.Is(err, services.ErrInvalidURL):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_url",
+				Message: err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidCustomCode):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_custom_code",
+				Message: err.Error(),
+			})
+		case errors.Is(err, services.ErrCustomCodeExists):
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "custom_code_exists",
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "creation_failed",
+				Message: err.Error(),
+			})
+		}
 		return
 	}
 
@@ -68,7 +80,7 @@ func (h *URLHandler) RedirectToOriginal(c *gin.Context) {
 		return
 	}
 
-	originalURL, err := h.urlService.GetOriginalURL(shortCode)
+	entry, err := h.urlService.ResolveURL(c.Request.Context(), shortCode)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "not_found",
@@ -78,19 +90,29 @@ func (h *URLHandler) RedirectToOriginal(c *gin.Context) {
 	}
 
 	// Ghi nhận click bất đồng bộ (không block response)
-	h.urlService.RecordClick(
-		shortCode,
-		c.ClientIP(),
-		c.Request.UserAgent(),
-		c.Request.Referer(),
-	)
-
-	// Redirect với status 301 (Permanent) hoặc 302 (Temporary)
-	c.Redirect(http.StatusMovedPermanently, originalURL)
+	purpose := c.GetHeader("Sec-Purpose")
+	if purpose == "" {
+		purpose = c.GetHeader("Purpose")
+	}
+	h.urlService.RecordClick(&models.ClickRequest{
+		URLID:          entry.ID,
+		ShortCode:      shortCode,
+		IPAddress:      c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		Referer:        c.Request.Referer(),
+		Accept:         c.GetHeader("Accept"),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		Purpose:        purpose,
+	})
+
+	// Redirect 302 và cấm trình duyệt cache: destination có thể bị sửa, rollback, xóa hoặc hết hạn,
+	// và mọi lượt truy cập phải tới server để được đếm click
+	c.Header("Cache-Control", "private, max-age=0")
+	c.Redirect(http.StatusFound, entry.OriginalURL)
 }
 
 // GetURLStats lấy thống kê của URL
-// GET /api/stats/:shortCode
+// GET /api/stats/:shortCode?include_bots=true
 func (h *URLHandler) GetURLStats(c *gin.Context) {
 	shortCode := c.Param("shortCode")
 
@@ -101,7 +123,10 @@ func (h *URLHandler) GetURLStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := h.urlService.GetStats(shortCode)
+	// Mặc định bỏ click từ bot, ?include_bots=true để tính cả
+	includeBots := c.Query("include_bots") == "true"
+
+	stats, err := h.urlService.GetStats(c.Request.Context(), shortCode, includeBots)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error:   "not_found",
@@ -113,6 +138,147 @@ func (h *URLHandler) GetURLStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// ListURLs liệt kê, tìm kiếm và phân trang short URL
+// GET /api/urls?cursor=&limit=&sort_by=created_at|click_count&order=asc|desc&q=&expired=&custom=&created_after=&created_before=
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	var req models.ListURLsRequest
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.urlService.ListURLs(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrInvalidListQuery) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "list_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateURL thay đổi destination và thiết lập của short URL
+// PATCH /api/urls/:shortCode
+func (h *URLHandler) UpdateURL(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	if shortCode == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "short_code_required",
+		})
+		return
+	}
+
+	var req models.UpdateURLRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	response, err := h.urlService.UpdateURL(c.Request.Context(), shortCode, &req, actorFromRequest(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrURLNotFound):
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidURL):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_url",
+				Message: err.Error(),
+			})
+		case errors.Is(err, services.ErrInvalidUpdate):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "update_failed",
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListRevisions lấy lịch sử thay đổi của short URL
+// GET /api/urls/:shortCode/revisions
+func (h *URLHandler) ListRevisions(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	revisions, err := h.urlService.ListRevisions(c.Request.Context(), shortCode)
+	if err != nil {
+		if errors.Is(err, services.ErrURLNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "list_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RestoreRevision đưa short URL về một phiên bản cũ
+// POST /api/urls/:shortCode/revisions/:id/restore
+func (h *URLHandler) RestoreRevision(c *gin.Context) {
+	shortCode := c.Param("shortCode")
+
+	revisionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "invalid_request",
+			Message: "revision id must be a positive integer",
+		})
+		return
+	}
+
+	response, err := h.urlService.RestoreRevision(c.Request.Context(), shortCode, uint(revisionID), actorFromRequest(c))
+	if err != nil {
+		if errors.Is(err, services.ErrURLNotFound) || errors.Is(err, services.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "restore_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // DeleteURL xóa short URL
 // DELETE /api/urls/:shortCode
 func (h *URLHandler) DeleteURL(c *gin.Context) {
@@ -125,7 +291,7 @@ func (h *URLHandler) DeleteURL(c *gin.Context) {
 		return
 	}
 
-	if err := h.urlService.DeleteURL(shortCode); err != nil {
+	if err := h.urlService.DeleteURL(c.Request.Context(), shortCode); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "delete_failed",
 			Message: err.Error(),
@@ -139,16 +305,88 @@ func (h *URLHandler) DeleteURL(c *gin.Context) {
 	})
 }
 
-// HealthCheck kiểm tra trạng thái server
-// GET /health
-func (h *URLHandler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"service": "url-shortener",
+// ListTrash liệt kê các link đã xóa
+// GET /api/trash?limit=&cursor=
+func (h *URLHandler) ListTrash(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	response, err := h.urlService.ListTrash(c.Request.Context(), limit, c.Query("cursor"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "invalid_request",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "list_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RestoreURL khôi phục link từ thùng rác
+// POST /api/trash/:shortCode/restore
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	response, err := h.urlService.RestoreURL(c.Request.Context(), c.Param("shortCode"))
+	if err != nil {
+		if errors.Is(err, services.ErrNotInTrash) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "restore_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PurgeURL xóa vĩnh viễn link trong thùng rác cùng analytics
+// DELETE /api/trash/:shortCode
+func (h *URLHandler) PurgeURL(c *gin.Context) {
+	if err := h.urlService.PurgeURL(c.Request.Context(), c.Param("shortCode")); err != nil {
+		if errors.Is(err, services.ErrNotInTrash) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "not_found",
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "purge_failed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Success: true,
+		Message: "URL purged permanently",
 	})
 }
 
-// isValidURL kiểm tra URL có hợp lệ không
-func isValidURL(url string) bool {
-	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+// maxActorLength là độ dài tối đa (ký tự) của cột url_revisions.changed_by
+const maxActorLength = 255
+
+// actorFromRequest xác định người thực hiện thay đổi để ghi vào lịch sử
+// Lấy từ header X-Actor (do gateway/dashboard gắn), mặc định là IP của client.
+// Header dài hơn cột changed_by bị cắt để update không lỗi sau khi đã qua validation
+func actorFromRequest(c *gin.Context) string {
+	if actor := strings.TrimSpace(c.GetHeader("X-Actor")); actor != "" {
+		if runes := []rune(actor); len(runes) > maxActorLength {
+			actor = string(runes[:maxActorLength])
+		}
+		return actor
+	}
+	return "ip:" + c.ClientIP()
 }
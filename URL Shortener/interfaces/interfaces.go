@@ -1,61 +1,212 @@
 package interfaces
 
 import (
+	"context"
+	"time"
+
 	"url-shortener/models"
 )
 
 // URLRepository định nghĩa các phương thức làm việc với database
 type URLRepository interface {
 	// Create tạo mới một URL record
-	Create(url *models.URL) error
+	Create(ctx context.Context, url *models.URL) error
 
 	// FindByShortCode tìm URL theo short code
-	FindByShortCode(shortCode string) (*models.URL, error)
+	FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
 
 	// FindByOriginalURL tìm URL theo original URL
-	FindByOriginalURL(originalURL string) (*models.URL, error)
+	FindByOriginalURL(ctx context.Context, originalURL string) (*models.URL, error)
 
 	// IncrementClickCount tăng số lượt click
-	IncrementClickCount(shortCode string) error
+	IncrementClickCount(ctx context.Context, shortCode string) error
+
+	// Update khóa URL chưa xóa theo short code trong một transaction, gọi change để sửa các trường
+	// có thể thay đổi (original_url, expires_at) rồi lưu cùng bản ghi lịch sử change trả về.
+	// saved được gọi với dòng đã lưu trước khi commit, lúc vẫn giữ khóa, nên các update đồng thời
+	// chạy saved theo đúng thứ tự commit; change hoặc saved trả về lỗi thì transaction bị rollback
+	Update(ctx context.Context, shortCode string, change func(url *models.URL) (*models.URLRevision, error), saved func(url *models.URL) error) (*models.URL, error)
+
+	// ListRevisions lấy lịch sử thay đổi của URL, mới nhất trước
+	ListRevisions(ctx context.Context, urlID uint) ([]models.URLRevision, error)
+
+	// FindRevision tìm một phiên bản cũ của URL
+	FindRevision(ctx context.Context, urlID uint, revisionID uint) (*models.URLRevision, error)
 
 	// Delete xóa URL
-	Delete(shortCode string) error
+	Delete(ctx context.Context, shortCode string) error
+
+	// ExistsShortCode kiểm tra short code đã tồn tại chưa (kể cả link đã xóa)
+	ExistsShortCode(ctx context.Context, shortCode string) (bool, error)
+
+	// FindDeletedByShortCode tìm link đã bị soft delete theo short code
+	FindDeletedByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
+
+	// ListDeleted liệt kê link đã bị soft delete, mới xóa trước
+	ListDeleted(ctx context.Context, limit int, beforeID uint) ([]models.URL, error)
+
+	// Restore khôi phục link đã bị soft delete
+	Restore(ctx context.Context, shortCode string) error
 
-	// ExistsShortCode kiểm tra short code đã tồn tại chưa
-	ExistsShortCode(shortCode string) (bool, error)
+	// Purge xóa vĩnh viễn link đã bị soft delete cùng click events và lịch sử,
+	// archiveAnalytics = true thì chép click events sang bảng archive trước khi xóa
+	Purge(ctx context.Context, shortCode string, archiveAnalytics bool) error
+
+	// FindExpired tìm link chưa xóa đã hết hạn trước thời điểm before
+	FindExpired(ctx context.Context, before time.Time, limit int) ([]models.URL, error)
+
+	// DeleteExpired soft delete các link trong ids vẫn còn hết hạn trước thời điểm before,
+	// trả về các link đã thực sự bị xóa (link vừa được gia hạn được bỏ qua)
+	DeleteExpired(ctx context.Context, ids []uint, before time.Time) ([]models.URL, error)
+
+	// FindPurgeable tìm link đã soft delete trước thời điểm deletedBefore
+	FindPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]models.URL, error)
 
 	// GetStats lấy thống kê của URL
-	GetStats(shortCode string) (*models.URLStatsResponse, error)
+	GetStats(ctx context.Context, shortCode string) (*models.URLStatsResponse, error)
+
+	// List liệt kê URL theo điều kiện lọc, sắp xếp và keyset cursor
+	List(ctx context.Context, query *models.URLListQuery) ([]models.URL, error)
 }
 
 // CacheRepository định nghĩa các phương thức làm việc với cache
 type CacheRepository interface {
-	// Set lưu URL vào cache
-	Set(shortCode string, originalURL string) error
+	// Set lưu URL vào cache (ghi đè giá trị cũ), TTL không vượt quá thời điểm hết hạn của link
+	Set(ctx context.Context, shortCode string, entry *models.CachedURL) error
 
-	// Get lấy original URL từ cache
-	Get(shortCode string) (string, error)
+	// SetIfAbsent chỉ lưu URL nếu cache chưa có, trả về true nếu đã lưu
+	SetIfAbsent(ctx context.Context, shortCode string, entry *models.CachedURL) (bool, error)
+
+	// SetManyIfAbsent lưu nhiều URL trong một round trip (chỉ key chưa có), trả về số key đã lưu
+	SetManyIfAbsent(ctx context.Context, entries map[string]*models.CachedURL) (int, error)
+
+	// Get lấy URL từ cache
+	Get(ctx context.Context, shortCode string) (*models.CachedURL, error)
 
 	// Delete xóa URL khỏi cache
-	Delete(shortCode string) error
+	Delete(ctx context.Context, shortCode string) error
 
 	// Exists kiểm tra URL có trong cache không
-	Exists(shortCode string) (bool, error)
+	Exists(ctx context.Context, shortCode string) (bool, error)
+}
+
+// CacheInvalidationBus phát và nhận thông báo xóa cache local giữa các replica
+type CacheInvalidationBus interface {
+	// Publish báo cho các replica khác xóa short code khỏi cache local
+	Publish(ctx context.Context, shortCode string) error
+
+	// Subscribe gọi handler mỗi khi replica khác báo xóa một short code
+	Subscribe(handler func(shortCode string)) error
+
+	// Close dừng nhận thông báo
+	Close() error
+}
+
+// CacheClearer xóa toàn bộ URL khỏi cache, dùng khi không còn biết được key nào đã cũ
+type CacheClearer interface {
+	Clear(ctx context.Context) (int64, error)
+}
+
+// CacheStats cung cấp thống kê hit/miss của cache
+type CacheStats interface {
+	GetStats() map[string]interface{}
+}
+
+// HealthChecker báo trạng thái của một dependency cho /health
+type HealthChecker interface {
+	// Healthy trả về false khi dependency không dùng được và service chạy ở chế độ degraded
+	Healthy() bool
 }
 
 // AnalyticsRepository định nghĩa các phương thức cho analytics
 type AnalyticsRepository interface {
 	// SaveClickEvent lưu sự kiện click
-	SaveClickEvent(event *models.ClickEvent) error
+	SaveClickEvent(ctx context.Context, event *models.ClickEvent) error
+
+	// SaveClickBatch ghi nhiều click events bằng một lệnh INSERT, tăng click_count của mỗi
+	// short code bằng một lệnh UPDATE và cộng vào các bảng rollup, tất cả trong một transaction
+	SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error
+
+	// SaveDeadLetter lưu click event không ghi được kèm lý do để xem xét và ghi lại sau
+	SaveDeadLetter(ctx context.Context, event *models.ClickEvent, reason string) error
 
-	// GetClicksByDate lấy số lượt click theo ngày
-	GetClicksByDate(shortCode string, days int) (map[string]int64, error)
+	// GetClicksByDate lấy số lượt click theo ngày (UTC), includeBots = false thì bỏ click từ bot
+	GetClicksByDate(ctx context.Context, shortCode string, days int, includeBots bool) (map[string]int64, error)
+
+	// GetClicksByHour lấy số lượt click theo giờ (UTC) trong hours giờ gần nhất
+	GetClicksByHour(ctx context.Context, shortCode string, hours int, includeBots bool) (map[string]int64, error)
 
 	// GetTopReferers lấy top referers
-	GetTopReferers(shortCode string, limit int) ([]models.RefererStats, error)
+	GetTopReferers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.RefererStats, error)
 
 	// GetTopCountries lấy top countries
-	GetTopCountries(shortCode string, limit int) ([]models.CountryStats, error)
+	GetTopCountries(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.CountryStats, error)
+
+	// GetTopDevices lấy phân bố theo loại thiết bị (mobile, desktop, tablet...)
+	GetTopDevices(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.DeviceStats, error)
+
+	// GetTopBrowsers lấy top trình duyệt
+	GetTopBrowsers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.BrowserStats, error)
+
+	// GetTopOS lấy top hệ điều hành
+	GetTopOS(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.OSStats, error)
+
+	// CountBotClicks đếm số click từ bot của short code
+	CountBotClicks(ctx context.Context, shortCode string) (int64, error)
+}
+
+// ClickQueue là hàng đợi click events giữa request và worker ghi database
+type ClickQueue interface {
+	// Push thêm event vào queue (non-blocking), trả về lỗi khi queue đầy hoặc đã đóng
+	Push(event *models.ClickEvent) error
+
+	// Pop đọc tối đa max events, chờ tối đa wait để gom đủ batch (wait <= 0: không chờ)
+	// Trả về batch rỗng khi hết thời gian chờ mà chưa có event
+	Pop(ctx context.Context, max int, wait time.Duration) (*models.ClickBatch, error)
+
+	// Ack xác nhận batch đã được ghi vào database
+	Ack(batch *models.ClickBatch) error
+
+	// Renew giữ quyền xử lý batch chưa Ack trong lúc worker đang thử ghi lại,
+	// để consumer khác không nhận lại batch vì tưởng worker đã chết
+	Renew(batch *models.ClickBatch) error
+
+	// Len trả về số events chưa được Ack
+	Len() int
+
+	// GetStats trả về thống kê của queue
+	GetStats() map[string]interface{}
+
+	// Close đóng queue, trả về lỗi nếu events còn lại trong queue bị mất
+	Close() error
+}
+
+// BotClassifier phân loại click từ bot, crawler và link preview
+type BotClassifier interface {
+	// Classify trả về nhóm bot của click, chuỗi rỗng nếu là người dùng thật
+	Classify(click *models.ClickRequest) string
+}
+
+// GeoIPResolver tra cứu vị trí địa lý của IP
+type GeoIPResolver interface {
+	// Lookup trả về vị trí của IP, false nếu không xác định được
+	Lookup(ipAddress string) (*models.GeoLocation, bool)
+
+	// GetStats trả về thông tin database và số lần tra cứu
+	GetStats() map[string]interface{}
+}
+
+// UniqueVisitorCounter ước lượng số người xem duy nhất của link bằng HyperLogLog
+// Người xem được nhận diện bằng hash có salt của IP + User-Agent
+type UniqueVisitorCounter interface {
+	// Add ghi nhận người xem của các click, click từ bot bị bỏ qua
+	Add(ctx context.Context, events []*models.ClickEvent) error
+
+	// Count trả về số người xem duy nhất từ trước tới nay và theo từng ngày (YYYY-MM-DD)
+	Count(ctx context.Context, urlID uint, dates []string) (int64, map[string]int64, error)
+
+	// GetStats trả về trạng thái của bộ đếm
+	GetStats() map[string]interface{}
 }
 
 // ShortCodeGenerator định nghĩa interface cho việc sinh short code
@@ -73,17 +224,41 @@ type ShortCodeGenerator interface {
 // URLService định nghĩa các phương thức business logic
 type URLService interface {
 	// CreateShortURL tạo short URL mới
-	CreateShortURL(req *models.CreateURLRequest) (*models.CreateURLResponse, error)
+	CreateShortURL(ctx context.Context, req *models.CreateURLRequest) (*models.CreateURLResponse, error)
 
 	// GetOriginalURL lấy original URL từ short code
-	GetOriginalURL(shortCode string) (string, error)
+	GetOriginalURL(ctx context.Context, shortCode string) (string, error)
 
-	// GetStats lấy thống kê của URL
-	GetStats(shortCode string) (*models.URLStatsResponse, error)
+	// ResolveURL lấy destination và id của link cho redirect
+	ResolveURL(ctx context.Context, shortCode string) (*models.CachedURL, error)
+
+	// GetStats lấy thống kê của URL, includeBots = true thì tính cả click từ bot
+	GetStats(ctx context.Context, shortCode string, includeBots bool) (*models.URLStatsResponse, error)
+
+	// UpdateURL thay đổi destination và các thiết lập của URL
+	UpdateURL(ctx context.Context, shortCode string, req *models.UpdateURLRequest, actor string) (*models.URLResponse, error)
+
+	// ListRevisions lấy lịch sử thay đổi của URL
+	ListRevisions(ctx context.Context, shortCode string) ([]models.URLRevisionResponse, error)
+
+	// RestoreRevision đưa URL về một phiên bản cũ
+	RestoreRevision(ctx context.Context, shortCode string, revisionID uint, actor string) (*models.URLResponse, error)
+
+	// ListURLs liệt kê, tìm kiếm và phân trang URL
+	ListURLs(ctx context.Context, req *models.ListURLsRequest) (*models.ListURLsResponse, error)
+
+	// DeleteURL xóa URL (chuyển vào thùng rác)
+	DeleteURL(ctx context.Context, shortCode string) error
+
+	// ListTrash liệt kê các link trong thùng rác
+	ListTrash(ctx context.Context, limit int, cursor string) (*models.ListTrashResponse, error)
+
+	// RestoreURL khôi phục link từ thùng rác
+	RestoreURL(ctx context.Context, shortCode string) (*models.URLResponse, error)
 
-	// DeleteURL xóa URL
-	DeleteURL(shortCode string) error
+	// PurgeURL xóa vĩnh viễn link trong thùng rác
+	PurgeURL(ctx context.Context, shortCode string) error
 
-	// RecordClick ghi nhận click event (bất đồng bộ)
-	RecordClick(shortCode string, ipAddress, userAgent, referer string)
+	// RecordClick phân loại bot và ghi nhận click event (bất đồng bộ)
+	RecordClick(click *models.ClickRequest)
 }
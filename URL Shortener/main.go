@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"url-shortener/analytics"
 	"url-shortener/config"
 	"url-shortener/database"
 	"url-shortener/handlers"
-	"url-shortener/models"
+	"url-shortener/interfaces"
+	"url-shortener/migrations"
 	"url-shortener/repository"
 	"url-shortener/routes"
 	"url-shortener/services"
@@ -28,57 +33,194 @@ func main() {
 	}
 	log.Println("✅ Configuration loaded")
 
-	// Connect to PostgreSQL
-	postgresDB, err := database.NewPostgresDB(cfg.Database)
-	if err != nil {
-		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	// Subcommand: url-shortener migrate up|down [N]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
 	}
-	defer postgresDB.Close()
 
-	// Auto migrate database schemas
-	if err := postgresDB.AutoMigrate(&models.URL{}, &models.ClickEvent{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	// Subcommand: url-shortener rollup backfill [AFTER_ID]
+	if len(os.Args) > 1 && os.Args[1] == "rollup" {
+		if err := runRollupCommand(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("Rollup backfill failed: %v", err)
+		}
+		return
 	}
-	log.Println("✅ Database migrated")
 
-	// Connect to Redis
-	redisClient, err := database.NewRedisClient(cfg.Redis)
-	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+	// Initialize repositories
+	var (
+		urlRepo       interfaces.URLRepository
+		analyticsRepo interfaces.AnalyticsRepository
+		cacheRepo     interfaces.CacheRepository
+		cacheStats    interfaces.CacheStats
+		redisCache    *repository.ResilientCacheRepository // nil khi dùng cache in-memory
+		healthChecks  = make(map[string]interfaces.HealthChecker)
+	)
+
+	switch cfg.Database.Driver {
+	case "memory":
+		memoryURLRepo := repository.NewMemoryURLRepository()
+		urlRepo = memoryURLRepo
+		analyticsRepo = repository.NewMemoryAnalyticsRepository(memoryURLRepo)
+		log.Println("⚠️ Using in-memory storage, data will be lost on restart")
+	default:
+		// Connect to PostgreSQL hoặc SQLite
+		sqlDB, err := database.NewSQLDatabase(cfg.Database)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer sqlDB.Close()
+
+		// Chạy các migration còn thiếu (advisory lock đảm bảo chỉ một replica migrate)
+		if cfg.Database.AutoMigrate {
+			migrator, err := migrations.NewMigrator(sqlDB.Gorm())
+			if err != nil {
+				log.Fatalf("Failed to load migrations: %v", err)
+			}
+			if _, err := migrator.Up(); err != nil {
+				log.Fatalf("Failed to migrate database: %v", err)
+			}
+			log.Println("✅ Database migrated")
+		}
+
+		urlRepo = repository.NewURLRepository(sqlDB.Gorm(), cfg.Database.QueryTimeout)
+		analyticsRepo = repository.NewAnalyticsRepository(sqlDB.Gorm(), cfg.Database.QueryTimeout)
 	}
-	defer redisClient.Close()
 
-	// Initialize repositories
-	urlRepo := repository.NewURLRepository(postgresDB.DB)
-	cacheRepo := repository.NewCacheRepository(redisClient)
-	analyticsRepo := repository.NewAnalyticsRepository(postgresDB.DB)
+	// Redis dùng chung cho cache và click queue (khi ANALYTICS_QUEUE=redis)
+	var redisClient *database.RedisClient
+	if cfg.Cache.Driver != "memory" || cfg.Analytics.Queue == "redis" {
+		redisClient = database.ConnectRedis(cfg.Redis)
+		defer redisClient.Close()
+	}
+
+	switch cfg.Cache.Driver {
+	case "memory":
+		cacheRepo = repository.NewMemoryCacheRepository()
+		log.Println("⚠️ Using in-memory cache")
+	default:
+		// Redis là tùy chọn: không kết nối được thì vẫn khởi động ở chế độ degraded,
+		// circuit breaker bỏ qua cache và tự kết nối lại khi Redis sống lại
+		resilientCache := repository.NewResilientCacheRepository(
+			repository.NewCacheRepository(redisClient, cfg.Redis.Timeout),
+			redisClient.Ping,
+			cfg.Cache.BreakerThreshold,
+			cfg.Cache.BreakerRetryInterval,
+		)
+		if err := redisClient.Ping(context.Background()); err != nil {
+			resilientCache.Trip(err)
+		} else {
+			log.Println("✅ Connected to Redis successfully")
+		}
+		resilientCache.Start()
+		defer resilientCache.Stop()
+
+		cacheRepo = resilientCache
+		cacheStats = resilientCache
+		redisCache = resilientCache
+		healthChecks["redis"] = resilientCache
+
+		// LRU trong process trước Redis, đồng bộ xóa giữa các replica qua pub/sub
+		if cfg.Cache.LocalSize > 0 {
+			bus := repository.NewRedisInvalidationBus(redisClient)
+			tieredCache := repository.NewTieredCacheRepository(cacheRepo, bus, cfg.Cache.LocalSize, cfg.Cache.LocalTTL)
+			if err := tieredCache.StartInvalidationListener(); err != nil {
+				log.Fatalf("Failed to subscribe to cache invalidations: %v", err)
+			}
+			defer tieredCache.Close()
+
+			cacheRepo = tieredCache
+			cacheStats = tieredCache
+			log.Printf("✅ Local cache enabled (size: %d, ttl: %v)", cfg.Cache.LocalSize, cfg.Cache.LocalTTL)
+		}
+	}
+
+	// Queue chứa click events chờ ghi: in-memory, spool trên đĩa (không mất khi restart/database lỗi)
+	// hoặc Redis Stream dùng chung giữa các replica
+	var clickQueue interfaces.ClickQueue
+	switch cfg.Analytics.Queue {
+	case "redis":
+		clickQueue = repository.NewRedisStreamClickQueue(redisClient, cfg.Analytics, cfg.Cache.BreakerRetryInterval)
+	case "spool":
+		spool, err := repository.NewSpoolClickQueue(cfg.Analytics)
+		if err != nil {
+			log.Fatalf("Failed to open click spool: %v", err)
+		}
+		clickQueue = spool
+	default:
+		clickQueue = repository.NewMemoryClickQueue(cfg.Analytics.QueueSize)
+	}
+
+	// Tra vị trí của click từ file MMDB cục bộ (đóng sau khi worker đã drain xong)
+	var geoIP interfaces.GeoIPResolver
+	if cfg.Analytics.GeoIPDatabase != "" {
+		resolver := analytics.NewGeoIPResolver(cfg.Analytics.GeoIPDatabase, cfg.Analytics.GeoIPCheckInterval)
+		defer resolver.Close()
+		geoIP = resolver
+	}
+
+	// Đếm người xem duy nhất bằng HyperLogLog: Redis nếu có (dùng chung giữa các replica),
+	// Redis lỗi thì tạm đếm trong process
+	if cfg.Analytics.VisitorSalt == "" {
+		log.Println("⚠️ ANALYTICS_VISITOR_SALT is empty, visitor hashes are unsalted")
+	}
+	var visitorCounter interfaces.UniqueVisitorCounter = repository.NewMemoryVisitorCounter(cfg.Analytics.VisitorSalt)
+	if redisClient != nil {
+		visitorCounter = repository.NewResilientVisitorCounter(
+			repository.NewRedisVisitorCounter(redisClient, cfg.Analytics.VisitorSalt, cfg.Redis.Timeout),
+			repository.NewMemoryVisitorCounter(cfg.Analytics.VisitorSalt),
+			cfg.Cache.BreakerRetryInterval,
+		)
+	}
 
 	// Initialize click analytics worker (Goroutines & Channels)
-	// 4 workers, buffer size 10000 events
-	clickWorker := workers.NewClickAnalyticsWorker(urlRepo, analyticsRepo, 4, 10000)
+	clickWorker := workers.NewClickAnalyticsWorker(analyticsRepo, clickQueue, geoIP, visitorCounter, cfg.Analytics.Workers)
 	clickWorker.Start()
-	defer clickWorker.Stop()
+	defer func() {
+		// Ghi nốt các click còn trong queue trước khi đóng database
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Analytics.DrainTimeout)
+		defer cancel()
+		if err := clickWorker.Shutdown(ctx); err != nil {
+			log.Printf("⚠️ %v", err)
+		}
+	}()
+
+	// Initialize janitor dọn dẹp link hết hạn
+	janitor := workers.NewExpiredLinkJanitor(urlRepo, cacheRepo, cfg)
+	if cfg.Janitor.Enabled {
+		janitor.Start()
+		defer janitor.Stop()
+	}
+
+	// Nạp sẵn link nóng vào cache khi khởi động và mỗi khi Redis kết nối lại
+	cacheWarmer := workers.NewCacheWarmer(urlRepo, cacheRepo)
+	if cfg.Cache.WarmUpSize > 0 {
+		warmUp := func() {
+			if _, err := cacheWarmer.WarmUp(context.Background(), cfg.Cache.WarmUpSize); err != nil {
+				log.Printf("Warning: cache warm-up failed: %v", err)
+			}
+		}
+		if redisCache != nil {
+			redisCache.OnRecover(warmUp)
+		}
+		go warmUp()
+	}
 
 	// Initialize services
-	urlService := services.NewURLService(urlRepo, cacheRepo, analyticsRepo, cfg, clickWorker)
+	botClassifier := analytics.NewBotClassifier(cfg.Analytics.BotBurstLimit, cfg.Analytics.BotBurstWindow)
+	urlService := services.NewURLService(urlRepo, cacheRepo, analyticsRepo, cfg, clickWorker, botClassifier, visitorCounter)
 
 	// Initialize handlers
 	urlHandler := handlers.NewURLHandler(urlService)
+	adminHandler := handlers.NewAdminHandler(janitor, cacheWarmer, clickWorker, cacheStats, cfg.Cache.WarmUpSize)
+	healthHandler := handlers.NewHealthHandler(healthChecks)
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
-	routes.SetupRoutes(router, urlHandler)
-
-	// Graceful shutdown
-	go func() {
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-		<-quit
-		log.Println("🛑 Shutting down server...")
-		clickWorker.Stop()
-		os.Exit(0)
-	}()
+	routes.SetupRoutes(router, urlHandler, adminHandler, healthHandler)
 
 	// Start server
 	addr := ":" + cfg.Server.Port
@@ -87,9 +229,56 @@ func main() {
 	log.Printf("   POST /api/shorten     - Create short URL")
 	log.Printf("   GET  /:shortCode      - Redirect to original URL")
 	log.Printf("   GET  /api/stats/:code - Get URL statistics")
-	log.Printf("   DELETE /api/urls/:code - Delete URL")
+	log.Printf("   GET  /api/urls        - List and search URLs")
+	log.Printf("   PATCH /api/urls/:code - Update URL")
+	log.Printf("   GET  /api/urls/:code/revisions - URL revision history")
+	log.Printf("   DELETE /api/urls/:code - Move URL to trash")
+	log.Printf("   GET  /api/trash       - List deleted URLs")
+	log.Printf("   POST /api/admin/janitor/run - Run expired link janitor")
+	log.Printf("   POST /api/admin/cache/warmup - Preload top links into cache")
+	log.Printf("   GET  /api/admin/analytics - Click queue and worker stats")
+
+	server := &http.Server{
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
 
-	if err := router.Run(addr); err != nil {
+	// Mở port trước để lỗi (ví dụ port đã bị chiếm) dừng chương trình ngay khi khởi động
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+
+	// Graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		log.Printf("❌ Server stopped unexpectedly: %v", err)
+	}
+	// Tín hiệu thứ hai dừng process ngay, không chờ drain
+	stop()
+
+	log.Printf("🛑 Shutting down server (drain timeout: %v)...", cfg.Server.ShutdownTimeout)
+
+	// 1. Ngừng nhận kết nối mới và chờ các request đang chạy hoàn thành
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️ Requests still running after %v, closing connections: %v", cfg.Server.ShutdownTimeout, err)
+		server.Close()
+	}
+	log.Println("✅ HTTP server stopped")
+
+	// 2. Các defer chạy theo thứ tự ngược lúc khởi tạo: janitor, click worker (xử lý nốt queue
+	// trong ANALYTICS_DRAIN_TIMEOUT), cache local, circuit breaker, Redis rồi mới tới database
 }
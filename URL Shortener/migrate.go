@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/migrations"
+)
+
+// runMigrateCommand xử lý subcommand: url-shortener migrate up|down [N]|status
+func runMigrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: url-shortener migrate up|down [N]|status")
+	}
+
+	if cfg.Database.Driver == "memory" {
+		return errors.New("migrations are not needed for the memory driver")
+	}
+
+	sqlDB, err := database.NewSQLDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	migrator, err := migrations.NewMigrator(sqlDB.Gorm())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ %d migration(s) applied", len(applied))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ %d migration(s) rolled back", len(rolledBack))
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+
+	return nil
+}
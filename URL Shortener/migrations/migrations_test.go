@@ -0,0 +1,141 @@
+package migrations
+
+import (
+	"testing"
+
+	"url-shortener/config"
+	"url-shortener/database"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB mở SQLite in-memory chưa có schema
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	sqliteDB, err := database.NewSQLiteDB(config.DatabaseConfig{Driver: "sqlite", SQLitePath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB returned error: %v", err)
+	}
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	return sqliteDB.Gorm()
+}
+
+// TestLoad tests every dialect has ordered, paired migrations
+func TestLoad(t *testing.T) {
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatalf("load(%s) returned error: %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("load(%s) returned no migrations", dialect)
+		}
+		for i := 1; i < len(migrations); i++ {
+			if migrations[i].Version <= migrations[i-1].Version {
+				t.Errorf("%s migrations not ordered: %d after %d", dialect, migrations[i].Version, migrations[i-1].Version)
+			}
+		}
+	}
+
+	postgres, _ := load("postgres")
+	sqlite, _ := load("sqlite")
+	if len(postgres) != len(sqlite) {
+		t.Errorf("postgres has %d migrations, sqlite has %d", len(postgres), len(sqlite))
+	}
+}
+
+// TestMigrator_UpDownStatus tests applying and rolling back migrations
+func TestMigrator_UpDownStatus(t *testing.T) {
+	db := newTestDB(t)
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	if len(applied) != total {
+		t.Errorf("Up applied %d migrations, want %d", len(applied), total)
+	}
+	if !db.Migrator().HasTable("urls") || !db.Migrator().HasTable("click_events") {
+		t.Fatalf("Expected urls and click_events tables after Up")
+	}
+
+	// Chạy lại không áp dụng gì thêm
+	applied, err = migrator.Up()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Second Up = (%d, %v), want (0, nil)", len(applied), err)
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt == nil {
+			t.Errorf("Migration %04d_%s should be applied", status.Version, status.Name)
+		}
+	}
+
+	rolledBack, err := migrator.Down(total)
+	if err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	if len(rolledBack) != total {
+		t.Errorf("Down rolled back %d migrations, want %d", len(rolledBack), total)
+	}
+	if db.Migrator().HasTable("urls") {
+		t.Errorf("Expected urls table to be dropped after Down")
+	}
+
+	statuses, _ = migrator.Status()
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("Migration %04d_%s should be pending after Down", status.Version, status.Name)
+		}
+	}
+}
+
+// TestMigrator_BackfillRollups tests upgrading to the rollup tables fills them from existing click events
+func TestMigrator_BackfillRollups(t *testing.T) {
+	db := newTestDB(t)
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+
+	// Giả lập database trước migration 0011: click events có sẵn nhưng rollup trống
+	if _, err := migrator.Down(1); err != nil {
+		t.Fatalf("Down returned error: %v", err)
+	}
+	db.Exec("INSERT INTO urls (id, short_code, original_url) VALUES (1, 'abc123', 'https://example.com')")
+	for _, at := range []string{"2024-03-01 10:15:00", "2024-03-01 10:45:00", "2024-03-02 08:00:00"} {
+		err := db.Exec(`INSERT INTO click_events (url_id, short_code, referer, device_type, is_bot, created_at)
+VALUES (1, 'abc123', 'https://news.example', 'mobile', false, ?)`, at).Error
+		if err != nil {
+			t.Fatalf("Failed to insert click event: %v", err)
+		}
+	}
+
+	if applied, err := migrator.Up(); err != nil || len(applied) != 1 {
+		t.Fatalf("Up = (%d, %v), want the backfill migration applied", len(applied), err)
+	}
+
+	var hourly, daily, referers int64
+	db.Raw("SELECT clicks FROM click_rollups_hourly WHERE url_id = 1 AND hour = '2024-03-01 10:00'").Scan(&hourly)
+	db.Raw("SELECT clicks FROM click_rollups_daily WHERE url_id = 1 AND day = '2024-03-01'").Scan(&daily)
+	db.Raw("SELECT SUM(clicks) FROM click_dimension_rollups WHERE url_id = 1 AND dimension = 'referer'").Scan(&referers)
+	if hourly != 2 || daily != 2 || referers != 3 {
+		t.Errorf("Rollups after upgrade = (hourly %d, daily %d, referer %d), want (2, 2, 3)", hourly, daily, referers)
+	}
+}
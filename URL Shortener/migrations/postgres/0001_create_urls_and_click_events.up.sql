@@ -0,0 +1,31 @@
+-- Schema ban đầu, tương đương AutoMigrate(&models.URL{}, &models.ClickEvent{})
+-- Dùng IF NOT EXISTS để database đã được AutoMigrate trước đây nhận migration này như baseline
+CREATE TABLE IF NOT EXISTS urls (
+    id           BIGSERIAL PRIMARY KEY,
+    short_code   VARCHAR(10) NOT NULL,
+    original_url TEXT NOT NULL,
+    click_count  BIGINT DEFAULT 0,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    expires_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_short_code ON urls (short_code);
+CREATE INDEX IF NOT EXISTS idx_urls_deleted_at ON urls (deleted_at);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id         BIGSERIAL PRIMARY KEY,
+    url_id     BIGINT NOT NULL,
+    short_code VARCHAR(10) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    referer    TEXT,
+    country    VARCHAR(100),
+    city       VARCHAR(100),
+    created_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id ON click_events (url_id);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_created_at ON click_events (created_at);
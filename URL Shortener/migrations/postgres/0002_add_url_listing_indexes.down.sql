@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_urls_short_code_trgm;
+DROP INDEX IF EXISTS idx_urls_original_url_trgm;
+DROP INDEX IF EXISTS idx_urls_expires_at;
+DROP INDEX IF EXISTS idx_urls_click_count_id;
+DROP INDEX IF EXISTS idx_urls_created_at_id;
+ALTER TABLE urls DROP COLUMN IF EXISTS is_custom;
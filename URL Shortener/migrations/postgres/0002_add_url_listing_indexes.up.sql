@@ -0,0 +1,12 @@
+-- Đánh dấu link dùng custom code để lọc trong GET /api/urls
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS is_custom BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Index cho keyset pagination (sort_column, id), chỉ trên các link chưa bị xóa
+CREATE INDEX IF NOT EXISTS idx_urls_created_at_id ON urls (created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_urls_click_count_id ON urls (click_count, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at) WHERE deleted_at IS NULL;
+
+-- Trigram index để tìm kiếm substring (ILIKE '%q%') trên original_url và short_code
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING gin (original_url gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_trgm ON urls USING gin (short_code gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_urls_deleted_at_id;
+DROP TABLE IF EXISTS click_events_archive;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS click_event_dead_letters;
@@ -0,0 +1 @@
+ALTER TABLE click_events DROP CONSTRAINT IF EXISTS fk_click_events_url;
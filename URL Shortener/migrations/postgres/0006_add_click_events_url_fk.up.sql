@@ -0,0 +1,21 @@
+-- Click events cũ được ghi với url_id = 0, lấy lại id từ short_code
+UPDATE click_events ce
+SET url_id = u.id
+FROM urls u
+WHERE ce.url_id = 0 AND u.short_code = ce.short_code;
+
+-- Click events không còn link tương ứng được chuyển sang archive để thêm được khóa ngoại
+INSERT INTO click_events_archive
+    (id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at, archived_at)
+SELECT id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at, NOW()
+FROM click_events ce
+WHERE NOT EXISTS (SELECT 1 FROM urls u WHERE u.id = ce.url_id)
+ON CONFLICT (id) DO NOTHING;
+
+DELETE FROM click_events ce
+WHERE NOT EXISTS (SELECT 1 FROM urls u WHERE u.id = ce.url_id);
+
+-- Purge link thì click events của link bị xóa theo
+ALTER TABLE click_events
+    ADD CONSTRAINT fk_click_events_url FOREIGN KEY (url_id)
+    REFERENCES urls (id) ON UPDATE CASCADE ON DELETE CASCADE;
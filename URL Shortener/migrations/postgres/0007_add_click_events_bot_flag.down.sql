@@ -0,0 +1,5 @@
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS bot_category;
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS is_bot;
+
+ALTER TABLE click_events DROP COLUMN IF EXISTS bot_category;
+ALTER TABLE click_events DROP COLUMN IF EXISTS is_bot;
@@ -0,0 +1,6 @@
+-- Đánh dấu click từ bot/crawler/link preview để thống kê bỏ qua theo mặc định
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS bot_category VARCHAR(32) NOT NULL DEFAULT '';
+
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS bot_category VARCHAR(32) NOT NULL DEFAULT '';
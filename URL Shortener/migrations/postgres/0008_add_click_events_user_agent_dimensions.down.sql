@@ -0,0 +1,11 @@
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS browser_version;
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS browser_family;
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS os_version;
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS os_family;
+ALTER TABLE click_events_archive DROP COLUMN IF EXISTS device_type;
+
+ALTER TABLE click_events DROP COLUMN IF EXISTS browser_version;
+ALTER TABLE click_events DROP COLUMN IF EXISTS browser_family;
+ALTER TABLE click_events DROP COLUMN IF EXISTS os_version;
+ALTER TABLE click_events DROP COLUMN IF EXISTS os_family;
+ALTER TABLE click_events DROP COLUMN IF EXISTS device_type;
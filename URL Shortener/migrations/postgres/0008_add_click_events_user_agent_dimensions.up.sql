@@ -0,0 +1,12 @@
+-- Thiết bị, hệ điều hành, trình duyệt phân tích từ user_agent khi click worker ghi
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS device_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS os_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS os_version VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS browser_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN IF NOT EXISTS browser_version VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS device_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS os_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS os_version VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS browser_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN IF NOT EXISTS browser_version VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,43 @@
+-- Tính rollup cho các click ghi trước migration 0010 để thống kê của link cũ không trống sau khi nâng cấp.
+-- Khóa click_events (SHARE) để replica khác không ghi click xen vào trong lúc tính lại;
+-- bảng lớn thì migration này chạy lâu, có thể thay bằng: url-shortener rollup backfill
+LOCK TABLE click_events IN SHARE MODE;
+
+DELETE FROM click_dimension_rollups;
+DELETE FROM click_rollups_daily;
+DELETE FROM click_rollups_hourly;
+
+INSERT INTO click_rollups_hourly (url_id, hour, is_bot, clicks)
+SELECT url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00'), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00'), is_bot;
+
+INSERT INTO click_rollups_daily (url_id, day, is_bot, clicks)
+SELECT url_id, SUBSTR(hour, 1, 10), is_bot, SUM(clicks)
+FROM click_rollups_hourly
+GROUP BY url_id, SUBSTR(hour, 1, 10), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'referer', TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(referer, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND referer <> ''
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(referer, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'country', TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(country, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND country <> ''
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(country, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'device', TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(device_type, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND device_type <> ''
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(device_type, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'browser', TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(browser_family, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND browser_family <> ''
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(browser_family, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'os', TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(os_family, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND os_family <> ''
+GROUP BY url_id, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), SUBSTR(os_family, 1, 255), is_bot;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS click_events;
+DROP TABLE IF EXISTS urls;
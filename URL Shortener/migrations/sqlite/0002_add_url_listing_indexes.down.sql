@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_urls_expires_at;
+DROP INDEX IF EXISTS idx_urls_click_count_id;
+DROP INDEX IF EXISTS idx_urls_created_at_id;
+ALTER TABLE urls DROP COLUMN is_custom;
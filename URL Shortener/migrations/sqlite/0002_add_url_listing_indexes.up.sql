@@ -0,0 +1,8 @@
+-- Đánh dấu link dùng custom code để lọc trong GET /api/urls
+ALTER TABLE urls ADD COLUMN is_custom NUMERIC NOT NULL DEFAULT 0;
+
+-- Index cho keyset pagination (sort_column, id), chỉ trên các link chưa bị xóa.
+-- SQLite không có trigram index nên tìm kiếm substring sẽ scan bảng
+CREATE INDEX IF NOT EXISTS idx_urls_created_at_id ON urls (created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_urls_click_count_id ON urls (click_count, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at) WHERE deleted_at IS NULL;
@@ -0,0 +1,13 @@
+-- Lịch sử các giá trị cũ của original_url/expires_at trước mỗi lần sửa
+CREATE TABLE IF NOT EXISTS url_revisions (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id       INTEGER NOT NULL REFERENCES urls (id) ON DELETE CASCADE,
+    short_code   VARCHAR(10) NOT NULL,
+    original_url TEXT NOT NULL,
+    expires_at   DATETIME,
+    action       VARCHAR(20) NOT NULL,
+    changed_by   VARCHAR(255) NOT NULL,
+    created_at   DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_revisions_url_id_id ON url_revisions (url_id, id);
@@ -0,0 +1,18 @@
+-- Click events của các link bị janitor purge (khi JANITOR_ARCHIVE_ANALYTICS=true)
+CREATE TABLE IF NOT EXISTS click_events_archive (
+    id          INTEGER PRIMARY KEY,
+    url_id      INTEGER NOT NULL,
+    short_code  VARCHAR(10) NOT NULL,
+    ip_address  VARCHAR(45),
+    user_agent  TEXT,
+    referer     TEXT,
+    country     VARCHAR(100),
+    city        VARCHAR(100),
+    created_at  DATETIME,
+    archived_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_archive_short_code ON click_events_archive (short_code);
+
+-- Janitor tìm link đã xóa đủ lâu để purge
+CREATE INDEX IF NOT EXISTS idx_urls_deleted_at_id ON urls (deleted_at, id) WHERE deleted_at IS NOT NULL;
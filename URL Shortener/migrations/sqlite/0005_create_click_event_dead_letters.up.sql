@@ -0,0 +1,10 @@
+-- Click events không ghi được vào click_events (vi phạm ràng buộc, dữ liệu không hợp lệ)
+CREATE TABLE IF NOT EXISTS click_event_dead_letters (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    short_code VARCHAR(255) NOT NULL,
+    payload    TEXT NOT NULL,
+    error      TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_event_dead_letters_created_at ON click_event_dead_letters (created_at);
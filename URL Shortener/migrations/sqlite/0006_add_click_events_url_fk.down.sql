@@ -0,0 +1,21 @@
+CREATE TABLE click_events_old (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id     INTEGER NOT NULL,
+    short_code VARCHAR(10) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    referer    TEXT,
+    country    VARCHAR(100),
+    city       VARCHAR(100),
+    created_at DATETIME
+);
+
+INSERT INTO click_events_old SELECT id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at
+FROM click_events;
+
+DROP TABLE click_events;
+ALTER TABLE click_events_old RENAME TO click_events;
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id ON click_events (url_id);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_created_at ON click_events (created_at);
@@ -0,0 +1,36 @@
+-- SQLite không thêm được khóa ngoại vào bảng có sẵn nên phải tạo lại bảng click_events.
+-- Click events cũ được ghi với url_id = 0, lấy lại id từ short_code
+UPDATE click_events
+SET url_id = (SELECT u.id FROM urls u WHERE u.short_code = click_events.short_code)
+WHERE url_id = 0 AND EXISTS (SELECT 1 FROM urls u WHERE u.short_code = click_events.short_code);
+
+-- Click events không còn link tương ứng được chuyển sang archive
+INSERT OR IGNORE INTO click_events_archive
+    (id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at, archived_at)
+SELECT id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at, CURRENT_TIMESTAMP
+FROM click_events
+WHERE url_id NOT IN (SELECT id FROM urls);
+
+CREATE TABLE click_events_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id     INTEGER NOT NULL REFERENCES urls (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    short_code VARCHAR(10) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    referer    TEXT,
+    country    VARCHAR(100),
+    city       VARCHAR(100),
+    created_at DATETIME
+);
+
+INSERT INTO click_events_new (id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at)
+SELECT id, url_id, short_code, ip_address, user_agent, referer, country, city, created_at
+FROM click_events
+WHERE url_id IN (SELECT id FROM urls);
+
+DROP TABLE click_events;
+ALTER TABLE click_events_new RENAME TO click_events;
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id ON click_events (url_id);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_code ON click_events (short_code);
+CREATE INDEX IF NOT EXISTS idx_click_events_created_at ON click_events (created_at);
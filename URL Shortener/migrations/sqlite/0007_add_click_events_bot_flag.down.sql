@@ -0,0 +1,5 @@
+ALTER TABLE click_events_archive DROP COLUMN bot_category;
+ALTER TABLE click_events_archive DROP COLUMN is_bot;
+
+ALTER TABLE click_events DROP COLUMN bot_category;
+ALTER TABLE click_events DROP COLUMN is_bot;
@@ -0,0 +1,6 @@
+-- Đánh dấu click từ bot/crawler/link preview để thống kê bỏ qua theo mặc định
+ALTER TABLE click_events ADD COLUMN is_bot NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE click_events ADD COLUMN bot_category VARCHAR(32) NOT NULL DEFAULT '';
+
+ALTER TABLE click_events_archive ADD COLUMN is_bot NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE click_events_archive ADD COLUMN bot_category VARCHAR(32) NOT NULL DEFAULT '';
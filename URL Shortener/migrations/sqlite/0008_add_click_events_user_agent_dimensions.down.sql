@@ -0,0 +1,11 @@
+ALTER TABLE click_events_archive DROP COLUMN browser_version;
+ALTER TABLE click_events_archive DROP COLUMN browser_family;
+ALTER TABLE click_events_archive DROP COLUMN os_version;
+ALTER TABLE click_events_archive DROP COLUMN os_family;
+ALTER TABLE click_events_archive DROP COLUMN device_type;
+
+ALTER TABLE click_events DROP COLUMN browser_version;
+ALTER TABLE click_events DROP COLUMN browser_family;
+ALTER TABLE click_events DROP COLUMN os_version;
+ALTER TABLE click_events DROP COLUMN os_family;
+ALTER TABLE click_events DROP COLUMN device_type;
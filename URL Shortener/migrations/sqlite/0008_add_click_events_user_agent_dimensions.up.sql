@@ -0,0 +1,12 @@
+-- Thiết bị, hệ điều hành, trình duyệt phân tích từ user_agent khi click worker ghi
+ALTER TABLE click_events ADD COLUMN device_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN os_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN os_version VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN browser_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events ADD COLUMN browser_version VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE click_events_archive ADD COLUMN device_type VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN os_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN os_version VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN browser_family VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN browser_version VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE click_events_archive DROP COLUMN region;
+ALTER TABLE click_events DROP COLUMN region;
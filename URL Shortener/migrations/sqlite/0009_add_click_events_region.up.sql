@@ -0,0 +1,3 @@
+-- Tỉnh/bang của click, tra từ database GeoIP cùng country và city
+ALTER TABLE click_events ADD COLUMN region VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE click_events_archive ADD COLUMN region VARCHAR(100) NOT NULL DEFAULT '';
@@ -0,0 +1,29 @@
+-- Số click cộng dồn theo giờ/ngày (UTC) và theo chiều thống kê của mỗi link,
+-- click worker cập nhật trong cùng transaction ghi click events.
+-- Dữ liệu cũ được tính lại bằng: url-shortener rollup backfill
+CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    hour   VARCHAR(16) NOT NULL, -- YYYY-MM-DD HH:00
+    is_bot NUMERIC NOT NULL,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, hour, is_bot)
+);
+
+CREATE TABLE IF NOT EXISTS click_rollups_daily (
+    url_id INTEGER NOT NULL REFERENCES urls (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    day    VARCHAR(10) NOT NULL, -- YYYY-MM-DD
+    is_bot NUMERIC NOT NULL,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day, is_bot)
+);
+
+-- dimension: referer, country, device, browser, os
+CREATE TABLE IF NOT EXISTS click_dimension_rollups (
+    url_id    INTEGER NOT NULL REFERENCES urls (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    dimension VARCHAR(16) NOT NULL,
+    day       VARCHAR(10) NOT NULL,
+    value     VARCHAR(255) NOT NULL,
+    is_bot    NUMERIC NOT NULL,
+    clicks    INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, dimension, day, value, is_bot)
+);
@@ -0,0 +1,3 @@
+-- Rollup đã tính lại vẫn khớp với click_events nên không có gì để rollback,
+-- bảng rollup bị xóa khi rollback 0010
+SELECT 1;
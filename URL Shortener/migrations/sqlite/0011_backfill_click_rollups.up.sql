@@ -0,0 +1,41 @@
+-- Tính rollup cho các click ghi trước migration 0010 để thống kê của link cũ không trống sau khi nâng cấp.
+-- SQLite chỉ cho một transaction ghi tại một thời điểm nên không click nào được ghi xen vào
+
+DELETE FROM click_dimension_rollups;
+DELETE FROM click_rollups_daily;
+DELETE FROM click_rollups_hourly;
+
+INSERT INTO click_rollups_hourly (url_id, hour, is_bot, clicks)
+SELECT url_id, strftime('%Y-%m-%d %H:00', created_at), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL
+GROUP BY url_id, strftime('%Y-%m-%d %H:00', created_at), is_bot;
+
+INSERT INTO click_rollups_daily (url_id, day, is_bot, clicks)
+SELECT url_id, SUBSTR(hour, 1, 10), is_bot, SUM(clicks)
+FROM click_rollups_hourly
+GROUP BY url_id, SUBSTR(hour, 1, 10), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'referer', strftime('%Y-%m-%d', created_at), SUBSTR(referer, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND referer <> ''
+GROUP BY url_id, strftime('%Y-%m-%d', created_at), SUBSTR(referer, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'country', strftime('%Y-%m-%d', created_at), SUBSTR(country, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND country <> ''
+GROUP BY url_id, strftime('%Y-%m-%d', created_at), SUBSTR(country, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'device', strftime('%Y-%m-%d', created_at), SUBSTR(device_type, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND device_type <> ''
+GROUP BY url_id, strftime('%Y-%m-%d', created_at), SUBSTR(device_type, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'browser', strftime('%Y-%m-%d', created_at), SUBSTR(browser_family, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND browser_family <> ''
+GROUP BY url_id, strftime('%Y-%m-%d', created_at), SUBSTR(browser_family, 1, 255), is_bot;
+
+INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, 'os', strftime('%Y-%m-%d', created_at), SUBSTR(os_family, 1, 255), is_bot, COUNT(*)
+FROM click_events WHERE created_at IS NOT NULL AND os_family <> ''
+GROUP BY url_id, strftime('%Y-%m-%d', created_at), SUBSTR(os_family, 1, 255), is_bot;
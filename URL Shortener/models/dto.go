@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // CreateURLRequest là request body để tạo short URL
 type CreateURLRequest struct {
 	OriginalURL string `json:"original_url" binding:"required,url"`
@@ -15,15 +17,97 @@ type CreateURLResponse struct {
 	ExpiresAt   string `json:"expires_at,omitempty"`
 }
 
+// UpdateURLRequest là request body của PATCH /api/urls/:shortCode
+// Chỉ các trường được gửi lên mới bị thay đổi
+type UpdateURLRequest struct {
+	OriginalURL *string `json:"original_url,omitempty" binding:"omitempty,url"`
+	ExpiresIn   *int    `json:"expires_in,omitempty"` // Số giờ tính từ bây giờ, 0 = không hết hạn
+}
+
+// TrashItemResponse là một link trong thùng rác
+type TrashItemResponse struct {
+	URLResponse
+	DeletedAt  string `json:"deleted_at"`
+	ReusableAt string `json:"reusable_at"` // Sau thời điểm này short code có thể bị cấp lại
+}
+
+// ListTrashResponse là một trang kết quả của GET /api/trash
+type ListTrashResponse struct {
+	Items      []TrashItemResponse `json:"items"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// URLRevisionResponse là một phiên bản cũ của URL trong lịch sử
+type URLRevisionResponse struct {
+	ID          uint   `json:"id"`
+	OriginalURL string `json:"original_url"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	Action      string `json:"action"`
+	ChangedBy   string `json:"changed_by"`
+	ChangedAt   string `json:"changed_at"`
+}
+
+// ListURLsRequest là query params của GET /api/urls
+type ListURLsRequest struct {
+	Cursor        string     `form:"cursor"`
+	Limit         int        `form:"limit"`
+	SortBy        string     `form:"sort_by"` // created_at (mặc định) hoặc click_count
+	Order         string     `form:"order"`   // desc (mặc định) hoặc asc
+	Search        string     `form:"q"`       // Tìm chuỗi con trong original_url/short_code
+	Expired       *bool      `form:"expired"`
+	Custom        *bool      `form:"custom"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// URLResponse là thông tin một short URL trong danh sách
+type URLResponse struct {
+	ShortCode   string `json:"short_code"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	ClickCount  int64  `json:"click_count"`
+	IsCustom    bool   `json:"is_custom"`
+	Expired     bool   `json:"expired"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+}
+
+// ListURLsResponse là một trang kết quả của GET /api/urls
+type ListURLsResponse struct {
+	Items      []URLResponse `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// ClickRequest là thông tin của một lượt redirect dùng để tạo click event
+type ClickRequest struct {
+	URLID          uint
+	ShortCode      string
+	IPAddress      string
+	UserAgent      string
+	Referer        string
+	Accept         string
+	AcceptLanguage string
+	Purpose        string // Header Purpose/Sec-Purpose, "prefetch" khi trình duyệt tải trước link
+}
+
 // URLStatsResponse là response chứa thống kê của URL
 type URLStatsResponse struct {
-	ShortCode    string           `json:"short_code"`
-	OriginalURL  string           `json:"original_url"`
-	TotalClicks  int64            `json:"total_clicks"`
-	CreatedAt    string           `json:"created_at"`
-	ClicksByDate map[string]int64 `json:"clicks_by_date"`
-	TopReferers  []RefererStats   `json:"top_referers"`
-	TopCountries []CountryStats   `json:"top_countries"`
+	URLID          uint             `json:"-"`
+	ShortCode      string           `json:"short_code"`
+	OriginalURL    string           `json:"original_url"`
+	TotalClicks    int64            `json:"total_clicks"`
+	BotClicks      int64            `json:"bot_clicks"`      // Số click từ bot, không nằm trong các thống kê khác trừ khi include_bots=true
+	IncludesBots   bool             `json:"includes_bots"`   // Các thống kê có tính cả click từ bot không
+	UniqueVisitors int64            `json:"unique_visitors"` // Số người xem duy nhất ước lượng (HyperLogLog), không tính bot
+	CreatedAt      string           `json:"created_at"`
+	ClicksByDate   map[string]int64 `json:"clicks_by_date"`
+	ClicksByHour   map[string]int64 `json:"clicks_by_hour"` // 24 giờ gần nhất, key dạng "YYYY-MM-DD HH:00" (UTC)
+	UniqueByDate   map[string]int64 `json:"unique_by_date"`
+	TopReferers    []RefererStats   `json:"top_referers"`
+	TopCountries   []CountryStats   `json:"top_countries"`
+	TopDevices     []DeviceStats    `json:"top_devices"`
+	TopBrowsers    []BrowserStats   `json:"top_browsers"`
+	TopOS          []OSStats        `json:"top_os"`
 }
 
 // RefererStats thống kê theo referer
@@ -38,6 +122,24 @@ type CountryStats struct {
 	Count   int64  `json:"count"`
 }
 
+// DeviceStats thống kê theo loại thiết bị
+type DeviceStats struct {
+	DeviceType string `json:"device_type"`
+	Count      int64  `json:"count"`
+}
+
+// BrowserStats thống kê theo trình duyệt
+type BrowserStats struct {
+	Browser string `json:"browser"`
+	Count   int64  `json:"count"`
+}
+
+// OSStats thống kê theo hệ điều hành
+type OSStats struct {
+	OS    string `json:"os"`
+	Count int64  `json:"count"`
+}
+
 // ErrorResponse là response trả về khi có lỗi
 type ErrorResponse struct {
 	Error   string `json:"error"`
@@ -16,6 +16,7 @@ type URL struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	IsCustom    bool           `gorm:"not null;default:false" json:"is_custom"`
 }
 
 // TableName định nghĩa tên bảng trong database
@@ -31,20 +32,194 @@ func (u *URL) IsExpired() bool {
 	return time.Now().After(*u.ExpiresAt)
 }
 
+// CachedURL là dữ liệu của một link được lưu trong cache,
+// đủ để redirect kiểm tra hết hạn mà không cần truy vấn database
+type CachedURL struct {
+	ID          uint       `json:"id"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// NotFound đánh dấu short code không tồn tại (negative cache),
+	// khi đó ExpiresAt là thời điểm entry hết hiệu lực
+	NotFound bool `json:"not_found,omitempty"`
+}
+
+// NewCachedURL tạo cache entry từ URL
+func NewCachedURL(u *URL) *CachedURL {
+	return &CachedURL{
+		ID:          u.ID,
+		OriginalURL: u.OriginalURL,
+		ExpiresAt:   u.ExpiresAt,
+	}
+}
+
+// NewNotFoundCachedURL tạo negative cache entry sống trong ttl
+func NewNotFoundCachedURL(ttl time.Duration) *CachedURL {
+	expiresAt := time.Now().Add(ttl)
+	return &CachedURL{
+		NotFound:  true,
+		ExpiresAt: &expiresAt,
+	}
+}
+
+// DeletedTombstoneTTL là thời gian giữ negative entry ghi đè cache khi link bị xóa:
+// đủ lâu để request đang nạp bản cũ từ database kết thúc, SET NX của nó không ghi lại được link đã xóa
+const DeletedTombstoneTTL = time.Minute
+
+// IsExpired kiểm tra link trong cache đã hết hạn chưa
+func (c *CachedURL) IsExpired() bool {
+	if c.ExpiresAt == nil {
+		return false
+	}
+	return time.Now().After(*c.ExpiresAt)
+}
+
+// URLRevision lưu giá trị cũ của một URL trước mỗi lần sửa để audit và rollback
+type URLRevision struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	URLID       uint       `gorm:"index;not null" json:"url_id"`
+	ShortCode   string     `gorm:"size:10;not null" json:"short_code"`
+	OriginalURL string     `gorm:"type:text;not null" json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Action      string     `gorm:"size:20;not null" json:"action"`      // "update" hoặc "restore"
+	ChangedBy   string     `gorm:"size:255;not null" json:"changed_by"` // Người thực hiện thay đổi
+	CreatedAt   time.Time  `json:"created_at"`                          // Thời điểm thay đổi
+}
+
+// TableName định nghĩa tên bảng trong database
+func (URLRevision) TableName() string {
+	return "url_revisions"
+}
+
+// Các loại thay đổi được ghi vào URLRevision
+const (
+	RevisionActionUpdate  = "update"
+	RevisionActionRestore = "restore"
+)
+
+// URLListQuery là điều kiện lọc, sắp xếp và phân trang khi liệt kê URL
+type URLListQuery struct {
+	SortBy        string     // "created_at" hoặc "click_count"
+	Descending    bool       // Sắp xếp giảm dần
+	Limit         int        // Số bản ghi tối đa cần lấy
+	Cursor        *URLCursor // Vị trí bản ghi cuối của trang trước (keyset)
+	Search        string     // Chuỗi con cần tìm trong original_url hoặc short_code
+	Expired       *bool      // true: chỉ link đã hết hạn, false: chỉ link còn hạn
+	Custom        *bool      // true: chỉ link dùng custom code, false: chỉ link sinh tự động
+	CreatedAfter  *time.Time // created_at >= CreatedAfter
+	CreatedBefore *time.Time // created_at < CreatedBefore
+	Now           time.Time  // Mốc thời gian để xét hết hạn
+}
+
+// URLCursor là giá trị của cột sắp xếp và ID của bản ghi cuối trang
+type URLCursor struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+	ClickCount int64     `json:"click_count,omitempty"`
+}
+
 // ClickEvent là model để lưu thông tin click analytics
 type ClickEvent struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	URLID     uint      `gorm:"index;not null" json:"url_id"`
-	ShortCode string    `gorm:"index;size:10;not null" json:"short_code"`
-	IPAddress string    `gorm:"size:45" json:"ip_address"`
-	UserAgent string    `gorm:"type:text" json:"user_agent"`
-	Referer   string    `gorm:"type:text" json:"referer"`
-	Country   string    `gorm:"size:100" json:"country"`
-	City      string    `gorm:"size:100" json:"city"`
-	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	URLID       uint   `gorm:"index;not null" json:"url_id"`
+	ShortCode   string `gorm:"index;size:10;not null" json:"short_code"`
+	IPAddress   string `gorm:"size:45" json:"ip_address"`
+	UserAgent   string `gorm:"type:text" json:"user_agent"`
+	Referer     string `gorm:"type:text" json:"referer"`
+	Country     string `gorm:"size:100" json:"country"`
+	Region      string `gorm:"size:100;not null;default:''" json:"region,omitempty"`
+	City        string `gorm:"size:100" json:"city"`
+	IsBot       bool   `gorm:"not null;default:false" json:"is_bot"`
+	BotCategory string `gorm:"size:32;not null;default:''" json:"bot_category,omitempty"` // preview, crawler, monitor, tool, suspicious, burst
+	// Các trường phân tích từ UserAgent, được click worker điền khi ghi
+	DeviceType     string    `gorm:"size:16;not null;default:''" json:"device_type,omitempty"` // desktop, mobile, tablet, tv, console, bot, unknown
+	OSFamily       string    `gorm:"size:32;not null;default:''" json:"os_family,omitempty"`
+	OSVersion      string    `gorm:"size:16;not null;default:''" json:"os_version,omitempty"`
+	BrowserFamily  string    `gorm:"size:32;not null;default:''" json:"browser_family,omitempty"`
+	BrowserVersion string    `gorm:"size:16;not null;default:''" json:"browser_version,omitempty"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
+
+// GeoLocation là vị trí của một IP tra từ database GeoIP
+type GeoLocation struct {
+	Country string
+	Region  string // Tỉnh/bang (subdivision đầu tiên)
+	City    string
 }
 
 // TableName định nghĩa tên bảng trong database
 func (ClickEvent) TableName() string {
 	return "click_events"
 }
+
+// ClickEventDeadLetter là click event không ghi được vào click_events sau nhiều lần thử
+type ClickEventDeadLetter struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ShortCode string    `gorm:"size:255;not null" json:"short_code"`
+	Payload   string    `gorm:"type:text;not null" json:"payload"` // JSON của click event
+	Error     string    `gorm:"type:text;not null" json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName định nghĩa tên bảng trong database
+func (ClickEventDeadLetter) TableName() string {
+	return "click_event_dead_letters"
+}
+
+// Các chiều thống kê của ClickDimensionRollup
+const (
+	DimensionReferer = "referer"
+	DimensionCountry = "country"
+	DimensionDevice  = "device"
+	DimensionBrowser = "browser"
+	DimensionOS      = "os"
+)
+
+// ClickRollupHourly là số click của link trong một giờ (UTC)
+type ClickRollupHourly struct {
+	URLID  uint   `gorm:"primaryKey;autoIncrement:false" json:"url_id"`
+	Hour   string `gorm:"primaryKey;size:16" json:"hour"` // YYYY-MM-DD HH:00
+	IsBot  bool   `gorm:"primaryKey" json:"is_bot"`
+	Clicks int64  `gorm:"not null" json:"clicks"`
+}
+
+// TableName định nghĩa tên bảng trong database
+func (ClickRollupHourly) TableName() string {
+	return "click_rollups_hourly"
+}
+
+// ClickRollupDaily là số click của link trong một ngày (UTC)
+type ClickRollupDaily struct {
+	URLID  uint   `gorm:"primaryKey;autoIncrement:false" json:"url_id"`
+	Day    string `gorm:"primaryKey;size:10" json:"day"` // YYYY-MM-DD
+	IsBot  bool   `gorm:"primaryKey" json:"is_bot"`
+	Clicks int64  `gorm:"not null" json:"clicks"`
+}
+
+// TableName định nghĩa tên bảng trong database
+func (ClickRollupDaily) TableName() string {
+	return "click_rollups_daily"
+}
+
+// ClickDimensionRollup là số click của link trong một ngày theo một giá trị của một chiều
+// (ví dụ dimension = "country", value = "Vietnam")
+type ClickDimensionRollup struct {
+	URLID     uint   `gorm:"primaryKey;autoIncrement:false" json:"url_id"`
+	Dimension string `gorm:"primaryKey;size:16" json:"dimension"`
+	Day       string `gorm:"primaryKey;size:10" json:"day"`
+	Value     string `gorm:"primaryKey;size:255" json:"value"`
+	IsBot     bool   `gorm:"primaryKey" json:"is_bot"`
+	Clicks    int64  `gorm:"not null" json:"clicks"`
+}
+
+// TableName định nghĩa tên bảng trong database
+func (ClickDimensionRollup) TableName() string {
+	return "click_dimension_rollups"
+}
+
+// ClickBatch là một nhóm click events đọc từ queue
+// Queue bền vững chỉ bỏ các event khỏi queue sau khi batch được Ack
+type ClickBatch struct {
+	Events []*ClickEvent
+	// IDs là vị trí của từng event trong queue, cùng thứ tự với Events
+	IDs []string
+}
@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"url-shortener/models"
@@ -10,24 +13,100 @@ import (
 
 // AnalyticsRepositoryImpl là implementation của AnalyticsRepository
 type AnalyticsRepositoryImpl struct {
-	db *gorm.DB
+	db      *gorm.DB
+	timeout time.Duration // Thời gian tối đa của mỗi truy vấn (0 = không giới hạn)
 }
 
 // NewAnalyticsRepository tạo instance mới của AnalyticsRepository
-func NewAnalyticsRepository(db *gorm.DB) *AnalyticsRepositoryImpl {
-	return &AnalyticsRepositoryImpl{db: db}
+func NewAnalyticsRepository(db *gorm.DB, timeout time.Duration) *AnalyticsRepositoryImpl {
+	return &AnalyticsRepositoryImpl{db: db, timeout: timeout}
 }
 
-// SaveClickEvent lưu sự kiện click
-func (r *AnalyticsRepositoryImpl) SaveClickEvent(event *models.ClickEvent) error {
-	return r.db.Create(event).Error
+// session trả về DB gắn với ctx, bị hủy khi request kết thúc hoặc quá timeout
+func (r *AnalyticsRepositoryImpl) session(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	return r.db.WithContext(ctx), cancel
 }
 
-// GetClicksByDate lấy số lượt click theo ngày
-func (r *AnalyticsRepositoryImpl) GetClicksByDate(shortCode string, days int) (map[string]int64, error) {
-	result := make(map[string]int64)
+// SaveClickEvent lưu sự kiện click và cộng vào rollup
+func (r *AnalyticsRepositoryImpl) SaveClickEvent(ctx context.Context, event *models.ClickEvent) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockRollupLinks(tx, []*models.ClickEvent{event}); err != nil {
+			return err
+		}
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return saveClickRollups(tx, []*models.ClickEvent{event})
+	})
+}
+
+// clickInsertBatchSize giới hạn số dòng mỗi lệnh INSERT (PostgreSQL tối đa 65535 tham số)
+const clickInsertBatchSize = 1000
+
+// SaveClickBatch ghi nhiều click events, tăng click_count và cộng rollup trong một transaction
+// Mỗi short code chỉ cần một lệnh UPDATE click_count = click_count + n
+func (r *AnalyticsRepositoryImpl) SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	// click_count chỉ đếm người dùng thật, click từ bot chỉ nằm trong click_events
+	clickCounts := make(map[string]int64)
+	for _, event := range events {
+		if !event.IsBot {
+			clickCounts[event.ShortCode]++
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := lockRollupLinks(tx, events); err != nil {
+			return err
+		}
+		if err := tx.CreateInBatches(events, clickInsertBatchSize).Error; err != nil {
+			return fmt.Errorf("failed to insert click events: %w", err)
+		}
+
+		for shortCode, count := range clickCounts {
+			err := tx.Model(&models.URL{}).
+				Where("short_code = ?", shortCode).
+				UpdateColumn("click_count", gorm.Expr("click_count + ?", count)).Error
+			if err != nil {
+				return fmt.Errorf("failed to update click count for %s: %w", shortCode, err)
+			}
+		}
+		return saveClickRollups(tx, events)
+	})
+}
+
+// SaveDeadLetter lưu click event không ghi được kèm lý do
+func (r *AnalyticsRepositoryImpl) SaveDeadLetter(ctx context.Context, event *models.ClickEvent, reason string) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode click event: %w", err)
+	}
+
+	return db.Create(&models.ClickEventDeadLetter{
+		ShortCode: event.ShortCode,
+		Payload:   string(payload),
+		Error:     reason,
+		CreatedAt: time.Now(),
+	}).Error
+}
 
-	startDate := time.Now().AddDate(0, 0, -days)
+// GetClicksByDate lấy số lượt click theo ngày (UTC) trong days ngày gần nhất từ click_rollups_daily
+func (r *AnalyticsRepositoryImpl) GetClicksByDate(ctx context.Context, shortCode string, days int, includeBots bool) (map[string]int64, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
 
 	type DateCount struct {
 		Date  string
@@ -36,10 +115,12 @@ func (r *AnalyticsRepositoryImpl) GetClicksByDate(shortCode string, days int) (m
 
 	var counts []DateCount
 
-	err := r.db.Model(&models.ClickEvent{}).
-		Select("DATE(created_at) as date, COUNT(*) as count").
-		Where("short_code = ? AND created_at >= ?", shortCode, startDate).
-		Group("DATE(created_at)").
+	startDay := time.Now().UTC().AddDate(0, 0, -days).Format(rollupDayLayout)
+
+	err := rollupScope(db, &models.ClickRollupDaily{}, shortCode, includeBots).
+		Select("day as date, SUM(clicks) as count").
+		Where("day >= ?", startDay).
+		Group("day").
 		Order("date DESC").
 		Scan(&counts).Error
 
@@ -47,6 +128,7 @@ func (r *AnalyticsRepositoryImpl) GetClicksByDate(shortCode string, days int) (m
 		return nil, err
 	}
 
+	result := make(map[string]int64, len(counts))
 	for _, c := range counts {
 		result[c.Date] = c.Count
 	}
@@ -54,32 +136,107 @@ func (r *AnalyticsRepositoryImpl) GetClicksByDate(shortCode string, days int) (m
 	return result, nil
 }
 
-// GetTopReferers lấy top referers
-func (r *AnalyticsRepositoryImpl) GetTopReferers(shortCode string, limit int) ([]models.RefererStats, error) {
-	var stats []models.RefererStats
+// GetClicksByHour lấy số lượt click theo giờ (UTC) trong hours giờ gần nhất từ click_rollups_hourly
+func (r *AnalyticsRepositoryImpl) GetClicksByHour(ctx context.Context, shortCode string, hours int, includeBots bool) (map[string]int64, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
 
-	err := r.db.Model(&models.ClickEvent{}).
-		Select("referer, COUNT(*) as count").
-		Where("short_code = ? AND referer != ''", shortCode).
-		Group("referer").
-		Order("count DESC").
-		Limit(limit).
-		Scan(&stats).Error
+	type HourCount struct {
+		Hour  string
+		Count int64
+	}
+
+	var counts []HourCount
 
+	startHour := time.Now().UTC().Add(-time.Duration(hours) * time.Hour).Truncate(time.Hour).Format(rollupHourLayout)
+
+	err := rollupScope(db, &models.ClickRollupHourly{}, shortCode, includeBots).
+		Select("hour, SUM(clicks) as count").
+		Where("hour > ?", startHour).
+		Group("hour").
+		Order("hour DESC").
+		Scan(&counts).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		result[c.Hour] = c.Count
+	}
+
+	return result, nil
+}
+
+// GetTopReferers lấy top referers
+func (r *AnalyticsRepositoryImpl) GetTopReferers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.RefererStats, error) {
+	var stats []models.RefererStats
+	err := r.topDimension(ctx, shortCode, models.DimensionReferer, "referer", limit, includeBots, &stats)
 	return stats, err
 }
 
 // GetTopCountries lấy top countries
-func (r *AnalyticsRepositoryImpl) GetTopCountries(shortCode string, limit int) ([]models.CountryStats, error) {
+func (r *AnalyticsRepositoryImpl) GetTopCountries(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.CountryStats, error) {
 	var stats []models.CountryStats
+	err := r.topDimension(ctx, shortCode, models.DimensionCountry, "country", limit, includeBots, &stats)
+	return stats, err
+}
 
-	err := r.db.Model(&models.ClickEvent{}).
-		Select("country, COUNT(*) as count").
-		Where("short_code = ? AND country != ''", shortCode).
-		Group("country").
+// GetTopDevices lấy phân bố theo loại thiết bị
+func (r *AnalyticsRepositoryImpl) GetTopDevices(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.DeviceStats, error) {
+	var stats []models.DeviceStats
+	err := r.topDimension(ctx, shortCode, models.DimensionDevice, "device_type", limit, includeBots, &stats)
+	return stats, err
+}
+
+// GetTopBrowsers lấy top trình duyệt
+func (r *AnalyticsRepositoryImpl) GetTopBrowsers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.BrowserStats, error) {
+	var stats []models.BrowserStats
+	err := r.topDimension(ctx, shortCode, models.DimensionBrowser, "browser", limit, includeBots, &stats)
+	return stats, err
+}
+
+// GetTopOS lấy top hệ điều hành
+func (r *AnalyticsRepositoryImpl) GetTopOS(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.OSStats, error) {
+	var stats []models.OSStats
+	err := r.topDimension(ctx, shortCode, models.DimensionOS, "os", limit, includeBots, &stats)
+	return stats, err
+}
+
+// CountBotClicks đếm số click từ bot của short code
+func (r *AnalyticsRepositoryImpl) CountBotClicks(ctx context.Context, shortCode string) (int64, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var count int64
+	err := rollupScope(db, &models.ClickRollupDaily{}, shortCode, true).
+		Where("is_bot = ?", true).
+		Select("COALESCE(SUM(clicks), 0)").
+		Scan(&count).Error
+	return count, err
+}
+
+// topDimension lấy các giá trị có nhiều click nhất của một chiều từ click_dimension_rollups
+// alias là tên cột của giá trị trong struct kết quả
+func (r *AnalyticsRepositoryImpl) topDimension(ctx context.Context, shortCode, dimension, alias string, limit int, includeBots bool, dest interface{}) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return rollupScope(db, &models.ClickDimensionRollup{}, shortCode, includeBots).
+		Select("value as "+alias+", SUM(clicks) as count").
+		Where("dimension = ?", dimension).
+		Group("value").
 		Order("count DESC").
 		Limit(limit).
-		Scan(&stats).Error
+		Scan(dest).Error
+}
 
-	return stats, err
+// rollupScope lọc rollup của short code, bỏ click từ bot nếu includeBots = false
+func rollupScope(db *gorm.DB, model interface{}, shortCode string, includeBots bool) *gorm.DB {
+	db = db.Model(model).Where("url_id = (SELECT id FROM urls WHERE short_code = ?)", shortCode)
+	if !includeBots {
+		db = db.Where("is_bot = ?", false)
+	}
+	return db
 }
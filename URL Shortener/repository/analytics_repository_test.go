@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+// TestAnalyticsRepository_SQLite tests the rollup-backed analytics queries on SQLite
+func TestAnalyticsRepository_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewAnalyticsRepository(db, time.Second)
+
+	// click_events.url_id tham chiếu urls.id
+	urlRepo := NewURLRepository(db, time.Second)
+	for _, code := range []string{"abc123", "other1"} {
+		if err := urlRepo.Create(ctx, &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	events := []*models.ClickEvent{
+		{URLID: 1, ShortCode: "abc123", Referer: "https://facebook.com", Country: "Vietnam", DeviceType: "mobile", OSFamily: "iOS", BrowserFamily: "Safari", CreatedAt: now},
+		{URLID: 1, ShortCode: "abc123", Referer: "https://facebook.com", Country: "Vietnam", DeviceType: "mobile", OSFamily: "Android", BrowserFamily: "Chrome", CreatedAt: now},
+		{URLID: 1, ShortCode: "abc123", Referer: "https://t.co", CreatedAt: yesterday},
+		{URLID: 2, ShortCode: "other1", Referer: "https://t.co", Country: "Japan", CreatedAt: now},
+		{URLID: 1, ShortCode: "abc123", Referer: "https://t.co", Country: "Japan", IsBot: true, BotCategory: "preview", CreatedAt: now},
+	}
+	for _, event := range events {
+		if err := repo.SaveClickEvent(ctx, event); err != nil {
+			t.Fatalf("SaveClickEvent returned error: %v", err)
+		}
+	}
+
+	clicksByDate, err := repo.GetClicksByDate(ctx, "abc123", 7, false)
+	if err != nil {
+		t.Fatalf("GetClicksByDate returned error: %v", err)
+	}
+	if got := clicksByDate[now.Format("2006-01-02")]; got != 2 {
+		t.Errorf("clicks today = %d, want 2 (%v)", got, clicksByDate)
+	}
+	if got := clicksByDate[yesterday.Format("2006-01-02")]; got != 1 {
+		t.Errorf("clicks yesterday = %d, want 1 (%v)", got, clicksByDate)
+	}
+
+	referers, err := repo.GetTopReferers(ctx, "abc123", 5, false)
+	if err != nil {
+		t.Fatalf("GetTopReferers returned error: %v", err)
+	}
+	if len(referers) != 2 || referers[0].Referer != "https://facebook.com" || referers[0].Count != 2 {
+		t.Errorf("GetTopReferers = %+v", referers)
+	}
+
+	countries, err := repo.GetTopCountries(ctx, "abc123", 5, false)
+	if err != nil {
+		t.Fatalf("GetTopCountries returned error: %v", err)
+	}
+	if len(countries) != 1 || countries[0].Country != "Vietnam" || countries[0].Count != 2 {
+		t.Errorf("GetTopCountries = %+v", countries)
+	}
+
+	devices, err := repo.GetTopDevices(ctx, "abc123", 5, false)
+	if err != nil || len(devices) != 1 || devices[0].DeviceType != "mobile" || devices[0].Count != 2 {
+		t.Errorf("GetTopDevices = (%+v, %v), want 2 mobile", devices, err)
+	}
+	browsers, err := repo.GetTopBrowsers(ctx, "abc123", 5, false)
+	if err != nil || len(browsers) != 2 {
+		t.Errorf("GetTopBrowsers = (%+v, %v), want 2 browsers", browsers, err)
+	}
+	systems, err := repo.GetTopOS(ctx, "abc123", 5, false)
+	if err != nil || len(systems) != 2 {
+		t.Errorf("GetTopOS = (%+v, %v), want 2 OS", systems, err)
+	}
+
+	// Click từ bot chỉ được tính khi includeBots = true
+	clicksByDate, err = repo.GetClicksByDate(ctx, "abc123", 7, true)
+	if err != nil || clicksByDate[now.Format("2006-01-02")] != 3 {
+		t.Errorf("GetClicksByDate with bots = (%v, %v), want 3 today", clicksByDate, err)
+	}
+	countries, _ = repo.GetTopCountries(ctx, "abc123", 5, true)
+	if len(countries) != 2 {
+		t.Errorf("GetTopCountries with bots = %+v, want 2 countries", countries)
+	}
+	if bots, err := repo.CountBotClicks(ctx, "abc123"); err != nil || bots != 1 {
+		t.Errorf("CountBotClicks = (%d, %v), want 1", bots, err)
+	}
+}
+
+// TestAnalyticsRepository_SaveClickBatch tests that a batch inserts every event and bumps click_count once per short code
+func TestAnalyticsRepository_SaveClickBatch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	urlRepo := NewURLRepository(db, time.Second)
+	repo := NewAnalyticsRepository(db, time.Second)
+
+	urlIDs := make(map[string]uint)
+	for _, code := range []string{"abc123", "other1"} {
+		url := &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}
+		if err := urlRepo.Create(ctx, url); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		urlIDs[code] = url.ID
+	}
+
+	var events []*models.ClickEvent
+	for i := 0; i < 5; i++ {
+		events = append(events, &models.ClickEvent{URLID: urlIDs["abc123"], ShortCode: "abc123", CreatedAt: time.Now()})
+	}
+	events = append(events, &models.ClickEvent{URLID: urlIDs["other1"], ShortCode: "other1", CreatedAt: time.Now()})
+	// Click từ bot được lưu nhưng không tăng click_count
+	events = append(events, &models.ClickEvent{URLID: urlIDs["other1"], ShortCode: "other1", IsBot: true, BotCategory: "crawler", CreatedAt: time.Now()})
+
+	if err := repo.SaveClickBatch(ctx, events); err != nil {
+		t.Fatalf("SaveClickBatch returned error: %v", err)
+	}
+
+	for code, want := range map[string]int64{"abc123": 5, "other1": 1} {
+		url, err := urlRepo.FindByShortCode(ctx, code)
+		if err != nil {
+			t.Fatalf("FindByShortCode returned error: %v", err)
+		}
+		if url.ClickCount != want {
+			t.Errorf("%s click_count = %d, want %d", code, url.ClickCount, want)
+		}
+	}
+
+	var saved int64
+	db.Model(&models.ClickEvent{}).Count(&saved)
+	if saved != 7 {
+		t.Errorf("saved %d click events, want 7", saved)
+	}
+
+	// Click event của link không tồn tại bị khóa ngoại từ chối, cả batch được rollback
+	err := repo.SaveClickBatch(ctx, []*models.ClickEvent{
+		{URLID: urlIDs["abc123"], ShortCode: "abc123", CreatedAt: time.Now()},
+		{URLID: 999, ShortCode: "gone", CreatedAt: time.Now()},
+	})
+	if !IsDataError(err) {
+		t.Fatalf("SaveClickBatch with unknown url_id = %v, want data error", err)
+	}
+	if url, _ := urlRepo.FindByShortCode(ctx, "abc123"); url.ClickCount != 5 {
+		t.Errorf("click_count = %d after rolled back batch, want 5", url.ClickCount)
+	}
+
+	if err := repo.SaveDeadLetter(ctx, events[0], "rejected"); err != nil {
+		t.Fatalf("SaveDeadLetter returned error: %v", err)
+	}
+	var deadLetters int64
+	db.Model(&models.ClickEventDeadLetter{}).Count(&deadLetters)
+	if deadLetters != 1 {
+		t.Errorf("saved %d dead letters, want 1", deadLetters)
+	}
+}
+
+// TestAnalyticsRepository_BackfillRollups tests that rebuilding rollups from click_events matches the incremental ones
+func TestAnalyticsRepository_BackfillRollups(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	urlRepo := NewURLRepository(db, time.Second)
+	repo := NewAnalyticsRepository(db, time.Second)
+
+	var urlIDs []uint
+	for _, code := range []string{"abc123", "other1", "third1"} {
+		url := &models.URL{ShortCode: code, OriginalURL: "https://example.com/" + code}
+		if err := urlRepo.Create(ctx, url); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+		urlIDs = append(urlIDs, url.ID)
+	}
+
+	// Giờ địa phương khác UTC và referer dài hơn giới hạn đều phải cho cùng kết quả
+	hanoi := time.FixedZone("ICT", 7*3600)
+	now := time.Now().In(hanoi)
+	longReferer := "https://ví-dụ.vn/" + strings.Repeat("đ", 300)
+	var events []*models.ClickEvent
+	for i := 0; i < 30; i++ {
+		events = append(events, &models.ClickEvent{
+			URLID:         urlIDs[i%3],
+			ShortCode:     []string{"abc123", "other1", "third1"}[i%3],
+			Referer:       []string{"https://facebook.com", "", longReferer}[i%3],
+			Country:       []string{"Vietnam", "Japan"}[i%2],
+			DeviceType:    "mobile",
+			BrowserFamily: "Chrome",
+			OSFamily:      "Android",
+			IsBot:         i%7 == 0,
+			CreatedAt:     now.Add(-time.Duration(i) * 5 * time.Hour),
+		})
+	}
+	if err := repo.SaveClickBatch(ctx, events); err != nil {
+		t.Fatalf("SaveClickBatch returned error: %v", err)
+	}
+
+	type snapshot struct {
+		hourly     []models.ClickRollupHourly
+		daily      []models.ClickRollupDaily
+		dimensions []models.ClickDimensionRollup
+	}
+	load := func() snapshot {
+		var s snapshot
+		db.Order("url_id, hour, is_bot").Find(&s.hourly)
+		db.Order("url_id, day, is_bot").Find(&s.daily)
+		db.Order("url_id, dimension, day, value, is_bot").Find(&s.dimensions)
+		return s
+	}
+	incremental := load()
+	if len(incremental.hourly) == 0 || len(incremental.dimensions) == 0 {
+		t.Fatalf("Expected SaveClickBatch to write rollups, got %+v", incremental)
+	}
+
+	// Rollup sai lệch bị thay bằng số liệu tính lại từ click_events
+	db.Exec("DELETE FROM click_rollups_hourly")
+	db.Exec("UPDATE click_rollups_daily SET clicks = clicks + 100")
+	db.Exec("DELETE FROM click_dimension_rollups WHERE dimension = ?", models.DimensionCountry)
+
+	var afterID uint
+	batches := 0
+	for {
+		lastID, n, err := repo.BackfillRollups(ctx, afterID, 2)
+		if err != nil {
+			t.Fatalf("BackfillRollups returned error: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		afterID = lastID
+		batches++
+	}
+	if batches != 2 {
+		t.Errorf("BackfillRollups ran %d batches, want 2", batches)
+	}
+
+	backfilled := load()
+	if !reflect.DeepEqual(incremental, backfilled) {
+		t.Errorf("Backfilled rollups differ from incremental ones:\nincremental: %+v\nbackfilled:  %+v", incremental, backfilled)
+	}
+}
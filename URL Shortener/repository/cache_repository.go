@@ -1,51 +1,177 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"url-shortener/database"
+	"url-shortener/models"
+
+	"github.com/go-redis/redis/v8"
 )
 
+// ErrCacheMiss được trả về khi short code không có trong cache
+var ErrCacheMiss = errors.New("cache miss")
+
 // CacheRepositoryImpl là implementation của CacheRepository
 type CacheRepositoryImpl struct {
 	redis      *database.RedisClient
 	expiration time.Duration
+	timeout    time.Duration // Thời gian tối đa của mỗi lệnh Redis (0 = không giới hạn)
 }
 
 // NewCacheRepository tạo instance mới của CacheRepository
-func NewCacheRepository(redis *database.RedisClient) *CacheRepositoryImpl {
+func NewCacheRepository(redis *database.RedisClient, timeout time.Duration) *CacheRepositoryImpl {
 	return &CacheRepositoryImpl{
 		redis:      redis,
-		expiration: 24 * time.Hour, // Cache 24 giờ
+		expiration: 24 * time.Hour, // Cache tối đa 24 giờ
+		timeout:    timeout,
 	}
 }
 
 // Set lưu URL vào cache
-func (r *CacheRepositoryImpl) Set(shortCode string, originalURL string) error {
+// Link đã hết hạn không được cache, key cũ (nếu có) bị xóa
+func (r *CacheRepositoryImpl) Set(ctx context.Context, shortCode string, entry *models.CachedURL) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	key := r.buildKey(shortCode)
-	return r.redis.Set(key, originalURL, r.expiration)
+
+	ttl, ok := cacheTTL(entry, r.expiration)
+	if !ok {
+		return r.redis.Delete(ctx, key)
+	}
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, key, string(value), ttl)
+}
+
+// SetIfAbsent chỉ lưu URL nếu cache chưa có key (SET NX).
+// Dùng khi nạp cache từ database để không ghi đè giá trị mới hơn do Update vừa ghi
+func (r *CacheRepositoryImpl) SetIfAbsent(ctx context.Context, shortCode string, entry *models.CachedURL) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	ttl, ok := cacheTTL(entry, r.expiration)
+	if !ok {
+		return false, nil
+	}
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	return r.redis.SetNX(ctx, r.buildKey(shortCode), string(value), ttl)
+}
+
+// SetManyIfAbsent lưu nhiều URL bằng một pipeline SET NX
+func (r *CacheRepositoryImpl) SetManyIfAbsent(ctx context.Context, entries map[string]*models.CachedURL) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
+	items := make([]database.PipelineItem, 0, len(entries))
+	for shortCode, entry := range entries {
+		ttl, ok := cacheTTL(entry, r.expiration)
+		if !ok {
+			continue
+		}
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		items = append(items, database.PipelineItem{
+			Key:        r.buildKey(shortCode),
+			Value:      string(value),
+			Expiration: ttl,
+		})
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	stored, err := r.redis.SetNXPipelined(ctx, items)
+	return len(stored), err
 }
 
-// Get lấy original URL từ cache
-func (r *CacheRepositoryImpl) Get(shortCode string) (string, error) {
+// Get lấy URL từ cache
+func (r *CacheRepositoryImpl) Get(ctx context.Context, shortCode string) (*models.CachedURL, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	key := r.buildKey(shortCode)
-	return r.redis.Get(key)
+	value, err := r.redis.Get(ctx, key)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeCachedURL(value)
 }
 
 // Delete xóa URL khỏi cache
-func (r *CacheRepositoryImpl) Delete(shortCode string) error {
+func (r *CacheRepositoryImpl) Delete(ctx context.Context, shortCode string) error {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	key := r.buildKey(shortCode)
-	return r.redis.Delete(key)
+	return r.redis.Delete(ctx, key)
 }
 
 // Exists kiểm tra URL có trong cache không
-func (r *CacheRepositoryImpl) Exists(shortCode string) (bool, error) {
+func (r *CacheRepositoryImpl) Exists(ctx context.Context, shortCode string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	defer cancel()
+
 	key := r.buildKey(shortCode)
-	return r.redis.Exists(key)
+	return r.redis.Exists(ctx, key)
+}
+
+// Clear xóa mọi key url:* khỏi Redis, trả về số key đã xóa
+// Quét cả keyspace nên không áp dụng timeout chung, timeout của Redis client giới hạn từng lệnh
+func (r *CacheRepositoryImpl) Clear(ctx context.Context) (int64, error) {
+	return r.redis.DeleteMatching(ctx, r.buildKey("*"))
 }
 
 // buildKey tạo key cho Redis
 func (r *CacheRepositoryImpl) buildKey(shortCode string) string {
 	return fmt.Sprintf("url:%s", shortCode)
 }
+
+// cacheTTL tính TTL = min(maxTTL, thời gian còn lại tới khi link hết hạn).
+// Trả về false nếu link đã hết hạn và không nên cache
+func cacheTTL(entry *models.CachedURL, maxTTL time.Duration) (time.Duration, bool) {
+	if entry.ExpiresAt == nil {
+		return maxTTL, true
+	}
+
+	remaining := time.Until(*entry.ExpiresAt)
+	if remaining <= 0 {
+		return 0, false
+	}
+	if remaining < maxTTL {
+		return remaining, true
+	}
+	return maxTTL, true
+}
+
+// decodeCachedURL đọc giá trị trong cache.
+// Giá trị không phải JSON là entry cũ chỉ chứa original URL (ghi trước khi đổi định dạng)
+func decodeCachedURL(value string) (*models.CachedURL, error) {
+	if !strings.HasPrefix(value, "{") {
+		return &models.CachedURL{OriginalURL: value}, nil
+	}
+
+	var entry models.CachedURL
+	if err := json.Unmarshal([]byte(value), &entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry: %w", err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// rollupHourLayout và rollupDayLayout là định dạng (UTC) của cột hour và day trong rollup
+	rollupHourLayout = "2006-01-02 15:00"
+	rollupDayLayout  = "2006-01-02"
+	// maxRollupValueLength là độ dài tối đa (ký tự) của giá trị một chiều, referer dài hơn bị cắt
+	maxRollupValueLength = 255
+)
+
+// rollupDimensions là các chiều được cộng dồn cùng cột tương ứng trong click_events
+var rollupDimensions = []struct {
+	name   string
+	column string
+	value  func(event *models.ClickEvent) string
+}{
+	{models.DimensionReferer, "referer", func(e *models.ClickEvent) string { return e.Referer }},
+	{models.DimensionCountry, "country", func(e *models.ClickEvent) string { return e.Country }},
+	{models.DimensionDevice, "device_type", func(e *models.ClickEvent) string { return e.DeviceType }},
+	{models.DimensionBrowser, "browser_family", func(e *models.ClickEvent) string { return e.BrowserFamily }},
+	{models.DimensionOS, "os_family", func(e *models.ClickEvent) string { return e.OSFamily }},
+}
+
+// lockRollupLinks khóa (FOR NO KEY UPDATE) các link của events trước khi ghi click events và rollup.
+// BackfillRollups khóa cùng các dòng bằng FOR UPDATE nên worker chờ backfill của link xong mới ghi
+// và ngược lại. Khóa theo thứ tự id để các worker ghi đồng thời không deadlock. SQLite chỉ có
+// một connection nên các transaction đã chạy lần lượt
+func lockRollupLinks(tx *gorm.DB, events []*models.ClickEvent) error {
+	if isSQLite(tx) {
+		return nil
+	}
+
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(events))
+	for _, event := range events {
+		if event.URLID != 0 && !seen[event.URLID] {
+			seen[event.URLID] = true
+			ids = append(ids, event.URLID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var locked []uint
+	err := tx.Unscoped().Model(&models.URL{}).
+		Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id ASC").
+		Pluck("id", &locked).Error
+	if err != nil {
+		return fmt.Errorf("failed to lock links: %w", err)
+	}
+	return nil
+}
+
+// saveClickRollups cộng số click của các event vào các bảng rollup (INSERT ... ON CONFLICT DO UPDATE)
+// Phải chạy trong cùng transaction ghi click events để rollup luôn khớp với click_events.
+// Các dòng được sắp xếp theo khóa để các worker ghi đồng thời khóa dòng theo cùng thứ tự, tránh deadlock
+func saveClickRollups(tx *gorm.DB, events []*models.ClickEvent) error {
+	hourly := make(map[models.ClickRollupHourly]int64)
+	daily := make(map[models.ClickRollupDaily]int64)
+	dimensions := make(map[models.ClickDimensionRollup]int64)
+
+	for _, event := range events {
+		if event.URLID == 0 {
+			continue
+		}
+		at := event.CreatedAt.UTC()
+		day := at.Format(rollupDayLayout)
+
+		hourly[models.ClickRollupHourly{URLID: event.URLID, Hour: at.Format(rollupHourLayout), IsBot: event.IsBot}]++
+		daily[models.ClickRollupDaily{URLID: event.URLID, Day: day, IsBot: event.IsBot}]++
+
+		for _, dimension := range rollupDimensions {
+			value := truncateRunes(dimension.value(event), maxRollupValueLength)
+			if value == "" {
+				continue
+			}
+			dimensions[models.ClickDimensionRollup{URLID: event.URLID, Dimension: dimension.name, Day: day, Value: value, IsBot: event.IsBot}]++
+		}
+	}
+	if len(hourly) == 0 {
+		return nil
+	}
+
+	hourlyRows := make([]models.ClickRollupHourly, 0, len(hourly))
+	for row, clicks := range hourly {
+		row.Clicks = clicks
+		hourlyRows = append(hourlyRows, row)
+	}
+	sort.Slice(hourlyRows, func(i, j int) bool {
+		a, b := hourlyRows[i], hourlyRows[j]
+		if a.URLID != b.URLID {
+			return a.URLID < b.URLID
+		}
+		if a.Hour != b.Hour {
+			return a.Hour < b.Hour
+		}
+		return !a.IsBot && b.IsBot
+	})
+
+	dailyRows := make([]models.ClickRollupDaily, 0, len(daily))
+	for row, clicks := range daily {
+		row.Clicks = clicks
+		dailyRows = append(dailyRows, row)
+	}
+	sort.Slice(dailyRows, func(i, j int) bool {
+		a, b := dailyRows[i], dailyRows[j]
+		if a.URLID != b.URLID {
+			return a.URLID < b.URLID
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		return !a.IsBot && b.IsBot
+	})
+
+	dimensionRows := make([]models.ClickDimensionRollup, 0, len(dimensions))
+	for row, clicks := range dimensions {
+		row.Clicks = clicks
+		dimensionRows = append(dimensionRows, row)
+	}
+	sort.Slice(dimensionRows, func(i, j int) bool {
+		a, b := dimensionRows[i], dimensionRows[j]
+		if a.URLID != b.URLID {
+			return a.URLID < b.URLID
+		}
+		if a.Dimension != b.Dimension {
+			return a.Dimension < b.Dimension
+		}
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return !a.IsBot && b.IsBot
+	})
+
+	err := tx.Clauses(addClicksOnConflict("click_rollups_hourly", "url_id", "hour", "is_bot")).
+		CreateInBatches(hourlyRows, clickInsertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("failed to update hourly rollups: %w", err)
+	}
+	err = tx.Clauses(addClicksOnConflict("click_rollups_daily", "url_id", "day", "is_bot")).
+		CreateInBatches(dailyRows, clickInsertBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("failed to update daily rollups: %w", err)
+	}
+	if len(dimensionRows) > 0 {
+		err = tx.Clauses(addClicksOnConflict("click_dimension_rollups", "url_id", "dimension", "day", "value", "is_bot")).
+			CreateInBatches(dimensionRows, clickInsertBatchSize).Error
+		if err != nil {
+			return fmt.Errorf("failed to update dimension rollups: %w", err)
+		}
+	}
+	return nil
+}
+
+// addClicksOnConflict cộng clicks vào dòng đã có thay vì báo trùng khóa
+func addClicksOnConflict(table string, keys ...string) clause.OnConflict {
+	columns := make([]clause.Column, len(keys))
+	for i, key := range keys {
+		columns[i] = clause.Column{Name: key}
+	}
+	return clause.OnConflict{
+		Columns:   columns,
+		DoUpdates: clause.Assignments(map[string]interface{}{"clicks": gorm.Expr(table + ".clicks + excluded.clicks")}),
+	}
+}
+
+// BackfillRollups tính lại rollup từ click_events cho tối đa limit link có id lớn hơn afterID
+// Mỗi lần gọi chạy trong một transaction: khóa các link (FOR UPDATE, worker chờ tới khi commit),
+// xóa rollup cũ rồi tổng hợp lại từ click_events nên chạy được khi service đang chạy.
+// Trả về id của link cuối cùng đã xử lý và số link, 0 link nghĩa là đã xong
+func (r *AnalyticsRepositoryImpl) BackfillRollups(ctx context.Context, afterID uint, limit int) (uint, int, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	hour := utcHourExpr(db, "created_at")
+	day := utcDateExpr(db, "created_at")
+
+	var ids []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Tính cả link trong thùng rác để số liệu còn đúng khi khôi phục
+		query := tx.Unscoped().Model(&models.URL{}).
+			Where("id > ?", afterID).
+			Order("id ASC").
+			Limit(limit)
+		if !isSQLite(tx) {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("failed to list links: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for _, model := range []interface{}{&models.ClickDimensionRollup{}, &models.ClickRollupDaily{}, &models.ClickRollupHourly{}} {
+			if err := tx.Where("url_id IN ?", ids).Delete(model).Error; err != nil {
+				return fmt.Errorf("failed to clear rollups: %w", err)
+			}
+		}
+
+		// ON CONFLICT chỉ phòng hờ: link đã bị khóa nên không có click nào được ghi xen vào
+		err := tx.Exec(`INSERT INTO click_rollups_hourly (url_id, hour, is_bot, clicks)
+SELECT url_id, `+hour+`, is_bot, COUNT(*)
+FROM click_events WHERE url_id IN ? AND created_at IS NOT NULL
+GROUP BY url_id, `+hour+`, is_bot
+ON CONFLICT (url_id, hour, is_bot) DO UPDATE SET clicks = excluded.clicks`, ids).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill hourly rollups: %w", err)
+		}
+
+		// Số theo ngày lấy từ số theo giờ vừa tính, không phải quét lại click_events
+		err = tx.Exec(`INSERT INTO click_rollups_daily (url_id, day, is_bot, clicks)
+SELECT url_id, SUBSTR(hour, 1, 10), is_bot, SUM(clicks)
+FROM click_rollups_hourly WHERE url_id IN ?
+GROUP BY url_id, SUBSTR(hour, 1, 10), is_bot
+ON CONFLICT (url_id, day, is_bot) DO UPDATE SET clicks = excluded.clicks`, ids).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill daily rollups: %w", err)
+		}
+
+		for _, dimension := range rollupDimensions {
+			value := fmt.Sprintf("SUBSTR(%s, 1, %d)", dimension.column, maxRollupValueLength)
+			err := tx.Exec(`INSERT INTO click_dimension_rollups (url_id, dimension, day, value, is_bot, clicks)
+SELECT url_id, ?, `+day+`, `+value+`, is_bot, COUNT(*)
+FROM click_events WHERE url_id IN ? AND created_at IS NOT NULL AND `+dimension.column+` <> ''
+GROUP BY url_id, `+day+`, `+value+`, is_bot
+ON CONFLICT (url_id, dimension, day, value, is_bot) DO UPDATE SET clicks = excluded.clicks`, dimension.name, ids).Error
+			if err != nil {
+				return fmt.Errorf("failed to backfill %s rollups: %w", dimension.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return afterID, 0, err
+	}
+	if len(ids) == 0 {
+		return afterID, 0, nil
+	}
+	return ids[len(ids)-1], len(ids), nil
+}
+
+// truncateRunes cắt chuỗi còn tối đa n ký tự, giống SUBSTR của SQL
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
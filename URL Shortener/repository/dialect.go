@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// isSQLite kiểm tra connection có đang dùng SQLite không
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// utcDateExpr trả về biểu thức SQL định dạng cột thời gian thành ngày UTC YYYY-MM-DD
+// PostgreSQL DATE() trả về kiểu date (scan ra chuỗi RFC3339) còn SQLite trả về text,
+// nên cần biểu thức riêng cho từng dialect để kết quả giống nhau
+func utcDateExpr(db *gorm.DB, column string) string {
+	if isSQLite(db) {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s)", column)
+	}
+	return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD')", column)
+}
+
+// utcHourExpr trả về biểu thức SQL định dạng cột thời gian thành giờ UTC YYYY-MM-DD HH:00
+func utcHourExpr(db *gorm.DB, column string) string {
+	if isSQLite(db) {
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00', %s)", column)
+	}
+	return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00')", column)
+}
+
+// likeOperator trả về toán tử so khớp chuỗi không phân biệt hoa thường
+// (SQLite LIKE vốn đã không phân biệt hoa thường với ký tự ASCII)
+func likeOperator(db *gorm.DB) string {
+	if isSQLite(db) {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
+
+// likePattern escape các ký tự đặc biệt của LIKE và bọc chuỗi thành %q%
+func likePattern(q string) string {
+	return "%" + likeEscaper.Replace(q) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// IsDataError kiểm tra lỗi do chính dữ liệu (vi phạm ràng buộc, giá trị không hợp lệ)
+// Ghi lại cùng dữ liệu vẫn sẽ lỗi, khác với lỗi kết nối hoặc timeout có thể thử lại
+func IsDataError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) ||
+		errors.Is(err, gorm.ErrForeignKeyViolated) ||
+		errors.Is(err, gorm.ErrCheckConstraintViolated) ||
+		errors.Is(err, gorm.ErrInvalidData) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 22: data exception, class 23: integrity constraint violation
+		return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+	}
+
+	// Driver SQLite chỉ trả về message
+	return strings.Contains(err.Error(), "constraint failed")
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+)
+
+// lruItem là một phần tử trong LRU cùng thời điểm hết hạn
+type lruItem struct {
+	key       string
+	value     models.CachedURL
+	expiresAt time.Time
+}
+
+// lruCache là cache trong process giới hạn số phần tử, loại bỏ phần tử ít dùng nhất khi đầy
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	items    map[string]*list.Element
+	order    *list.List // Phần tử mới dùng nằm ở đầu
+}
+
+// newLRUCache tạo LRU với sức chứa và TTL tối đa cho mỗi phần tử
+func newLRUCache(capacity int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// get lấy phần tử và đánh dấu vừa được dùng
+func (c *lruCache) get(key string) (*models.CachedURL, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*lruItem)
+	if time.Now().After(item.expiresAt) {
+		c.removeElement(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	value := item.value
+	return &value, true
+}
+
+// set lưu phần tử, TTL không vượt quá thời điểm hết hạn của link
+func (c *lruCache) set(key string, value *models.CachedURL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl, ok := cacheTTL(value, c.ttl)
+	if !ok {
+		if element, exists := c.items[key]; exists {
+			c.removeElement(element)
+		}
+		return
+	}
+
+	if element, exists := c.items[key]; exists {
+		item := element.Value.(*lruItem)
+		item.value = *value
+		item.expiresAt = time.Now().Add(ttl)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem{
+		key:       key,
+		value:     *value,
+		expiresAt: time.Now().Add(ttl),
+	})
+
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// delete xóa một phần tử
+func (c *lruCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// len trả về số phần tử hiện có
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// removeElement xóa phần tử khỏi list và map, caller phải giữ mu
+func (c *lruCache) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*lruItem).key)
+}
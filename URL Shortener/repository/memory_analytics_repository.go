@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+)
+
+// MemoryAnalyticsRepository là implementation in-memory của AnalyticsRepository
+// Dùng cho local dev và CI, an toàn khi dùng đồng thời
+type MemoryAnalyticsRepository struct {
+	mu          sync.RWMutex
+	nextID      uint
+	events      []models.ClickEvent
+	deadLetters []models.ClickEventDeadLetter
+	urlRepo     *MemoryURLRepository // Dùng để tăng click_count khi ghi batch
+}
+
+// NewMemoryAnalyticsRepository tạo instance mới của MemoryAnalyticsRepository
+func NewMemoryAnalyticsRepository(urlRepo *MemoryURLRepository) *MemoryAnalyticsRepository {
+	return &MemoryAnalyticsRepository{urlRepo: urlRepo}
+}
+
+// SaveClickEvent lưu sự kiện click
+func (r *MemoryAnalyticsRepository) SaveClickEvent(ctx context.Context, event *models.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	event.ID = r.nextID
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// SaveClickBatch lưu nhiều click events và tăng click_count của từng short code
+func (r *MemoryAnalyticsRepository) SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error {
+	clickCounts := make(map[string]int64)
+	for _, event := range events {
+		if err := r.SaveClickEvent(ctx, event); err != nil {
+			return err
+		}
+		// click_count chỉ đếm người dùng thật
+		if !event.IsBot {
+			clickCounts[event.ShortCode]++
+		}
+	}
+
+	if r.urlRepo != nil {
+		for shortCode, count := range clickCounts {
+			r.urlRepo.addClicks(shortCode, count)
+		}
+	}
+	return nil
+}
+
+// SaveDeadLetter lưu click event không ghi được kèm lý do
+func (r *MemoryAnalyticsRepository) SaveDeadLetter(ctx context.Context, event *models.ClickEvent, reason string) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadLetters = append(r.deadLetters, models.ClickEventDeadLetter{
+		ID:        uint(len(r.deadLetters) + 1),
+		ShortCode: event.ShortCode,
+		Payload:   string(payload),
+		Error:     reason,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// GetClicksByDate lấy số lượt click theo ngày
+func (r *MemoryAnalyticsRepository) GetClicksByDate(ctx context.Context, shortCode string, days int, includeBots bool) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]int64)
+	startDate := time.Now().AddDate(0, 0, -days)
+
+	for _, event := range r.events {
+		if event.ShortCode != shortCode || event.CreatedAt.Before(startDate) || (event.IsBot && !includeBots) {
+			continue
+		}
+		result[event.CreatedAt.UTC().Format("2006-01-02")]++
+	}
+
+	return result, nil
+}
+
+// GetClicksByHour lấy số lượt click theo giờ
+func (r *MemoryAnalyticsRepository) GetClicksByHour(ctx context.Context, shortCode string, hours int, includeBots bool) (map[string]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]int64)
+	startHour := time.Now().Add(-time.Duration(hours-1) * time.Hour).Truncate(time.Hour)
+
+	for _, event := range r.events {
+		if event.ShortCode != shortCode || event.CreatedAt.Before(startHour) || (event.IsBot && !includeBots) {
+			continue
+		}
+		result[event.CreatedAt.UTC().Format("2006-01-02 15:00")]++
+	}
+
+	return result, nil
+}
+
+// GetTopReferers lấy top referers
+func (r *MemoryAnalyticsRepository) GetTopReferers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.RefererStats, error) {
+	counts := r.countBy(shortCode, includeBots, func(event *models.ClickEvent) string {
+		return event.Referer
+	})
+
+	stats := make([]models.RefererStats, 0, len(counts))
+	for _, c := range topCounts(counts, limit) {
+		stats = append(stats, models.RefererStats{Referer: c.key, Count: c.count})
+	}
+	return stats, nil
+}
+
+// GetTopCountries lấy top countries
+func (r *MemoryAnalyticsRepository) GetTopCountries(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.CountryStats, error) {
+	counts := r.countBy(shortCode, includeBots, func(event *models.ClickEvent) string {
+		return event.Country
+	})
+
+	stats := make([]models.CountryStats, 0, len(counts))
+	for _, c := range topCounts(counts, limit) {
+		stats = append(stats, models.CountryStats{Country: c.key, Count: c.count})
+	}
+	return stats, nil
+}
+
+// GetTopDevices lấy phân bố theo loại thiết bị
+func (r *MemoryAnalyticsRepository) GetTopDevices(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.DeviceStats, error) {
+	counts := r.countBy(shortCode, includeBots, func(event *models.ClickEvent) string {
+		return event.DeviceType
+	})
+
+	stats := make([]models.DeviceStats, 0, len(counts))
+	for _, c := range topCounts(counts, limit) {
+		stats = append(stats, models.DeviceStats{DeviceType: c.key, Count: c.count})
+	}
+	return stats, nil
+}
+
+// GetTopBrowsers lấy top trình duyệt
+func (r *MemoryAnalyticsRepository) GetTopBrowsers(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.BrowserStats, error) {
+	counts := r.countBy(shortCode, includeBots, func(event *models.ClickEvent) string {
+		return event.BrowserFamily
+	})
+
+	stats := make([]models.BrowserStats, 0, len(counts))
+	for _, c := range topCounts(counts, limit) {
+		stats = append(stats, models.BrowserStats{Browser: c.key, Count: c.count})
+	}
+	return stats, nil
+}
+
+// GetTopOS lấy top hệ điều hành
+func (r *MemoryAnalyticsRepository) GetTopOS(ctx context.Context, shortCode string, limit int, includeBots bool) ([]models.OSStats, error) {
+	counts := r.countBy(shortCode, includeBots, func(event *models.ClickEvent) string {
+		return event.OSFamily
+	})
+
+	stats := make([]models.OSStats, 0, len(counts))
+	for _, c := range topCounts(counts, limit) {
+		stats = append(stats, models.OSStats{OS: c.key, Count: c.count})
+	}
+	return stats, nil
+}
+
+// CountBotClicks đếm số click từ bot của short code
+func (r *MemoryAnalyticsRepository) CountBotClicks(ctx context.Context, shortCode string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for i := range r.events {
+		if r.events[i].ShortCode == shortCode && r.events[i].IsBot {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// countBy đếm số click của short code theo một chiều dữ liệu, bỏ qua giá trị rỗng
+func (r *MemoryAnalyticsRepository) countBy(shortCode string, includeBots bool, dimension func(*models.ClickEvent) string) map[string]int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for i := range r.events {
+		event := &r.events[i]
+		if event.ShortCode != shortCode || (event.IsBot && !includeBots) {
+			continue
+		}
+		if key := dimension(event); key != "" {
+			counts[key]++
+		}
+	}
+	return counts
+}
+
+// keyCount là một cặp giá trị - số lượng dùng để sắp xếp top N
+type keyCount struct {
+	key   string
+	count int64
+}
+
+// topCounts sắp xếp giảm dần theo số lượng và giữ lại tối đa limit phần tử
+func topCounts(counts map[string]int64, limit int) []keyCount {
+	sorted := make([]keyCount, 0, len(counts))
+	for key, count := range counts {
+		sorted = append(sorted, keyCount{key: key, count: count})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
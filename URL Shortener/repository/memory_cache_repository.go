@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+)
+
+// memoryCacheEntry là một giá trị trong cache cùng thời điểm hết hạn
+type memoryCacheEntry struct {
+	value     models.CachedURL
+	expiresAt time.Time
+}
+
+// MemoryCacheRepository là implementation in-memory của CacheRepository
+// Dùng thay Redis cho local dev và CI, an toàn khi dùng đồng thời
+type MemoryCacheRepository struct {
+	mu         sync.RWMutex
+	entries    map[string]memoryCacheEntry
+	expiration time.Duration
+}
+
+// NewMemoryCacheRepository tạo instance mới của MemoryCacheRepository
+func NewMemoryCacheRepository() *MemoryCacheRepository {
+	return &MemoryCacheRepository{
+		entries:    make(map[string]memoryCacheEntry),
+		expiration: 24 * time.Hour, // Giống CacheRepositoryImpl
+	}
+}
+
+// Set lưu URL vào cache
+// Link đã hết hạn không được cache, key cũ (nếu có) bị xóa
+func (r *MemoryCacheRepository) Set(ctx context.Context, shortCode string, entry *models.CachedURL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ttl, ok := cacheTTL(entry, r.expiration)
+	if !ok {
+		delete(r.entries, shortCode)
+		return nil
+	}
+	r.entries[shortCode] = memoryCacheEntry{
+		value:     *entry,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// SetIfAbsent chỉ lưu URL nếu cache chưa có key
+func (r *MemoryCacheRepository) SetIfAbsent(ctx context.Context, shortCode string, entry *models.CachedURL) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.entries[shortCode]; ok && time.Now().Before(existing.expiresAt) {
+		return false, nil
+	}
+	ttl, ok := cacheTTL(entry, r.expiration)
+	if !ok {
+		return false, nil
+	}
+	r.entries[shortCode] = memoryCacheEntry{
+		value:     *entry,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return true, nil
+}
+
+// SetManyIfAbsent lưu nhiều URL, chỉ những key chưa có trong cache
+func (r *MemoryCacheRepository) SetManyIfAbsent(ctx context.Context, entries map[string]*models.CachedURL) (int, error) {
+	stored := 0
+	for shortCode, entry := range entries {
+		if ok, _ := r.SetIfAbsent(ctx, shortCode, entry); ok {
+			stored++
+		}
+	}
+	return stored, nil
+}
+
+// Get lấy URL từ cache
+func (r *MemoryCacheRepository) Get(ctx context.Context, shortCode string) (*models.CachedURL, error) {
+	r.mu.RLock()
+	entry, ok := r.entries[shortCode]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	if time.Now().After(entry.expiresAt) {
+		r.Delete(ctx, shortCode)
+		return nil, ErrCacheMiss
+	}
+	value := entry.value
+	return &value, nil
+}
+
+// Delete xóa URL khỏi cache
+func (r *MemoryCacheRepository) Delete(ctx context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, shortCode)
+	return nil
+}
+
+// Clear xóa toàn bộ URL khỏi cache
+func (r *MemoryCacheRepository) Clear(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := int64(len(r.entries))
+	r.entries = make(map[string]memoryCacheEntry)
+	return n, nil
+}
+
+// Exists kiểm tra URL có trong cache không
+func (r *MemoryCacheRepository) Exists(ctx context.Context, shortCode string) (bool, error) {
+	_, err := r.Get(ctx, shortCode)
+	if errors.Is(err, ErrCacheMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
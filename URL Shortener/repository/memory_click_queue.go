@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/models"
+)
+
+// ErrQueueFull được trả về khi queue không còn chỗ cho event mới
+var ErrQueueFull = errors.New("click queue full")
+
+// ErrQueueClosed được trả về khi push vào queue đã đóng
+var ErrQueueClosed = errors.New("click queue closed")
+
+// MemoryClickQueue là click queue dùng buffered channel
+// Nhanh nhưng không bền vững: events còn trong queue mất khi process dừng
+type MemoryClickQueue struct {
+	events    chan *models.ClickEvent
+	mu        sync.RWMutex
+	closed    bool
+	discarded uint64
+}
+
+// NewMemoryClickQueue tạo queue in-memory chứa tối đa size events
+func NewMemoryClickQueue(size int) *MemoryClickQueue {
+	return &MemoryClickQueue{
+		events: make(chan *models.ClickEvent, size),
+	}
+}
+
+// Push thêm event vào queue, không block khi queue đầy
+func (q *MemoryClickQueue) Push(event *models.ClickEvent) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.events <- event:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Pop đọc tối đa max events, chờ tối đa wait để gom đủ batch
+// Events đã lấy ra luôn được trả về kể cả khi ctx bị hủy giữa chừng
+func (q *MemoryClickQueue) Pop(ctx context.Context, max int, wait time.Duration) (*models.ClickBatch, error) {
+	batch := &models.ClickBatch{}
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch.Events) < max {
+		if wait <= 0 {
+			select {
+			case event := <-q.events:
+				batch.Events = append(batch.Events, event)
+				continue
+			default:
+				return batch, nil
+			}
+		}
+
+		select {
+		case event := <-q.events:
+			batch.Events = append(batch.Events, event)
+		case <-timeout:
+			return batch, nil
+		case <-ctx.Done():
+			if len(batch.Events) > 0 {
+				return batch, nil
+			}
+			return batch, ctx.Err()
+		}
+	}
+	return batch, nil
+}
+
+// Ack không cần làm gì vì event đã rời queue khi Pop
+func (q *MemoryClickQueue) Ack(batch *models.ClickBatch) error {
+	return nil
+}
+
+// Renew không cần làm gì vì batch chỉ thuộc về worker đã Pop
+func (q *MemoryClickQueue) Renew(batch *models.ClickBatch) error {
+	return nil
+}
+
+// Len trả về số events đang chờ trong queue
+func (q *MemoryClickQueue) Len() int {
+	return len(q.events)
+}
+
+// GetStats trả về thống kê của queue
+func (q *MemoryClickQueue) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"type":               "memory",
+		"size":               len(q.events),
+		"capacity":           cap(q.events),
+		"discarded_on_close": atomic.LoadUint64(&q.discarded),
+	}
+}
+
+// Close đóng queue, các events chưa được xử lý bị bỏ
+// Channel không bị đóng để Push muộn không thể panic
+func (q *MemoryClickQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+
+	if remaining := len(q.events); remaining > 0 {
+		atomic.AddUint64(&q.discarded, uint64(remaining))
+		return fmt.Errorf("%d click events discarded", remaining)
+	}
+	return nil
+}
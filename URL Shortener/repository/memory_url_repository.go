@@ -0,0 +1,422 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// MemoryURLRepository là implementation in-memory của URLRepository
+// Dùng cho local dev và CI khi không có PostgreSQL, an toàn khi dùng đồng thời
+type MemoryURLRepository struct {
+	mu             sync.RWMutex
+	nextID         uint
+	urls           map[string]*models.URL
+	nextRevisionID uint
+	revisions      []models.URLRevision
+}
+
+// NewMemoryURLRepository tạo instance mới của MemoryURLRepository
+func NewMemoryURLRepository() *MemoryURLRepository {
+	return &MemoryURLRepository{
+		urls: make(map[string]*models.URL),
+	}
+}
+
+// Create tạo mới một URL record
+func (r *MemoryURLRepository) Create(ctx context.Context, url *models.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Giống unique index trong database: cả bản ghi đã soft delete cũng giữ short code
+	if _, ok := r.urls[url.ShortCode]; ok {
+		return fmt.Errorf("duplicate short code: %s", url.ShortCode)
+	}
+
+	now := time.Now()
+	r.nextID++
+	url.ID = r.nextID
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = now
+	}
+	url.UpdatedAt = now
+
+	stored := *url
+	r.urls[url.ShortCode] = &stored
+	return nil
+}
+
+// FindByShortCode tìm URL theo short code
+func (r *MemoryURLRepository) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok || url.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *url
+	return &found, nil
+}
+
+// FindByOriginalURL tìm URL theo original URL
+func (r *MemoryURLRepository) FindByOriginalURL(ctx context.Context, originalURL string) (*models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Trả về bản ghi có ID nhỏ nhất để giống với First() của GORM
+	var found *models.URL
+	for _, url := range r.urls {
+		if url.DeletedAt.Valid || url.OriginalURL != originalURL {
+			continue
+		}
+		if found == nil || url.ID < found.ID {
+			found = url
+		}
+	}
+	if found == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	result := *found
+	return &result, nil
+}
+
+// IncrementClickCount tăng số lượt click
+func (r *MemoryURLRepository) IncrementClickCount(ctx context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addClicksLocked(shortCode, 1)
+	return nil
+}
+
+// addClicks tăng click_count thêm count, dùng khi ghi click theo batch
+func (r *MemoryURLRepository) addClicks(shortCode string, count int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addClicksLocked(shortCode, count)
+}
+
+// addClicksLocked tăng click_count của link chưa bị xóa, caller phải giữ mu
+func (r *MemoryURLRepository) addClicksLocked(shortCode string, count int64) {
+	if url, ok := r.urls[shortCode]; ok && !url.DeletedAt.Valid {
+		url.ClickCount += count
+	}
+}
+
+// Update sửa URL và ghi lịch sử khi giữ lock, các update đồng thời chạy tuần tự
+func (r *MemoryURLRepository) Update(ctx context.Context, shortCode string, change func(url *models.URL) (*models.URLRevision, error), saved func(url *models.URL) error) (*models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.urls[shortCode]
+	if !ok || stored.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// Sửa trên bản sao để change hoặc saved lỗi thì dữ liệu không đổi
+	url := *stored
+	previous, err := change(&url)
+	if err != nil {
+		return nil, err
+	}
+	url.UpdatedAt = time.Now()
+	if saved != nil {
+		if err := saved(&url); err != nil {
+			return nil, err
+		}
+	}
+
+	stored.OriginalURL = url.OriginalURL
+	stored.ExpiresAt = url.ExpiresAt
+	stored.UpdatedAt = url.UpdatedAt
+
+	if previous != nil {
+		r.nextRevisionID++
+		previous.ID = r.nextRevisionID
+		if previous.CreatedAt.IsZero() {
+			previous.CreatedAt = url.UpdatedAt
+		}
+		r.revisions = append(r.revisions, *previous)
+	}
+	return &url, nil
+}
+
+// ListRevisions lấy lịch sử thay đổi của URL, mới nhất trước
+func (r *MemoryURLRepository) ListRevisions(ctx context.Context, urlID uint) ([]models.URLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var revisions []models.URLRevision
+	for i := len(r.revisions) - 1; i >= 0; i-- {
+		if r.revisions[i].URLID == urlID {
+			revisions = append(revisions, r.revisions[i])
+		}
+	}
+	return revisions, nil
+}
+
+// FindRevision tìm một phiên bản cũ của URL
+func (r *MemoryURLRepository) FindRevision(ctx context.Context, urlID uint, revisionID uint) (*models.URLRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, revision := range r.revisions {
+		if revision.ID == revisionID && revision.URLID == urlID {
+			found := revision
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// Delete xóa URL (soft delete)
+func (r *MemoryURLRepository) Delete(ctx context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if url, ok := r.urls[shortCode]; ok && !url.DeletedAt.Valid {
+		url.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	}
+	return nil
+}
+
+// ExistsShortCode kiểm tra short code đã tồn tại chưa (kể cả link đã xóa)
+func (r *MemoryURLRepository) ExistsShortCode(ctx context.Context, shortCode string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.urls[shortCode]
+	return ok, nil
+}
+
+// FindDeletedByShortCode tìm link đã bị soft delete theo short code
+func (r *MemoryURLRepository) FindDeletedByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok || !url.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *url
+	return &found, nil
+}
+
+// ListDeleted liệt kê link đã bị soft delete, mới xóa trước
+func (r *MemoryURLRepository) ListDeleted(ctx context.Context, limit int, beforeID uint) ([]models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var urls []models.URL
+	for _, url := range r.urls {
+		if url.DeletedAt.Valid && (beforeID == 0 || url.ID < beforeID) {
+			urls = append(urls, *url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID > urls[j].ID })
+	if limit > 0 && len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
+// Restore khôi phục link đã bị soft delete
+func (r *MemoryURLRepository) Restore(ctx context.Context, shortCode string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok || !url.DeletedAt.Valid {
+		return gorm.ErrRecordNotFound
+	}
+	url.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+// Purge xóa vĩnh viễn link đã bị soft delete cùng lịch sử
+// Bản in-memory không lưu click events nên archiveAnalytics không có tác dụng
+func (r *MemoryURLRepository) Purge(ctx context.Context, shortCode string, archiveAnalytics bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	url, ok := r.urls[shortCode]
+	if !ok || !url.DeletedAt.Valid {
+		return gorm.ErrRecordNotFound
+	}
+
+	revisions := r.revisions[:0]
+	for _, revision := range r.revisions {
+		if revision.URLID != url.ID {
+			revisions = append(revisions, revision)
+		}
+	}
+	r.revisions = revisions
+
+	delete(r.urls, shortCode)
+	return nil
+}
+
+// GetStats lấy thống kê của URL
+func (r *MemoryURLRepository) GetStats(ctx context.Context, shortCode string) (*models.URLStatsResponse, error) {
+	url, err := r.FindByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("URL not found: %w", err)
+	}
+
+	stats := &models.URLStatsResponse{
+		URLID:       url.ID,
+		ShortCode:   url.ShortCode,
+		OriginalURL: url.OriginalURL,
+		TotalClicks: url.ClickCount,
+		CreatedAt:   url.CreatedAt.Format(time.RFC3339),
+	}
+
+	return stats, nil
+}
+
+// List liệt kê URL theo điều kiện lọc, sắp xếp và keyset cursor
+func (r *MemoryURLRepository) List(ctx context.Context, query *models.URLListQuery) ([]models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byClicks := query.SortBy == "click_count"
+
+	// less so sánh theo (sort_column, id) tăng dần
+	less := func(a, b *models.URL) bool {
+		if byClicks && a.ClickCount != b.ClickCount {
+			return a.ClickCount < b.ClickCount
+		}
+		if !byClicks && !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}
+
+	var cursor *models.URL
+	if query.Cursor != nil {
+		cursor = &models.URL{
+			ID:         query.Cursor.ID,
+			CreatedAt:  query.Cursor.CreatedAt,
+			ClickCount: query.Cursor.ClickCount,
+		}
+	}
+
+	search := strings.ToLower(query.Search)
+
+	var urls []models.URL
+	for _, url := range r.urls {
+		if url.DeletedAt.Valid {
+			continue
+		}
+		if cursor != nil {
+			if query.Descending && !less(url, cursor) {
+				continue
+			}
+			if !query.Descending && !less(cursor, url) {
+				continue
+			}
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(url.OriginalURL), search) &&
+			!strings.Contains(strings.ToLower(url.ShortCode), search) {
+			continue
+		}
+		if query.Expired != nil {
+			expired := url.ExpiresAt != nil && !url.ExpiresAt.After(query.Now)
+			if expired != *query.Expired {
+				continue
+			}
+		}
+		if query.Custom != nil && url.IsCustom != *query.Custom {
+			continue
+		}
+		if query.CreatedAfter != nil && url.CreatedAt.Before(*query.CreatedAfter) {
+			continue
+		}
+		if query.CreatedBefore != nil && !url.CreatedAt.Before(*query.CreatedBefore) {
+			continue
+		}
+		urls = append(urls, *url)
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if query.Descending {
+			return less(&urls[j], &urls[i])
+		}
+		return less(&urls[i], &urls[j])
+	})
+
+	if query.Limit > 0 && len(urls) > query.Limit {
+		urls = urls[:query.Limit]
+	}
+	return urls, nil
+}
+
+// FindExpired tìm link chưa xóa đã hết hạn trước thời điểm before
+func (r *MemoryURLRepository) FindExpired(ctx context.Context, before time.Time, limit int) ([]models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var urls []models.URL
+	for _, url := range r.urls {
+		if !url.DeletedAt.Valid && url.ExpiresAt != nil && url.ExpiresAt.Before(before) {
+			urls = append(urls, *url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ExpiresAt.Before(*urls[j].ExpiresAt) })
+	if limit > 0 && len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
+// DeleteExpired soft delete các link trong ids vẫn còn hết hạn trước thời điểm before
+func (r *MemoryURLRepository) DeleteExpired(ctx context.Context, ids []uint, before time.Time) ([]models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	targets := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		targets[id] = true
+	}
+
+	now := time.Now()
+	var deleted []models.URL
+	for _, url := range r.urls {
+		if targets[url.ID] && !url.DeletedAt.Valid && url.ExpiresAt != nil && url.ExpiresAt.Before(before) {
+			url.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+			deleted = append(deleted, *url)
+		}
+	}
+	return deleted, nil
+}
+
+// FindPurgeable tìm link đã soft delete trước thời điểm deletedBefore
+func (r *MemoryURLRepository) FindPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]models.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var urls []models.URL
+	for _, url := range r.urls {
+		if url.DeletedAt.Valid && url.DeletedAt.Time.Before(deletedBefore) {
+			urls = append(urls, *url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].DeletedAt.Time.Before(urls[j].DeletedAt.Time) })
+	if limit > 0 && len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
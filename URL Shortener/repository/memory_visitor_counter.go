@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/analytics"
+	"url-shortener/models"
+)
+
+// MemoryVisitorCounter đếm người xem duy nhất bằng HyperLogLog trong process
+// Dùng khi chạy không có Redis và làm dự phòng khi Redis lỗi; số liệu mất khi restart
+type MemoryVisitorCounter struct {
+	salt string
+
+	mu       sync.Mutex
+	sketches map[string]*analytics.HyperLogLog
+	prunedAt string // Ngày dọn các bộ đếm theo ngày đã hết hạn gần nhất
+}
+
+// NewMemoryVisitorCounter tạo bộ đếm người xem trong process
+func NewMemoryVisitorCounter(salt string) *MemoryVisitorCounter {
+	return &MemoryVisitorCounter{
+		salt:     salt,
+		sketches: make(map[string]*analytics.HyperLogLog),
+	}
+}
+
+// Add thêm người xem của các click vào bộ đếm tổng và bộ đếm theo ngày
+func (c *MemoryVisitorCounter) Add(ctx context.Context, events []*models.ClickEvent) error {
+	visits := countableVisits(c.salt, events)
+	if len(visits) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pruneLocked(time.Now())
+
+	for _, v := range visits {
+		hash := v.hash64()
+		c.sketchLocked(visitorTotalKey(v.urlID)).AddHash(hash)
+		c.sketchLocked(visitorDailyKey(v.urlID, v.date)).AddHash(hash)
+	}
+	return nil
+}
+
+// Count đếm người xem từ trước tới nay và của từng ngày, link chưa có người xem trả về 0
+func (c *MemoryVisitorCounter) Count(ctx context.Context, urlID uint, dates []string) (int64, map[string]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byDate := make(map[string]int64, len(dates))
+	for _, date := range dates {
+		byDate[date] = c.countLocked(visitorDailyKey(urlID, date))
+	}
+	return c.countLocked(visitorTotalKey(urlID)), byDate, nil
+}
+
+// Reset xóa toàn bộ bộ đếm
+func (c *MemoryVisitorCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sketches = make(map[string]*analytics.HyperLogLog)
+}
+
+// GetStats trả về số bộ đếm đang giữ
+func (c *MemoryVisitorCounter) GetStats() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return map[string]interface{}{
+		"backend":  "memory",
+		"sketches": len(c.sketches),
+	}
+}
+
+// sketchLocked lấy hoặc tạo HyperLogLog của key, caller phải giữ mu
+func (c *MemoryVisitorCounter) sketchLocked(key string) *analytics.HyperLogLog {
+	sketch, ok := c.sketches[key]
+	if !ok {
+		sketch = analytics.NewHyperLogLog()
+		c.sketches[key] = sketch
+	}
+	return sketch
+}
+
+// countLocked đếm phần tử của key, caller phải giữ mu
+func (c *MemoryVisitorCounter) countLocked(key string) int64 {
+	sketch, ok := c.sketches[key]
+	if !ok {
+		return 0
+	}
+	return int64(sketch.Count())
+}
+
+// pruneLocked xóa bộ đếm của các ngày cũ hơn visitorDailyRetention, mỗi ngày một lần
+// Caller phải giữ mu
+func (c *MemoryVisitorCounter) pruneLocked(now time.Time) {
+	today := now.UTC().Format(visitorDateLayout)
+	if c.prunedAt == today {
+		return
+	}
+	c.prunedAt = today
+
+	cutoff := now.Add(-visitorDailyRetention).UTC().Format(visitorDateLayout)
+	for key := range c.sketches {
+		// Key theo ngày có dạng visitors:<id>:<YYYY-MM-DD>, ngày so sánh được như chuỗi
+		i := strings.LastIndexByte(key, ':')
+		if i > len(visitorKeyPrefix) && key[i+1:] < cutoff {
+			delete(c.sketches, key)
+		}
+	}
+}
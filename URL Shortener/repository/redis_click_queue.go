@@ -0,0 +1,474 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// clickStream là Redis Stream chứa click events dùng chung giữa các replica
+	clickStream = "url-shortener:clicks"
+	// clickDeadLetterStream chứa các click không xử lý được (payload hỏng, giao quá nhiều lần)
+	clickDeadLetterStream = "url-shortener:clicks:dead"
+	// clickConsumerGroup là consumer group của các click worker
+	clickConsumerGroup = "click-workers"
+	// maxBlockSlice giới hạn mỗi lần chờ XREADGROUP để worker dừng kịp khi tắt server
+	maxBlockSlice = time.Second
+	// maxStreamPushBatch là số click tối đa được XADD trong một round trip
+	maxStreamPushBatch = 100
+)
+
+// ErrClickStreamUnavailable được trả về khi Redis lỗi, click bị bỏ ngay thay vì chờ timeout
+var ErrClickStreamUnavailable = errors.New("click stream unavailable")
+
+// RedisStreamClickQueue là click queue trên Redis Stream với consumer group
+//
+// Click nhận ở replica nào cũng được ghi vào stream chung và worker của bất kỳ replica nào
+// cũng có thể xử lý. Message đã giao nhưng chưa Ack quá claimTimeout (replica chết giữa chừng)
+// được consumer khác nhận lại; message giao quá maxDeliveries lần hoặc không đọc được
+// bị chuyển sang dead-letter stream để không chặn queue.
+//
+// Push không gọi Redis: click được đưa vào buffer trong process (tối đa QueueSize) và một
+// goroutine nền XADD theo batch, nên redirect không phải chờ Redis chậm. Khi XADD lỗi, queue
+// chuyển sang trạng thái unavailable: Push trả lỗi ngay (click bị bỏ) và goroutine nền thử
+// ghi lại batch lỗi mỗi retryInterval cho tới khi Redis sống lại
+type RedisStreamClickQueue struct {
+	redis         *database.RedisClient
+	consumer      string
+	maxLen        int64
+	claimTimeout  time.Duration
+	maxDeliveries int64
+	retryInterval time.Duration
+
+	buffer    chan *models.ClickEvent
+	quit      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	groupReady  bool
+	lastReclaim time.Time
+	closed      bool
+	down        bool
+	lastError   string
+	failovers   uint64
+
+	reclaimed    uint64
+	deadLettered uint64
+	lost         uint64 // Click trong buffer chưa ghi được khi đóng queue
+}
+
+// NewRedisStreamClickQueue tạo queue trên Redis Stream và khởi động goroutine ghi click vào stream
+// Consumer group được tạo ngay nếu Redis sẵn sàng, nếu không thì tạo lại ở lần đọc sau
+func NewRedisStreamClickQueue(redisClient *database.RedisClient, cfg config.AnalyticsConfig, retryInterval time.Duration) *RedisStreamClickQueue {
+	id := make([]byte, 4)
+	rand.Read(id)
+	hostname, _ := os.Hostname()
+
+	q := &RedisStreamClickQueue{
+		redis:         redisClient,
+		consumer:      hostname + "-" + hex.EncodeToString(id),
+		maxLen:        cfg.StreamMaxLen,
+		claimTimeout:  cfg.StreamClaimTimeout,
+		maxDeliveries: int64(cfg.StreamMaxDeliveries),
+		retryInterval: retryInterval,
+		quit:          make(chan struct{}),
+	}
+	if q.claimTimeout <= 0 {
+		q.claimTimeout = time.Minute
+	}
+	if q.maxDeliveries <= 0 {
+		q.maxDeliveries = 5
+	}
+	if q.retryInterval <= 0 {
+		q.retryInterval = 5 * time.Second
+	}
+	bufferSize := cfg.QueueSize
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	q.buffer = make(chan *models.ClickEvent, bufferSize)
+
+	if err := q.ensureGroup(context.Background()); err != nil {
+		log.Printf("⚠️ Click stream unavailable, retrying on next read: %v", err)
+	}
+
+	q.wg.Add(1)
+	go q.pushLoop()
+	return q
+}
+
+// Push đưa event vào buffer để ghi vào stream (non-blocking)
+// Trả lỗi ngay khi Redis đang lỗi hoặc buffer đầy
+func (q *RedisStreamClickQueue) Push(event *models.ClickEvent) error {
+	q.mu.Lock()
+	closed, down := q.closed, q.down
+	q.mu.Unlock()
+
+	if closed {
+		return errors.New("click stream queue is closed")
+	}
+	if down {
+		return ErrClickStreamUnavailable
+	}
+
+	select {
+	case q.buffer <- event:
+		return nil
+	default:
+		return errors.New("click stream buffer is full")
+	}
+}
+
+// Pop nhận lại các message bị bỏ dở quá claimTimeout, sau đó đọc message mới cho consumer này
+func (q *RedisStreamClickQueue) Pop(ctx context.Context, max int, wait time.Duration) (*models.ClickBatch, error) {
+	batch := &models.ClickBatch{}
+
+	if err := q.ensureGroup(ctx); err != nil {
+		return batch, err
+	}
+
+	if q.shouldReclaim() {
+		messages, err := q.reclaim(ctx, max)
+		if err != nil {
+			log.Printf("Warning: failed to reclaim stale click events: %v", err)
+		}
+		q.appendMessages(ctx, batch, messages)
+		if len(batch.Events) > 0 {
+			return batch, nil
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		// Chờ từng đoạn ngắn vì lệnh đang block không bị hủy theo ctx
+		block := time.Duration(-1)
+		if wait > 0 {
+			block = time.Until(deadline)
+			if block > maxBlockSlice {
+				block = maxBlockSlice
+			}
+			if block < time.Millisecond {
+				return batch, nil
+			}
+		}
+
+		messages, err := q.redis.XReadGroup(ctx, clickStream, clickConsumerGroup, q.consumer, int64(max), block)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// Stream bị xóa (ví dụ Redis restart không persist), tạo lại group ở lần đọc sau
+				q.mu.Lock()
+				q.groupReady = false
+				q.mu.Unlock()
+			}
+			return batch, fmt.Errorf("failed to read click stream: %w", err)
+		}
+
+		q.appendMessages(ctx, batch, messages)
+		if len(batch.Events) > 0 || wait <= 0 {
+			return batch, nil
+		}
+		if ctx.Err() != nil {
+			return batch, ctx.Err()
+		}
+	}
+}
+
+// Ack xác nhận và xóa các message đã ghi vào database khỏi stream
+func (q *RedisStreamClickQueue) Ack(batch *models.ClickBatch) error {
+	if len(batch.IDs) == 0 {
+		return nil
+	}
+	if err := q.redis.XAckDel(context.Background(), clickStream, clickConsumerGroup, batch.IDs...); err != nil {
+		return fmt.Errorf("failed to ack click events: %w", err)
+	}
+	return nil
+}
+
+// Renew nhận lại các message của batch cho chính consumer này (XCLAIM JUSTID) để đặt lại thời gian idle
+// Worker gọi khi đang thử ghi lại batch lúc database lỗi: nếu không, consumer khác sẽ nhận lại
+// các message quá claimTimeout, tăng số lần giao và cuối cùng chuyển click hợp lệ sang dead-letter
+func (q *RedisStreamClickQueue) Renew(batch *models.ClickBatch) error {
+	if len(batch.IDs) == 0 {
+		return nil
+	}
+	if err := q.redis.XClaimJustID(context.Background(), clickStream, clickConsumerGroup, q.consumer, batch.IDs); err != nil {
+		return fmt.Errorf("failed to renew click events: %w", err)
+	}
+	return nil
+}
+
+// Len trả về số message còn trong stream (chưa xử lý hoặc đang xử lý ở mọi replica)
+// cộng số click còn trong buffer của replica này
+func (q *RedisStreamClickQueue) Len() int {
+	length, err := q.redis.XLen(context.Background(), clickStream)
+	if err != nil {
+		return len(q.buffer)
+	}
+	return int(length) + len(q.buffer)
+}
+
+// GetStats trả về thống kê của stream và consumer group
+func (q *RedisStreamClickQueue) GetStats() map[string]interface{} {
+	ctx := context.Background()
+	stats := map[string]interface{}{
+		"type":           "redis_stream",
+		"stream":         clickStream,
+		"group":          clickConsumerGroup,
+		"consumer":       q.consumer,
+		"claim_timeout":  q.claimTimeout.String(),
+		"max_deliveries": q.maxDeliveries,
+		"reclaimed":      atomic.LoadUint64(&q.reclaimed),
+		"dead_lettered":  atomic.LoadUint64(&q.deadLettered),
+		"buffered":       len(q.buffer),
+		"lost":           atomic.LoadUint64(&q.lost),
+	}
+
+	q.mu.Lock()
+	stats["available"] = !q.down
+	stats["failovers"] = q.failovers
+	if q.lastError != "" {
+		stats["last_error"] = q.lastError
+	}
+	q.mu.Unlock()
+
+	if length, err := q.redis.XLen(ctx, clickStream); err == nil {
+		stats["length"] = length
+	}
+	if pending, err := q.redis.XPendingCount(ctx, clickStream, clickConsumerGroup); err == nil {
+		stats["pending"] = pending
+	}
+	if dead, err := q.redis.XLen(ctx, clickDeadLetterStream); err == nil {
+		stats["dead_letter_length"] = dead
+	}
+	return stats
+}
+
+// Close ngừng nhận click và ghi nốt buffer vào stream (một lần thử nếu Redis đang sống)
+// Message chưa Ack nằm lại trong stream và được consumer khác nhận lại
+func (q *RedisStreamClickQueue) Close() error {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+
+		close(q.quit)
+		q.wg.Wait()
+	})
+
+	if lost := atomic.LoadUint64(&q.lost); lost > 0 {
+		return fmt.Errorf("%d click events could not be added to the stream", lost)
+	}
+	return nil
+}
+
+// pushLoop lấy click từ buffer và XADD theo batch vào stream
+// Batch lỗi được giữ lại và thử lại mỗi retryInterval, trong thời gian đó Push bỏ click mới
+func (q *RedisStreamClickQueue) pushLoop() {
+	defer q.wg.Done()
+
+	for {
+		var events []*models.ClickEvent
+		select {
+		case <-q.quit:
+			q.flushBuffer()
+			return
+		case event := <-q.buffer:
+			events = q.collect(event)
+		}
+
+		for !q.add(events) {
+			select {
+			case <-q.quit:
+				atomic.AddUint64(&q.lost, uint64(len(events)+len(q.buffer)))
+				return
+			case <-time.After(q.retryInterval):
+			}
+		}
+	}
+}
+
+// collect gom thêm các click đang chờ trong buffer (không chờ) vào batch
+func (q *RedisStreamClickQueue) collect(first *models.ClickEvent) []*models.ClickEvent {
+	events := []*models.ClickEvent{first}
+	for len(events) < maxStreamPushBatch {
+		select {
+		case event := <-q.buffer:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+// flushBuffer ghi các click còn trong buffer khi đóng queue
+func (q *RedisStreamClickQueue) flushBuffer() {
+	for len(q.buffer) > 0 {
+		events := q.collect(<-q.buffer)
+		if !q.add(events) {
+			atomic.AddUint64(&q.lost, uint64(len(events)+len(q.buffer)))
+			return
+		}
+	}
+}
+
+// add XADD một batch vào stream và cập nhật trạng thái của Redis, trả về false nếu lỗi
+func (q *RedisStreamClickQueue) add(events []*models.ClickEvent) bool {
+	messages := make([]map[string]interface{}, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Warning: failed to encode click event for %s: %v", event.ShortCode, err)
+			continue
+		}
+		messages = append(messages, map[string]interface{}{"event": payload})
+	}
+
+	// Chạy nền nên không có request context, timeout của Redis client giới hạn thời gian chờ
+	err := q.redis.XAddPipelined(context.Background(), clickStream, q.maxLen, messages)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err != nil {
+		q.lastError = err.Error()
+		if !q.down {
+			q.down = true
+			q.failovers++
+			log.Printf("⚠️ Click stream unavailable, dropping new clicks until Redis recovers: %v", err)
+		}
+		return false
+	}
+	if q.down {
+		q.down = false
+		log.Printf("✅ Click stream available again")
+	}
+	return true
+}
+
+// ensureGroup tạo consumer group nếu chưa có
+func (q *RedisStreamClickQueue) ensureGroup(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.groupReady {
+		return nil
+	}
+	if err := q.redis.XGroupCreate(ctx, clickStream, clickConsumerGroup); err != nil {
+		return fmt.Errorf("failed to create click consumer group: %w", err)
+	}
+	q.groupReady = true
+	return nil
+}
+
+// shouldReclaim giới hạn việc quét message bị bỏ dở tối đa hai lần mỗi claimTimeout
+func (q *RedisStreamClickQueue) shouldReclaim() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if time.Since(q.lastReclaim) < q.claimTimeout/2 {
+		return false
+	}
+	q.lastReclaim = time.Now()
+	return true
+}
+
+// reclaim nhận các message chưa Ack quá claimTimeout, chuyển message giao quá nhiều lần sang dead-letter
+func (q *RedisStreamClickQueue) reclaim(ctx context.Context, max int) ([]redis.XMessage, error) {
+	pending, err := q.redis.XPendingIdle(ctx, clickStream, clickConsumerGroup, q.claimTimeout, int64(max))
+	if err != nil {
+		return nil, err
+	}
+
+	var claimIDs []string
+	for _, entry := range pending {
+		if entry.RetryCount >= q.maxDeliveries {
+			q.deadLetter(ctx, entry.ID, nil, fmt.Sprintf("delivered %d times without ack", entry.RetryCount))
+			continue
+		}
+		claimIDs = append(claimIDs, entry.ID)
+	}
+	if len(claimIDs) == 0 {
+		return nil, nil
+	}
+
+	messages, err := q.redis.XClaim(ctx, clickStream, clickConsumerGroup, q.consumer, q.claimTimeout, claimIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 {
+		atomic.AddUint64(&q.reclaimed, uint64(len(messages)))
+		log.Printf("♻️ Reclaimed %d click events abandoned by other consumers", len(messages))
+	}
+	return messages, nil
+}
+
+// appendMessages giải mã message vào batch, message không đọc được bị chuyển sang dead-letter
+func (q *RedisStreamClickQueue) appendMessages(ctx context.Context, batch *models.ClickBatch, messages []redis.XMessage) {
+	for i := range messages {
+		message := &messages[i]
+
+		payload, ok := message.Values["event"].(string)
+		if !ok {
+			q.deadLetter(ctx, message.ID, message, "missing event field")
+			continue
+		}
+
+		var event models.ClickEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			q.deadLetter(ctx, message.ID, message, "invalid payload: "+err.Error())
+			continue
+		}
+
+		batch.Events = append(batch.Events, &event)
+		batch.IDs = append(batch.IDs, message.ID)
+	}
+}
+
+// deadLetter chép message sang dead-letter stream rồi xóa khỏi stream chính
+// message = nil thì đọc lại từ stream theo id
+func (q *RedisStreamClickQueue) deadLetter(ctx context.Context, id string, message *redis.XMessage, reason string) {
+	if message == nil {
+		found, err := q.redis.XGet(ctx, clickStream, id)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("Warning: failed to read click event %s for dead-letter: %v", id, err)
+			return
+		}
+		message = found
+	}
+
+	if message != nil {
+		values := map[string]interface{}{"id": id, "reason": reason}
+		for key, value := range message.Values {
+			values[key] = value
+		}
+		if _, err := q.redis.XAdd(ctx, clickDeadLetterStream, q.maxLen, values); err != nil {
+			log.Printf("Warning: failed to dead-letter click event %s: %v", id, err)
+			return
+		}
+	}
+
+	if err := q.redis.XAckDel(ctx, clickStream, clickConsumerGroup, id); err != nil {
+		log.Printf("Warning: failed to remove dead-lettered click event %s: %v", id, err)
+		return
+	}
+	atomic.AddUint64(&q.deadLettered, 1)
+	log.Printf("⚠️ Click event %s moved to %s: %s", id, clickDeadLetterStream, reason)
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/models"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testRedisClock là đồng hồ của miniredis, tiến tay để message trở thành idle
+type testRedisClock struct {
+	server *miniredis.Miniredis
+	now    time.Time
+}
+
+// newTestStreamQueues tạo hai consumer (hai replica) đọc chung click stream trên miniredis
+func newTestStreamQueues(t *testing.T, maxDeliveries int) (*RedisStreamClickQueue, *RedisStreamClickQueue, *database.RedisClient, *testRedisClock) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	clock := &testRedisClock{server: server, now: time.Now()}
+	server.SetTime(clock.now)
+	client := database.ConnectRedis(config.RedisConfig{Host: server.Host(), Port: server.Port(), Timeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := config.AnalyticsConfig{QueueSize: 100, StreamMaxLen: 1000, StreamClaimTimeout: time.Minute, StreamMaxDeliveries: maxDeliveries}
+	queue := NewRedisStreamClickQueue(client, cfg, 10*time.Millisecond)
+	other := NewRedisStreamClickQueue(client, cfg, 10*time.Millisecond)
+	t.Cleanup(func() {
+		queue.Close()
+		other.Close()
+	})
+	return queue, other, client, clock
+}
+
+// waitForStream chờ goroutine nền ghi click từ buffer vào stream cho tới khi stream dài n
+func waitForStream(t *testing.T, client *database.RedisClient, n int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		length, _ := client.XLen(context.Background(), clickStream)
+		if length == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream length = %d, want %d", length, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// popAfter tiến đồng hồ của Redis thêm d rồi đọc từ queue, luôn quét message bị bỏ dở
+func popAfter(t *testing.T, clock *testRedisClock, q *RedisStreamClickQueue, d time.Duration) *models.ClickBatch {
+	t.Helper()
+
+	clock.now = clock.now.Add(d)
+	clock.server.SetTime(clock.now)
+	q.mu.Lock()
+	q.lastReclaim = time.Time{}
+	q.mu.Unlock()
+
+	batch, err := q.Pop(context.Background(), 10, 0)
+	if err != nil {
+		t.Fatalf("Pop returned error: %v", err)
+	}
+	return batch
+}
+
+// TestRedisStreamClickQueue tests push, pop and ack through the shared stream
+func TestRedisStreamClickQueue(t *testing.T) {
+	ctx := context.Background()
+	queue, other, client, _ := newTestStreamQueues(t, 5)
+
+	for _, code := range []string{"abc123", "def456", "ghi789"} {
+		if err := queue.Push(&models.ClickEvent{URLID: 1, ShortCode: code, IPAddress: "10.0.0.1"}); err != nil {
+			t.Fatalf("Push returned error: %v", err)
+		}
+	}
+	waitForStream(t, client, 3)
+
+	batch, err := queue.Pop(ctx, 2, 0)
+	if err != nil || len(batch.Events) != 2 || len(batch.IDs) != 2 || batch.Events[0].ShortCode != "abc123" {
+		t.Fatalf("Pop = (%+v, %v), want the first 2 events", batch, err)
+	}
+
+	// Replica khác nhận phần còn lại, không nhận lại message đang được xử lý
+	rest, err := other.Pop(ctx, 10, 0)
+	if err != nil || len(rest.Events) != 1 || rest.Events[0].ShortCode != "ghi789" {
+		t.Fatalf("Pop on another consumer = (%+v, %v)", rest, err)
+	}
+
+	if queue.Len() != 3 {
+		t.Errorf("Len before ack = %d, want 3", queue.Len())
+	}
+	if err := queue.Ack(batch); err != nil {
+		t.Fatalf("Ack returned error: %v", err)
+	}
+	other.Ack(rest)
+	if queue.Len() != 0 {
+		t.Errorf("Len after ack = %d, want 0", queue.Len())
+	}
+
+	// Hết thời gian chờ mà không có message thì trả về batch rỗng
+	empty, err := queue.Pop(ctx, 10, 10*time.Millisecond)
+	if err != nil || len(empty.Events) != 0 {
+		t.Errorf("Pop on empty stream = (%+v, %v)", empty, err)
+	}
+}
+
+// TestRedisStreamClickQueue_ReclaimAndDeadLetter tests abandoned messages are reclaimed
+// and moved to the dead-letter stream after too many deliveries
+func TestRedisStreamClickQueue_ReclaimAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	queue, other, client, clock := newTestStreamQueues(t, 3)
+
+	queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "abc123"})
+	waitForStream(t, client, 1)
+	client.XAdd(ctx, clickStream, 1000, map[string]interface{}{"event": "{not json"})
+
+	batch, _ := queue.Pop(ctx, 10, 0)
+	if len(batch.Events) != 1 {
+		t.Fatalf("Pop = %+v, want the valid event only", batch)
+	}
+	if dead, _ := client.XLen(ctx, clickDeadLetterStream); dead != 1 {
+		t.Errorf("dead-letter length = %d, want the invalid payload", dead)
+	}
+
+	// Chưa quá claimTimeout thì không ai nhận lại
+	if reclaimed := popAfter(t, clock, other, 30*time.Second); len(reclaimed.Events) != 0 {
+		t.Errorf("Reclaimed %+v before the claim timeout", reclaimed)
+	}
+
+	// Replica giữ batch chết: consumer khác nhận lại sau claimTimeout
+	reclaimed := popAfter(t, clock, other, time.Minute)
+	if len(reclaimed.Events) != 1 || reclaimed.IDs[0] != batch.IDs[0] {
+		t.Fatalf("Reclaimed %+v, want the abandoned event", reclaimed)
+	}
+	if stats := other.GetStats(); stats["reclaimed"] != uint64(1) {
+		t.Errorf("reclaimed = %v, want 1", stats["reclaimed"])
+	}
+
+	// Giao lần thứ 3 vẫn chưa Ack thì chuyển sang dead-letter thay vì chặn queue
+	popAfter(t, clock, queue, 2*time.Minute)
+	if dropped := popAfter(t, clock, other, 2*time.Minute); len(dropped.Events) != 0 {
+		t.Errorf("Pop = %+v, want the event dead-lettered", dropped)
+	}
+	if dead, _ := client.XLen(ctx, clickDeadLetterStream); dead != 2 {
+		t.Errorf("dead-letter length = %d, want 2", dead)
+	}
+	if queue.Len() != 0 {
+		t.Errorf("Len = %d, want dead-lettered events removed from the stream", queue.Len())
+	}
+}
+
+// TestRedisStreamClickQueue_Renew tests a batch that is being retried is not reclaimed
+// or dead-lettered by other consumers however long the retries take
+func TestRedisStreamClickQueue_Renew(t *testing.T) {
+	ctx := context.Background()
+	queue, other, client, clock := newTestStreamQueues(t, 2)
+
+	queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "abc123"})
+	waitForStream(t, client, 1)
+	batch, _ := queue.Pop(ctx, 10, 0)
+
+	// Database lỗi trong 5 phút, worker thử lại và gia hạn batch mỗi 30 giây
+	for i := 0; i < 10; i++ {
+		if err := queue.Renew(batch); err != nil {
+			t.Fatalf("Renew returned error: %v", err)
+		}
+		if stolen := popAfter(t, clock, other, 30*time.Second); len(stolen.Events) != 0 {
+			t.Fatalf("Pop on another consumer = %+v, want the renewed batch left alone", stolen)
+		}
+	}
+
+	if dead, _ := client.XLen(ctx, clickDeadLetterStream); dead != 0 {
+		t.Errorf("dead-letter length = %d, want no dead-lettered clicks", dead)
+	}
+	if err := queue.Ack(batch); err != nil || queue.Len() != 0 {
+		t.Errorf("Ack = %v, Len = %d, want the batch acked", err, queue.Len())
+	}
+}
+
+// TestRedisStreamClickQueue_PushWhileRedisDown tests Push never waits on Redis: clicks are dropped
+// right away while the stream is unavailable and accepted again once Redis recovers
+func TestRedisStreamClickQueue_PushWhileRedisDown(t *testing.T) {
+	queue, _, client, clock := newTestStreamQueues(t, 5)
+
+	clock.server.Close()
+	queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "abc123"})
+
+	// Click được nhận trước khi lần XADD đầu tiên lỗi vẫn nằm trong buffer chờ ghi lại
+	accepted := int64(1)
+	deadline := time.Now().Add(time.Second)
+	for queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "def456"}) != ErrClickStreamUnavailable {
+		accepted++
+		if time.Now().After(deadline) {
+			t.Fatalf("Push kept accepting clicks while Redis is down")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if err := queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "ghi789"}); err != ErrClickStreamUnavailable {
+		t.Errorf("Push while Redis is down = %v, want ErrClickStreamUnavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Push took %v while Redis is down, want it to fail fast", elapsed)
+	}
+	if stats := queue.GetStats(); stats["available"] != false {
+		t.Errorf("available = %v, want false", stats["available"])
+	}
+
+	// Redis sống lại: click giữ lại được ghi và Push nhận click mới
+	if err := clock.server.Restart(); err != nil {
+		t.Fatalf("Restart returned error: %v", err)
+	}
+	deadline = time.Now().Add(time.Second)
+	for queue.Push(&models.ClickEvent{URLID: 1, ShortCode: "jkl012"}) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Push still failing after Redis recovered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitForStream(t, client, accepted+1)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+
+	"url-shortener/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// invalidationChannel là channel pub/sub dùng chung giữa các replica
+const invalidationChannel = "url-shortener:cache-invalidation"
+
+// RedisInvalidationBus đồng bộ việc xóa cache local giữa các replica qua Redis pub/sub
+// Message có dạng "<instance id>|<short code>" để replica bỏ qua message do chính nó gửi
+type RedisInvalidationBus struct {
+	redis      *database.RedisClient
+	instanceID string
+	pubsub     *redis.PubSub
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// NewRedisInvalidationBus tạo instance mới của RedisInvalidationBus
+func NewRedisInvalidationBus(redis *database.RedisClient) *RedisInvalidationBus {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &RedisInvalidationBus{
+		redis:      redis,
+		instanceID: hex.EncodeToString(id),
+	}
+}
+
+// Publish báo cho các replica khác xóa short code khỏi cache local
+func (b *RedisInvalidationBus) Publish(ctx context.Context, shortCode string) error {
+	return b.redis.Publish(ctx, invalidationChannel, b.instanceID+"|"+shortCode)
+}
+
+// Subscribe bắt đầu nhận thông báo trong một goroutine riêng
+func (b *RedisInvalidationBus) Subscribe(handler func(shortCode string)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pubsub != nil {
+		return nil
+	}
+
+	// Subscription sống suốt vòng đời process, dừng bằng Close
+	ctx := context.Background()
+	pubsub := b.redis.Subscribe(ctx, invalidationChannel)
+	// Chờ Redis xác nhận subscribe để không bỏ lỡ message ngay sau khi khởi động.
+	// Nếu Redis chưa sẵn sàng, pubsub tự kết nối lại và subscribe lại ở nền
+	if _, err := pubsub.Receive(ctx); err != nil {
+		log.Printf("⚠️ Cache invalidation channel unavailable, retrying in background: %v", err)
+	}
+	b.pubsub = pubsub
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		for msg := range pubsub.Channel() {
+			sender, shortCode, ok := strings.Cut(msg.Payload, "|")
+			if !ok {
+				log.Printf("⚠️ Invalid cache invalidation message: %q", msg.Payload)
+				continue
+			}
+			if sender == b.instanceID {
+				continue
+			}
+			handler(shortCode)
+		}
+	}()
+
+	return nil
+}
+
+// Close hủy subscribe và chờ goroutine nhận message kết thúc
+func (b *RedisInvalidationBus) Close() error {
+	b.mu.Lock()
+	pubsub := b.pubsub
+	b.pubsub = nil
+	b.mu.Unlock()
+
+	if pubsub == nil {
+		return nil
+	}
+
+	err := pubsub.Close()
+	b.wg.Wait()
+	return err
+}
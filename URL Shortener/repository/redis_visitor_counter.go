@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"url-shortener/database"
+	"url-shortener/models"
+)
+
+// RedisVisitorCounter đếm người xem duy nhất bằng HyperLogLog của Redis (PFADD/PFCOUNT)
+// Mỗi link có một key tổng và một key cho mỗi ngày, dùng chung giữa các replica
+type RedisVisitorCounter struct {
+	redis   *database.RedisClient
+	salt    string
+	timeout time.Duration // Thời gian tối đa của mỗi lệnh Redis (0 = không giới hạn)
+}
+
+// NewRedisVisitorCounter tạo bộ đếm người xem trên Redis
+func NewRedisVisitorCounter(redis *database.RedisClient, salt string, timeout time.Duration) *RedisVisitorCounter {
+	return &RedisVisitorCounter{
+		redis:   redis,
+		salt:    salt,
+		timeout: timeout,
+	}
+}
+
+// Add thêm người xem của các click vào key tổng và key theo ngày trong một round trip
+func (c *RedisVisitorCounter) Add(ctx context.Context, events []*models.ClickEvent) error {
+	visits := countableVisits(c.salt, events)
+	if len(visits) == 0 {
+		return nil
+	}
+
+	// Gộp theo key để mỗi key chỉ cần một lệnh PFADD
+	index := make(map[string]int)
+	var items []database.HLLItem
+	add := func(key string, expiration time.Duration, id string) {
+		i, ok := index[key]
+		if !ok {
+			i = len(items)
+			index[key] = i
+			items = append(items, database.HLLItem{Key: key, Expiration: expiration})
+		}
+		items[i].Elements = append(items[i].Elements, id)
+	}
+	for _, v := range visits {
+		id := v.id()
+		add(visitorTotalKey(v.urlID), 0, id)
+		add(visitorDailyKey(v.urlID, v.date), visitorDailyRetention, id)
+	}
+
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.redis.PFAddPipelined(ctx, items)
+}
+
+// Count đếm người xem từ trước tới nay và của từng ngày trong một round trip
+func (c *RedisVisitorCounter) Count(ctx context.Context, urlID uint, dates []string) (int64, map[string]int64, error) {
+	keys := make([]string, 0, len(dates)+1)
+	keys = append(keys, visitorTotalKey(urlID))
+	for _, date := range dates {
+		keys = append(keys, visitorDailyKey(urlID, date))
+	}
+
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	counts, err := c.redis.PFCountEach(ctx, keys)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	byDate := make(map[string]int64, len(dates))
+	for i, date := range dates {
+		byDate[date] = counts[i+1]
+	}
+	return counts[0], byDate, nil
+}
+
+// GetStats trả về loại bộ đếm
+func (c *RedisVisitorCounter) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"backend": "redis",
+	}
+}
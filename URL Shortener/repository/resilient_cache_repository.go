@@ -0,0 +1,386 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/interfaces"
+	"url-shortener/models"
+)
+
+// ErrCacheUnavailable được trả về khi mạch đang ngắt và lệnh không thể bỏ qua một cách im lặng
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// maxPendingInvalidations giới hạn số short code cần xóa khỏi Redis khi kết nối lại
+const maxPendingInvalidations = 100000
+
+// ResilientCacheRepository bọc cache bằng circuit breaker để service vẫn chạy khi Redis lỗi
+//
+// Sau BreakerThreshold lỗi liên tiếp, mạch ngắt: mọi lệnh bỏ qua Redis (Get trả về cache miss)
+// nên redirect đi thẳng tới database mà không phải chờ timeout. Một goroutine nền ping Redis
+// theo chu kỳ và đóng mạch khi Redis sống lại.
+//
+// Các short code được ghi/xóa trong lúc Redis lỗi được ghi nhớ và xóa khỏi Redis trước khi
+// đóng mạch, để Redis không trả về destination cũ sau khi kết nối lại. Quá maxPendingInvalidations
+// short code thì không còn biết key nào đã cũ nên toàn bộ URL bị xóa khỏi Redis (cache phải nạp lại)
+type ResilientCacheRepository struct {
+	cache            interfaces.CacheRepository
+	ping             func(ctx context.Context) error
+	failureThreshold int
+	retryInterval    time.Duration
+
+	mu              sync.Mutex
+	open            bool
+	failures        int
+	lastError       string
+	openedAt        time.Time
+	trips           uint64
+	skipped         uint64
+	pending         map[string]struct{}
+	pendingOverflow bool
+	onRecover       func()
+
+	wg        sync.WaitGroup
+	quit      chan struct{}
+	isRunning bool
+}
+
+// NewResilientCacheRepository tạo cache có circuit breaker
+// ping dùng để kiểm tra Redis đã sống lại chưa khi mạch đang ngắt
+func NewResilientCacheRepository(
+	cache interfaces.CacheRepository,
+	ping func(ctx context.Context) error,
+	failureThreshold int,
+	retryInterval time.Duration,
+) *ResilientCacheRepository {
+	if failureThreshold <= 0 {
+		failureThreshold = 1
+	}
+
+	return &ResilientCacheRepository{
+		cache:            cache,
+		ping:             ping,
+		failureThreshold: failureThreshold,
+		retryInterval:    retryInterval,
+		pending:          make(map[string]struct{}),
+		quit:             make(chan struct{}),
+	}
+}
+
+// Start khởi động goroutine kết nối lại Redis
+func (r *ResilientCacheRepository) Start() {
+	r.mu.Lock()
+	if r.isRunning {
+		r.mu.Unlock()
+		return
+	}
+	r.isRunning = true
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// Stop dừng goroutine kết nối lại Redis
+func (r *ResilientCacheRepository) Stop() {
+	r.mu.Lock()
+	if !r.isRunning {
+		r.mu.Unlock()
+		return
+	}
+	r.isRunning = false
+	r.mu.Unlock()
+
+	close(r.quit)
+	r.wg.Wait()
+}
+
+// Trip ngắt mạch ngay, dùng khi không kết nối được Redis lúc khởi động
+func (r *ResilientCacheRepository) Trip(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tripLocked(err)
+}
+
+// OnRecover đăng ký hàm được gọi (trong goroutine riêng) mỗi khi Redis kết nối lại
+func (r *ResilientCacheRepository) OnRecover(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onRecover = fn
+}
+
+// Healthy trả về false khi mạch đang ngắt (service chạy ở chế độ degraded)
+func (r *ResilientCacheRepository) Healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !r.open
+}
+
+// Set lưu URL vào cache
+// Khi Redis lỗi, short code được ghi nhớ để xóa khỏi Redis sau khi kết nối lại
+func (r *ResilientCacheRepository) Set(ctx context.Context, shortCode string, entry *models.CachedURL) error {
+	if !r.allow() {
+		r.addPending(shortCode)
+		return nil
+	}
+
+	err := r.cache.Set(ctx, shortCode, entry)
+	r.record(err)
+	if err != nil {
+		r.addPending(shortCode)
+	}
+	return err
+}
+
+// SetIfAbsent chỉ lưu URL nếu cache chưa có key, bỏ qua khi mạch đang ngắt
+func (r *ResilientCacheRepository) SetIfAbsent(ctx context.Context, shortCode string, entry *models.CachedURL) (bool, error) {
+	if !r.allow() {
+		return false, nil
+	}
+
+	stored, err := r.cache.SetIfAbsent(ctx, shortCode, entry)
+	r.record(err)
+	return stored, err
+}
+
+// SetManyIfAbsent lưu nhiều URL, trả về ErrCacheUnavailable khi mạch đang ngắt
+func (r *ResilientCacheRepository) SetManyIfAbsent(ctx context.Context, entries map[string]*models.CachedURL) (int, error) {
+	if !r.allow() {
+		return 0, ErrCacheUnavailable
+	}
+
+	stored, err := r.cache.SetManyIfAbsent(ctx, entries)
+	r.record(err)
+	return stored, err
+}
+
+// Get lấy URL từ cache, trả về cache miss khi mạch đang ngắt
+func (r *ResilientCacheRepository) Get(ctx context.Context, shortCode string) (*models.CachedURL, error) {
+	if !r.allow() {
+		return nil, ErrCacheMiss
+	}
+
+	entry, err := r.cache.Get(ctx, shortCode)
+	r.record(err)
+	return entry, err
+}
+
+// Delete xóa URL khỏi cache
+// Khi Redis lỗi, việc xóa được hoãn tới lúc kết nối lại nên không trả về lỗi
+func (r *ResilientCacheRepository) Delete(ctx context.Context, shortCode string) error {
+	if !r.allow() {
+		r.addPending(shortCode)
+		return nil
+	}
+
+	err := r.cache.Delete(ctx, shortCode)
+	r.record(err)
+	if err != nil {
+		log.Printf("Warning: cache delete for %s deferred until Redis recovers: %v", shortCode, err)
+		r.addPending(shortCode)
+	}
+	return nil
+}
+
+// Exists kiểm tra URL có trong cache không
+func (r *ResilientCacheRepository) Exists(ctx context.Context, shortCode string) (bool, error) {
+	if !r.allow() {
+		return false, nil
+	}
+
+	exists, err := r.cache.Exists(ctx, shortCode)
+	r.record(err)
+	return exists, err
+}
+
+// GetStats trả về trạng thái circuit breaker
+func (r *ResilientCacheRepository) GetStats() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := "closed"
+	if r.open {
+		state = "open"
+	}
+
+	stats := map[string]interface{}{
+		"breaker_state":         state,
+		"consecutive_failures":  r.failures,
+		"trips":                 r.trips,
+		"skipped_calls":         r.skipped,
+		"pending_invalidations": len(r.pending),
+	}
+	if r.open {
+		stats["open_since"] = r.openedAt.Format(time.RFC3339)
+		stats["last_error"] = r.lastError
+	}
+	return stats
+}
+
+// allow trả về false khi mạch đang ngắt
+func (r *ResilientCacheRepository) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.open {
+		r.skipped++
+		return false
+	}
+	return true
+}
+
+// record cập nhật bộ đếm lỗi sau mỗi lệnh Redis
+// Cache miss không tính là lỗi; request bị client hủy cũng không phải lỗi của Redis
+func (r *ResilientCacheRepository) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || errors.Is(err, ErrCacheMiss) {
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.failures >= r.failureThreshold && !r.open {
+		r.tripLocked(err)
+	}
+}
+
+// tripLocked ngắt mạch, caller phải giữ mu
+func (r *ResilientCacheRepository) tripLocked(err error) {
+	if r.open {
+		return
+	}
+	r.open = true
+	r.openedAt = time.Now()
+	r.trips++
+	if err != nil {
+		r.lastError = err.Error()
+	}
+	log.Printf("⚠️ Redis unavailable, serving without cache (degraded mode): %v", err)
+}
+
+// addPending ghi nhớ short code cần xóa khỏi Redis khi kết nối lại
+func (r *ResilientCacheRepository) addPending(shortCode string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) >= maxPendingInvalidations {
+		r.pendingOverflow = true
+		return
+	}
+	r.pending[shortCode] = struct{}{}
+}
+
+// loop định kỳ thử kết nối lại Redis và xóa các key đã cũ
+func (r *ResilientCacheRepository) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+			r.recover()
+		}
+	}
+}
+
+// recover ping Redis khi mạch đang ngắt, xóa các key đã cũ rồi đóng mạch
+// Cũng dọn các key còn tồn đọng khi lỗi xảy ra nhưng chưa đủ ngưỡng ngắt mạch
+func (r *ResilientCacheRepository) recover() {
+	r.mu.Lock()
+	open := r.open
+	hasPending := len(r.pending) > 0
+	r.mu.Unlock()
+
+	if !open && !hasPending {
+		return
+	}
+
+	// Chạy nền nên không có request context, timeout của Redis client giới hạn thời gian chờ
+	ctx := context.Background()
+	if err := r.ping(ctx); err != nil {
+		r.mu.Lock()
+		r.lastError = err.Error()
+		r.mu.Unlock()
+		return
+	}
+
+	if err := r.flushPending(ctx); err != nil {
+		log.Printf("Warning: failed to invalidate stale cache entries: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.open {
+		r.open = false
+		r.failures = 0
+		log.Printf("✅ Redis reconnected after %v, cache re-enabled", time.Since(r.openedAt).Round(time.Second))
+
+		// Redis khởi động lại thường mất hết dữ liệu, cho phép nạp lại link nóng
+		if r.onRecover != nil {
+			go r.onRecover()
+		}
+	}
+}
+
+// flushPending xóa khỏi Redis các short code đã thay đổi trong lúc Redis lỗi
+func (r *ResilientCacheRepository) flushPending(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	overflow := r.pendingOverflow
+	r.pending = make(map[string]struct{})
+	r.pendingOverflow = false
+	r.mu.Unlock()
+
+	if overflow {
+		clearer, ok := r.cache.(interfaces.CacheClearer)
+		if !ok {
+			log.Printf("⚠️ Too many links changed while Redis was down, some cache entries may be stale until they expire")
+		} else {
+			cleared, err := clearer.Clear(ctx)
+			if err != nil {
+				// Chưa xóa được thì giữ mạch ngắt và thử lại ở lần sau
+				r.mu.Lock()
+				r.pendingOverflow = true
+				for code := range pending {
+					r.pending[code] = struct{}{}
+				}
+				r.mu.Unlock()
+				return fmt.Errorf("failed to clear cache: %w", err)
+			}
+			log.Printf("⚠️ Too many links changed while Redis was down, cleared %d cached links", cleared)
+			return nil
+		}
+	}
+
+	for shortCode := range pending {
+		if err := r.cache.Delete(ctx, shortCode); err != nil {
+			// Trả lại các key chưa xóa để lần thử sau xử lý tiếp
+			r.mu.Lock()
+			for code := range pending {
+				r.pending[code] = struct{}{}
+			}
+			r.mu.Unlock()
+			return err
+		}
+		delete(pending, shortCode)
+	}
+	return nil
+}
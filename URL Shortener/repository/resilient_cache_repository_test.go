@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+// flakyCacheRepository giả lập Redis có thể bị ngắt kết nối
+type flakyCacheRepository struct {
+	*MemoryCacheRepository
+	down  bool
+	calls int
+}
+
+var errRedisDown = errors.New("dial tcp: connection refused")
+
+func (r *flakyCacheRepository) Get(ctx context.Context, shortCode string) (*models.CachedURL, error) {
+	r.calls++
+	if r.down {
+		return nil, errRedisDown
+	}
+	return r.MemoryCacheRepository.Get(ctx, shortCode)
+}
+
+func (r *flakyCacheRepository) Delete(ctx context.Context, shortCode string) error {
+	r.calls++
+	if r.down {
+		return errRedisDown
+	}
+	return r.MemoryCacheRepository.Delete(ctx, shortCode)
+}
+
+func (r *flakyCacheRepository) ping(ctx context.Context) error {
+	if r.down {
+		return errRedisDown
+	}
+	return nil
+}
+
+func TestResilientCacheRepository(t *testing.T) {
+	ctx := context.Background()
+	redis := &flakyCacheRepository{MemoryCacheRepository: NewMemoryCacheRepository()}
+	cache := NewResilientCacheRepository(redis, redis.ping, 2, time.Hour)
+
+	redis.MemoryCacheRepository.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com/v1"})
+	redis.down = true
+
+	// Hai lỗi liên tiếp thì ngắt mạch, sau đó không gọi Redis nữa
+	cache.Get(ctx, "abc123")
+	cache.Get(ctx, "abc123")
+	if cache.Healthy() {
+		t.Fatalf("Expected breaker to open after 2 failures")
+	}
+	calls := redis.calls
+	if _, err := cache.Get(ctx, "abc123"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss while breaker is open, got %v", err)
+	}
+	if err := cache.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Expected Delete to be deferred, got %v", err)
+	}
+	if redis.calls != calls {
+		t.Errorf("Expected no Redis calls while breaker is open")
+	}
+
+	// Ping thất bại thì mạch vẫn ngắt
+	cache.recover()
+	if cache.Healthy() {
+		t.Errorf("Expected breaker to stay open while Redis is down")
+	}
+
+	// Redis sống lại: key bị xóa trong lúc lỗi phải được xóa trước khi đóng mạch
+	redis.down = false
+	cache.recover()
+	if !cache.Healthy() {
+		t.Fatalf("Expected breaker to close after Redis recovers")
+	}
+	if _, err := cache.Get(ctx, "abc123"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected stale entry to be invalidated on recovery, got %v", err)
+	}
+}
+
+// TestResilientCacheRepository_PendingOverflow tests every cached link is invalidated on recovery
+// when too many links changed during the outage to remember them all
+func TestResilientCacheRepository_PendingOverflow(t *testing.T) {
+	ctx := context.Background()
+	redis := &flakyCacheRepository{MemoryCacheRepository: NewMemoryCacheRepository()}
+	cache := NewResilientCacheRepository(redis, redis.ping, 1, time.Hour)
+
+	redis.MemoryCacheRepository.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com/v1"})
+	redis.MemoryCacheRepository.Set(ctx, "def456", &models.CachedURL{OriginalURL: "https://example.com/v1"})
+	cache.Trip(errRedisDown)
+
+	cache.Delete(ctx, "abc123")
+	for i := len(cache.pending); i < maxPendingInvalidations+1; i++ {
+		cache.addPending(fmt.Sprintf("code%d", i))
+	}
+
+	cache.recover()
+	if !cache.Healthy() {
+		t.Fatalf("Expected breaker to close after Redis recovers")
+	}
+	for _, code := range []string{"abc123", "def456"} {
+		if _, err := cache.Get(ctx, code); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("Get(%s) = %v, want the cache cleared after overflow", code, err)
+		}
+	}
+}
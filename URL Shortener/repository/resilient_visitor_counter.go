@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/interfaces"
+	"url-shortener/models"
+)
+
+// maxPendingVisits giới hạn số click giữ lại để ghi vào Redis khi kết nối lại
+const maxPendingVisits = 100000
+
+// ResilientVisitorCounter đếm người xem bằng Redis, chuyển sang HyperLogLog trong process khi Redis lỗi
+//
+// Khi Redis lỗi, các click được đếm ở bộ đếm trong process và giữ lại để PFADD vào Redis
+// khi kết nối lại (PFADD lặp lại không làm sai số đếm). Trong lúc Redis lỗi, Count chỉ thấy
+// người xem mà replica này đếm được; khi Redis hoạt động, Count chỉ đọc Redis nên một người xem
+// không bao giờ bị cộng hai lần. Click vượt quá maxPendingVisits không được giữ lại: chúng chỉ
+// được đếm trong process tới khi Redis sống lại rồi bị bỏ (dropped_visits)
+type ResilientVisitorCounter struct {
+	primary       interfaces.UniqueVisitorCounter
+	fallback      *MemoryVisitorCounter
+	retryInterval time.Duration
+
+	// mu cũng bao các lệnh ghi vào fallback để pending và fallback luôn chứa cùng các click
+	mu            sync.Mutex
+	down          bool
+	retryAt       time.Time
+	lastError     string
+	failovers     uint64
+	pending       []*models.ClickEvent
+	droppedVisits uint64 // Số click không giữ lại được vì pending đã đầy
+}
+
+// NewResilientVisitorCounter tạo bộ đếm có dự phòng
+// Khi Redis lỗi, chỉ thử lại Redis sau mỗi retryInterval để không phải chờ timeout ở mỗi batch
+func NewResilientVisitorCounter(primary interfaces.UniqueVisitorCounter, fallback *MemoryVisitorCounter, retryInterval time.Duration) *ResilientVisitorCounter {
+	return &ResilientVisitorCounter{
+		primary:       primary,
+		fallback:      fallback,
+		retryInterval: retryInterval,
+	}
+}
+
+// Add ghi người xem vào Redis, Redis lỗi thì ghi vào bộ đếm trong process
+// Không trả về lỗi vì click luôn được đếm ở một trong hai nơi
+func (r *ResilientVisitorCounter) Add(ctx context.Context, events []*models.ClickEvent) error {
+	if r.allow() {
+		err := r.primary.Add(ctx, events)
+		if err == nil {
+			r.recover(ctx)
+			return nil
+		}
+		r.markDown(err)
+	}
+
+	r.addPending(ctx, events)
+	return nil
+}
+
+// Count đếm bằng Redis, Redis lỗi thì trả về số đếm trong process
+// Click giữ lại trong lúc Redis lỗi được ghi vào Redis trước khi đếm thay vì cộng hai số đếm
+func (r *ResilientVisitorCounter) Count(ctx context.Context, urlID uint, dates []string) (int64, map[string]int64, error) {
+	if !r.allow() || (r.hasPending() && !r.recover(ctx)) {
+		return r.fallback.Count(ctx, urlID, dates)
+	}
+
+	total, byDate, err := r.primary.Count(ctx, urlID, dates)
+	if err != nil {
+		r.markDown(err)
+		return r.fallback.Count(ctx, urlID, dates)
+	}
+	return total, byDate, nil
+}
+
+// GetStats trả về trạng thái Redis và bộ đếm dự phòng
+func (r *ResilientVisitorCounter) GetStats() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	backend := "redis"
+	if r.down {
+		backend = "memory"
+	}
+
+	stats := map[string]interface{}{
+		"backend":        backend,
+		"failovers":      r.failovers,
+		"pending_visits": len(r.pending),
+		"dropped_visits": r.droppedVisits,
+		"fallback":       r.fallback.GetStats(),
+	}
+	if r.down {
+		stats["last_error"] = r.lastError
+	}
+	return stats
+}
+
+// allow trả về false khi Redis đang lỗi và chưa tới lúc thử lại
+func (r *ResilientVisitorCounter) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !r.down || !time.Now().Before(r.retryAt)
+}
+
+// markDown chuyển sang bộ đếm trong process sau khi Redis lỗi
+func (r *ResilientVisitorCounter) markDown(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retryAt = time.Now().Add(r.retryInterval)
+	r.lastError = err.Error()
+	if r.down {
+		return
+	}
+	r.down = true
+	r.failovers++
+	log.Printf("⚠️ Redis unavailable, counting unique visitors in process: %v", err)
+}
+
+// hasPending kiểm tra còn click đếm trong process chưa được ghi vào Redis
+func (r *ResilientVisitorCounter) hasPending() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.pending) > 0
+}
+
+// addPending đếm click ở bộ đếm trong process và giữ lại để ghi vào Redis khi kết nối lại
+// Chỉ chép các trường cần cho việc đếm để không giữ cả event trong bộ nhớ
+func (r *ResilientVisitorCounter) addPending(ctx context.Context, events []*models.ClickEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fallback.Add(ctx, events)
+
+	full := len(r.pending) >= maxPendingVisits
+	var dropped uint64
+	for _, event := range events {
+		if event.IsBot || event.URLID == 0 {
+			continue
+		}
+		if len(r.pending) >= maxPendingVisits {
+			dropped++
+			continue
+		}
+		r.pending = append(r.pending, &models.ClickEvent{
+			URLID:     event.URLID,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	if dropped > 0 && !full {
+		log.Printf("⚠️ Too many visits while Redis is down, further visits are counted in process only until it reconnects")
+	}
+	r.droppedVisits += dropped
+}
+
+// recover ghi các click giữ lại vào Redis sau khi Redis sống lại, trả về false nếu Redis lại lỗi
+// Click giữ lại được lấy ra và bộ đếm trong process được xóa trong cùng một lần giữ lock nên
+// không có lúc nào người xem nằm ở cả hai nơi; trong lúc đang ghi lại, Count của Redis có thể thấp hơn
+func (r *ResilientVisitorCounter) recover(ctx context.Context) bool {
+	r.mu.Lock()
+	wasDown := r.down
+	r.down = false
+	pending := r.pending
+	r.pending = nil
+	r.fallback.Reset()
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		if wasDown {
+			log.Printf("✅ Redis reconnected, counting unique visitors in Redis again")
+		}
+		return true
+	}
+
+	if err := r.primary.Add(ctx, pending); err != nil {
+		r.markDown(err)
+		// Đếm lại trong process để các người xem này không biến mất khỏi Count
+		r.addPending(ctx, pending)
+		return false
+	}
+
+	log.Printf("✅ Redis reconnected, replayed %d visits counted while it was down", len(pending))
+	return true
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+// flakyVisitorCounter giả lập bộ đếm Redis có thể bị ngắt kết nối
+type flakyVisitorCounter struct {
+	*MemoryVisitorCounter
+	down bool
+}
+
+func (c *flakyVisitorCounter) Add(ctx context.Context, events []*models.ClickEvent) error {
+	if c.down {
+		return errRedisDown
+	}
+	return c.MemoryVisitorCounter.Add(ctx, events)
+}
+
+func (c *flakyVisitorCounter) Count(ctx context.Context, urlID uint, dates []string) (int64, map[string]int64, error) {
+	if c.down {
+		return 0, nil, errRedisDown
+	}
+	return c.MemoryVisitorCounter.Count(ctx, urlID, dates)
+}
+
+// visitorClicks tạo click của n người xem khác nhau, bắt đầu từ IP thứ first
+func visitorClicks(urlID uint, first, n int, at time.Time) []*models.ClickEvent {
+	events := make([]*models.ClickEvent, n)
+	for i := range events {
+		events[i] = &models.ClickEvent{URLID: urlID, IPAddress: fmt.Sprintf("10.0.%d.%d", (first+i)/256, (first+i)%256), UserAgent: "Mozilla/5.0", CreatedAt: at}
+	}
+	return events
+}
+
+func TestResilientVisitorCounter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	today := now.UTC().Format(visitorDateLayout)
+
+	redis := &flakyVisitorCounter{MemoryVisitorCounter: NewMemoryVisitorCounter("salt")}
+	counter := NewResilientVisitorCounter(redis, NewMemoryVisitorCounter("salt"), 0)
+
+	counter.Add(ctx, visitorClicks(1, 0, 10, now))
+
+	// Redis lỗi: click được đếm trong process
+	redis.down = true
+	counter.Add(ctx, visitorClicks(1, 5, 10, now))
+	if total, _, _ := counter.Count(ctx, 1, nil); total != 10 {
+		t.Errorf("Count while Redis is down = %d, want 10 counted in process", total)
+	}
+	if stats := counter.GetStats(); stats["backend"] != "memory" || stats["pending_visits"] != 10 {
+		t.Errorf("Unexpected stats while Redis is down: %v", stats)
+	}
+
+	// Redis sống lại: click giữ lại được ghi vào Redis, người xem trùng không bị đếm hai lần
+	redis.down = false
+	counter.Add(ctx, visitorClicks(1, 15, 5, now))
+	total, byDate, err := counter.Count(ctx, 1, []string{today})
+	if err != nil || total != 20 || byDate[today] != 20 {
+		t.Errorf("Count after recovery = (%d, %v, %v), want 20", total, byDate, err)
+	}
+	if redisTotal, _, _ := redis.MemoryVisitorCounter.Count(ctx, 1, nil); redisTotal != 20 {
+		t.Errorf("Redis count after replay = %d, want 20", redisTotal)
+	}
+	if stats := counter.GetStats(); stats["backend"] != "redis" || stats["pending_visits"] != 0 {
+		t.Errorf("Unexpected stats after recovery: %v", stats)
+	}
+}
+
+// TestResilientVisitorCounter_NoDoubleCount tests Count never adds the in-process count to
+// Redis, whether the held visits are replayed by Count or dropped because there are too many
+func TestResilientVisitorCounter_NoDoubleCount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	redis := &flakyVisitorCounter{MemoryVisitorCounter: NewMemoryVisitorCounter("salt")}
+	counter := NewResilientVisitorCounter(redis, NewMemoryVisitorCounter("salt"), 0)
+
+	counter.Add(ctx, visitorClicks(1, 0, 10, now))
+	redis.down = true
+	counter.Add(ctx, visitorClicks(1, 5, maxPendingVisits+5, now))
+
+	// Replay lỗi: vẫn trả về số đếm trong process, không mất click giữ lại
+	if total, _, _ := counter.Count(ctx, 1, nil); total < maxPendingVisits {
+		t.Errorf("Count while Redis is down = %d, want the in-process count", total)
+	}
+	stats := counter.GetStats()
+	if stats["pending_visits"] != maxPendingVisits || stats["dropped_visits"] != uint64(5) {
+		t.Errorf("Unexpected stats after overflow: %v", stats)
+	}
+
+	// Redis sống lại: Count ghi lại click giữ lại rồi chỉ đọc Redis
+	redis.down = false
+	total, _, err := counter.Count(ctx, 1, nil)
+	redisTotal, _, _ := redis.MemoryVisitorCounter.Count(ctx, 1, nil)
+	if err != nil || total != redisTotal {
+		t.Errorf("Count after recovery = (%d, %v), want Redis count %d only", total, err, redisTotal)
+	}
+	if local, _, _ := counter.fallback.Count(ctx, 1, nil); local != 0 {
+		t.Errorf("In-process count after replay = %d, want reset", local)
+	}
+	if stats := counter.GetStats(); stats["backend"] != "redis" || stats["pending_visits"] != 0 {
+		t.Errorf("Unexpected stats after recovery: %v", stats)
+	}
+}
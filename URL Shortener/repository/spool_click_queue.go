@@ -0,0 +1,628 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/models"
+)
+
+// Các chính sách fsync của spool
+const (
+	SpoolFsyncAlways   = "always"   // fsync sau mỗi event: không mất click nào khi mất điện, chậm nhất
+	SpoolFsyncInterval = "interval" // fsync theo chu kỳ: mất tối đa một chu kỳ khi mất điện
+	SpoolFsyncNever    = "never"    // để OS tự ghi xuống đĩa: chỉ an toàn khi process crash
+)
+
+const (
+	spoolSegmentExt     = ".seg"
+	spoolCheckpointFile = "checkpoint"
+	spoolHeaderSize     = 8       // 4 byte độ dài + 4 byte CRC32 của payload
+	spoolMaxRecordSize  = 1 << 20 // Bản ghi lớn hơn được coi là dữ liệu hỏng
+)
+
+// errSpoolCorrupt được trả về khi gặp bản ghi ghi dở hoặc sai checksum
+var errSpoolCorrupt = errors.New("corrupt spool record")
+
+// spoolPosition là vị trí trong spool: segment và offset trong file segment
+type spoolPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func (p spoolPosition) String() string {
+	return strconv.FormatUint(p.Segment, 10) + ":" + strconv.FormatInt(p.Offset, 10)
+}
+
+// spoolEntry là một event đã được đọc nhưng chưa Ack
+type spoolEntry struct {
+	end   spoolPosition
+	acked bool
+}
+
+// SpoolClickQueue là click queue ghi trên đĩa dạng write-ahead log chia segment
+//
+// Mỗi event là một bản ghi [độ dài][CRC32][JSON] được append vào segment hiện tại; segment
+// đầy thì chuyển sang file mới. File checkpoint lưu vị trí đã Ack, các segment nằm hoàn toàn
+// trước checkpoint bị xóa. Khi khởi động lại, events sau checkpoint được đọc lại nên clicks
+// không mất khi restart hay khi database lỗi (một số event có thể được ghi hai lần)
+type SpoolClickQueue struct {
+	dir           string
+	segmentSize   int64
+	maxSize       int64
+	fsync         string
+	fsyncInterval time.Duration
+
+	mu        sync.Mutex
+	closed    bool
+	writer    *os.File
+	writePos  spoolPosition
+	dirty     bool // Có dữ liệu chưa fsync
+	reader    *os.File
+	readerSeg uint64
+	readPos   spoolPosition
+	committed spoolPosition
+	inflight  []*spoolEntry
+	segments  map[uint64]int64 // Kích thước các segment còn trên đĩa
+	totalSize int64
+	unread    int
+	notify    chan struct{} // Đóng và thay mới mỗi khi có event mới
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewSpoolClickQueue mở (hoặc tạo) spool trong cfg.SpoolDir và khôi phục các event chưa xử lý
+func NewSpoolClickQueue(cfg config.AnalyticsConfig) (*SpoolClickQueue, error) {
+	q := &SpoolClickQueue{
+		dir:           cfg.SpoolDir,
+		segmentSize:   cfg.SpoolSegmentSize,
+		maxSize:       cfg.SpoolMaxSize,
+		fsync:         cfg.SpoolFsync,
+		fsyncInterval: cfg.SpoolFsyncInterval,
+		segments:      make(map[uint64]int64),
+		notify:        make(chan struct{}),
+		quit:          make(chan struct{}),
+	}
+	if q.segmentSize <= 0 {
+		q.segmentSize = 16 << 20
+	}
+	if q.maxSize <= 0 {
+		q.maxSize = 1 << 30
+	}
+	switch q.fsync {
+	case SpoolFsyncAlways, SpoolFsyncNever:
+	default:
+		q.fsync = SpoolFsyncInterval
+	}
+	if q.fsyncInterval <= 0 {
+		q.fsyncInterval = time.Second
+	}
+
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := q.open(); err != nil {
+		return nil, err
+	}
+
+	if q.fsync == SpoolFsyncInterval {
+		q.wg.Add(1)
+		go q.syncLoop()
+	}
+
+	log.Printf("✅ Click spool opened at %s (%d pending events, fsync: %s)", q.dir, q.unread, q.fsync)
+	return q, nil
+}
+
+// open đọc checkpoint, xóa segment đã xử lý xong và đếm các event còn lại
+func (q *SpoolClickQueue) open() error {
+	checkpoint, err := q.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	segments, err := q.listSegments()
+	if err != nil {
+		return err
+	}
+
+	kept := segments[:0]
+	for _, seq := range segments {
+		if seq < checkpoint.Segment {
+			if err := os.Remove(q.segmentPath(seq)); err != nil {
+				return fmt.Errorf("failed to remove consumed spool segment: %w", err)
+			}
+			continue
+		}
+		kept = append(kept, seq)
+	}
+	if len(kept) == 0 {
+		kept = append(kept, checkpoint.Segment)
+	} else if kept[0] > checkpoint.Segment {
+		checkpoint = spoolPosition{Segment: kept[0]}
+	}
+
+	for i, seq := range kept {
+		start := int64(0)
+		if seq == checkpoint.Segment {
+			start = checkpoint.Offset
+		}
+
+		count, validEnd, size, err := scanSpoolSegment(q.segmentPath(seq), start)
+		if err != nil {
+			return err
+		}
+		if validEnd < size {
+			if i == len(kept)-1 {
+				// Process dừng giữa lúc ghi: cắt bản ghi dở để ghi tiếp từ vị trí hợp lệ
+				log.Printf("⚠️ Truncating %d bytes of incomplete records from spool segment %d", size-validEnd, seq)
+				if err := os.Truncate(q.segmentPath(seq), validEnd); err != nil {
+					return fmt.Errorf("failed to truncate spool segment: %w", err)
+				}
+				size = validEnd
+			} else {
+				log.Printf("⚠️ Skipping %d bytes of corrupt records in spool segment %d", size-validEnd, seq)
+			}
+		}
+
+		q.unread += count
+		q.segments[seq] = size
+		q.totalSize += size
+	}
+
+	last := kept[len(kept)-1]
+	writer, err := os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+
+	q.writer = writer
+	q.writePos = spoolPosition{Segment: last, Offset: q.segments[last]}
+	q.readPos = checkpoint
+	q.committed = checkpoint
+	return nil
+}
+
+// Push ghi event vào cuối spool, trả về ErrQueueFull khi spool vượt giới hạn dung lượng
+func (q *SpoolClickQueue) Push(event *models.ClickEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode click event: %w", err)
+	}
+	record := make([]byte, spoolHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[spoolHeaderSize:], payload)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.totalSize+int64(len(record)) > q.maxSize {
+		return ErrQueueFull
+	}
+	if q.writePos.Offset > 0 && q.writePos.Offset+int64(len(record)) > q.segmentSize {
+		if err := q.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := q.writer.Write(record); err != nil {
+		// Cắt phần ghi dở để segment không chứa bản ghi hỏng ở giữa
+		q.writer.Truncate(q.writePos.Offset)
+		return fmt.Errorf("failed to write click spool: %w", err)
+	}
+
+	size := int64(len(record))
+	q.writePos.Offset += size
+	q.segments[q.writePos.Segment] += size
+	q.totalSize += size
+	q.unread++
+
+	if q.fsync == SpoolFsyncAlways {
+		if err := q.writer.Sync(); err != nil {
+			return fmt.Errorf("failed to sync click spool: %w", err)
+		}
+	} else {
+		q.dirty = true
+	}
+
+	// Đánh thức các worker đang chờ trong Pop
+	close(q.notify)
+	q.notify = make(chan struct{})
+	return nil
+}
+
+// Pop đọc tối đa max events, chờ tối đa wait để gom đủ batch
+// Các event chỉ bị xóa khỏi spool sau khi Ack
+func (q *SpoolClickQueue) Pop(ctx context.Context, max int, wait time.Duration) (*models.ClickBatch, error) {
+	batch := &models.ClickBatch{}
+
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return batch, ErrQueueClosed
+		}
+		err := q.readLocked(batch, max-len(batch.Events))
+		notify := q.notify
+		q.mu.Unlock()
+
+		if err != nil || len(batch.Events) >= max || wait <= 0 {
+			return batch, err
+		}
+
+		select {
+		case <-notify:
+			// Có event mới, đọc tiếp
+		case <-timeout:
+			return batch, nil
+		case <-ctx.Done():
+			if len(batch.Events) > 0 {
+				return batch, nil
+			}
+			return batch, ctx.Err()
+		}
+	}
+}
+
+// readLocked đọc tối đa n events từ vị trí đọc hiện tại vào batch, caller phải giữ mu
+func (q *SpoolClickQueue) readLocked(batch *models.ClickBatch, n int) error {
+	for n > 0 && q.readPos != q.writePos {
+		if q.reader == nil || q.readerSeg != q.readPos.Segment {
+			if err := q.openReaderLocked(q.readPos.Segment); err != nil {
+				return err
+			}
+		}
+
+		payload, size, err := readSpoolRecord(io.NewSectionReader(q.reader, q.readPos.Offset, q.segmentSize+spoolMaxRecordSize))
+		if err != nil {
+			if q.readPos.Segment < q.writePos.Segment {
+				// Hết segment (hoặc phần hỏng ở cuối segment cũ), chuyển sang segment tiếp theo
+				q.readPos = spoolPosition{Segment: q.readPos.Segment + 1}
+				continue
+			}
+			return fmt.Errorf("failed to read click spool: %w", err)
+		}
+
+		q.readPos.Offset += size
+		q.unread--
+
+		var event models.ClickEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("⚠️ Skipping unreadable click event in spool at %s: %v", q.readPos, err)
+			q.inflight = append(q.inflight, &spoolEntry{end: q.readPos, acked: true})
+			continue
+		}
+
+		batch.Events = append(batch.Events, &event)
+		batch.IDs = append(batch.IDs, q.readPos.String())
+		q.inflight = append(q.inflight, &spoolEntry{end: q.readPos})
+		n--
+	}
+	return nil
+}
+
+// Renew không cần làm gì: event đang xử lý chỉ được đọc lại khi process khởi động lại
+func (q *SpoolClickQueue) Renew(batch *models.ClickBatch) error {
+	return nil
+}
+
+// Ack đánh dấu các event đã ghi xong và lưu checkpoint tới event liên tiếp xa nhất đã Ack
+func (q *SpoolClickQueue) Ack(batch *models.ClickBatch) error {
+	if len(batch.IDs) == 0 {
+		return nil
+	}
+
+	acked := make(map[string]struct{}, len(batch.IDs))
+	for _, id := range batch.IDs {
+		acked[id] = struct{}{}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, entry := range q.inflight {
+		if _, ok := acked[entry.end.String()]; ok {
+			entry.acked = true
+		}
+	}
+
+	// Worker có thể Ack không theo thứ tự, checkpoint chỉ tiến tới event chưa Ack đầu tiên
+	advanced := false
+	for len(q.inflight) > 0 && q.inflight[0].acked {
+		q.committed = q.inflight[0].end
+		q.inflight = q.inflight[1:]
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+
+	if err := q.writeCheckpoint(q.committed); err != nil {
+		return err
+	}
+	q.removeConsumedSegmentsLocked()
+	return nil
+}
+
+// Len trả về số events chưa được Ack
+func (q *SpoolClickQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.unread + len(q.inflight)
+}
+
+// GetStats trả về thống kê của spool
+func (q *SpoolClickQueue) GetStats() map[string]interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return map[string]interface{}{
+		"type":      "spool",
+		"dir":       q.dir,
+		"pending":   q.unread,
+		"in_flight": len(q.inflight),
+		"segments":  len(q.segments),
+		"bytes":     q.totalSize,
+		"max_bytes": q.maxSize,
+		"fsync":     q.fsync,
+	}
+}
+
+// Close fsync và đóng spool, các event chưa xử lý được đọc lại ở lần khởi động sau
+func (q *SpoolClickQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.notify)
+
+	var err error
+	if q.fsync != SpoolFsyncNever {
+		err = q.writer.Sync()
+	}
+	q.writer.Close()
+	if q.reader != nil {
+		q.reader.Close()
+	}
+	pending := q.unread + len(q.inflight)
+	q.mu.Unlock()
+
+	close(q.quit)
+	q.wg.Wait()
+
+	if pending > 0 {
+		log.Printf("📼 Click spool closed with %d pending events, they will be processed on next start", pending)
+	}
+	return err
+}
+
+// syncLoop fsync segment hiện tại theo chu kỳ khi dùng chính sách "interval"
+func (q *SpoolClickQueue) syncLoop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.fsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.quit:
+			return
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty && !q.closed {
+				if err := q.writer.Sync(); err != nil {
+					log.Printf("Warning: failed to sync click spool: %v", err)
+				} else {
+					q.dirty = false
+				}
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// rotateLocked chuyển sang segment mới, caller phải giữ mu
+func (q *SpoolClickQueue) rotateLocked() error {
+	next := q.writePos.Segment + 1
+	writer, err := os.OpenFile(q.segmentPath(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	if q.fsync != SpoolFsyncNever {
+		if err := q.writer.Sync(); err != nil {
+			log.Printf("Warning: failed to sync click spool: %v", err)
+		}
+	}
+	q.writer.Close()
+
+	q.writer = writer
+	q.writePos = spoolPosition{Segment: next}
+	q.segments[next] = 0
+	q.dirty = false
+	return nil
+}
+
+// openReaderLocked mở file segment để đọc, caller phải giữ mu
+func (q *SpoolClickQueue) openReaderLocked(seq uint64) error {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+
+	reader, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	q.reader = reader
+	q.readerSeg = seq
+	return nil
+}
+
+// removeConsumedSegmentsLocked xóa các segment nằm hoàn toàn trước checkpoint, caller phải giữ mu
+func (q *SpoolClickQueue) removeConsumedSegmentsLocked() {
+	for seq, size := range q.segments {
+		if seq >= q.committed.Segment {
+			continue
+		}
+		if err := os.Remove(q.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove spool segment %d: %v", seq, err)
+			continue
+		}
+		delete(q.segments, seq)
+		q.totalSize -= size
+	}
+}
+
+// readCheckpoint đọc vị trí đã Ack, spool mới bắt đầu từ segment 0
+func (q *SpoolClickQueue) readCheckpoint() (spoolPosition, error) {
+	var position spoolPosition
+
+	data, err := os.ReadFile(filepath.Join(q.dir, spoolCheckpointFile))
+	if os.IsNotExist(err) {
+		return position, nil
+	}
+	if err != nil {
+		return position, fmt.Errorf("failed to read spool checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &position); err != nil {
+		return position, fmt.Errorf("invalid spool checkpoint: %w", err)
+	}
+	return position, nil
+}
+
+// writeCheckpoint ghi vị trí đã Ack qua file tạm rồi rename để không bao giờ để lại checkpoint hỏng
+func (q *SpoolClickQueue) writeCheckpoint(position spoolPosition) error {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(q.dir, spoolCheckpointFile)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	if q.fsync != SpoolFsyncNever {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to sync spool checkpoint: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write spool checkpoint: %w", err)
+	}
+	return nil
+}
+
+// listSegments trả về số thứ tự các segment trong thư mục, tăng dần
+func (q *SpoolClickQueue) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool segments: %w", err)
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (q *SpoolClickQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// scanSpoolSegment đếm các bản ghi hợp lệ từ offset start
+// Trả về offset kết thúc của bản ghi hợp lệ cuối cùng và kích thước file
+func scanSpoolSegment(path string, start int64) (count int, validEnd int64, size int64, err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o644)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to stat spool segment: %w", err)
+	}
+	size = info.Size()
+
+	validEnd = start
+	for validEnd < size {
+		_, n, err := readSpoolRecord(io.NewSectionReader(file, validEnd, size-validEnd))
+		if err != nil {
+			break
+		}
+		validEnd += n
+		count++
+	}
+	return count, validEnd, size, nil
+}
+
+// readSpoolRecord đọc một bản ghi, trả về payload và số byte đã đọc
+func readSpoolRecord(r io.Reader) ([]byte, int64, error) {
+	var header [spoolHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length == 0 || length > spoolMaxRecordSize {
+		return nil, 0, errSpoolCorrupt
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errSpoolCorrupt
+	}
+	return payload, int64(spoolHeaderSize) + int64(length), nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/models"
+)
+
+func newTestSpool(t *testing.T, cfg config.AnalyticsConfig) *SpoolClickQueue {
+	t.Helper()
+
+	spool, err := NewSpoolClickQueue(cfg)
+	if err != nil {
+		t.Fatalf("NewSpoolClickQueue returned error: %v", err)
+	}
+	return spool
+}
+
+// TestSpoolClickQueue_Restart tests unacked events survive a restart and acked segments are removed
+func TestSpoolClickQueue_Restart(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.AnalyticsConfig{SpoolDir: t.TempDir(), SpoolSegmentSize: 512, SpoolFsync: SpoolFsyncAlways}
+
+	spool := newTestSpool(t, cfg)
+	for i := 0; i < 20; i++ {
+		if err := spool.Push(&models.ClickEvent{ShortCode: fmt.Sprintf("code%02d", i)}); err != nil {
+			t.Fatalf("Push returned error: %v", err)
+		}
+	}
+
+	first, err := spool.Pop(ctx, 5, 0)
+	if err != nil || len(first.Events) != 5 {
+		t.Fatalf("Pop = %d events, %v; want 5", len(first.Events), err)
+	}
+	second, _ := spool.Pop(ctx, 5, 0)
+
+	// Ack không theo thứ tự: checkpoint chưa được tiến khi batch đầu chưa Ack
+	if err := spool.Ack(second); err != nil {
+		t.Fatalf("Ack returned error: %v", err)
+	}
+	if spool.committed != (spoolPosition{}) {
+		t.Errorf("Expected checkpoint to wait for the first batch, got %s", spool.committed)
+	}
+	if err := spool.Ack(first); err != nil {
+		t.Fatalf("Ack returned error: %v", err)
+	}
+	third, _ := spool.Pop(ctx, 5, 0) // Đọc nhưng không Ack trước khi restart
+	if len(third.Events) != 5 {
+		t.Fatalf("Pop = %d events, want 5", len(third.Events))
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	reopened := newTestSpool(t, cfg)
+	defer reopened.Close()
+
+	if reopened.Len() != 10 {
+		t.Fatalf("Len after restart = %d, want 10", reopened.Len())
+	}
+	batch, _ := reopened.Pop(ctx, 100, 0)
+	if len(batch.Events) != 10 || batch.Events[0].ShortCode != "code10" {
+		t.Fatalf("Expected unacked events to be redelivered from code10, got %d events", len(batch.Events))
+	}
+	if err := reopened.Ack(batch); err != nil {
+		t.Fatalf("Ack returned error: %v", err)
+	}
+	if segments, _ := reopened.listSegments(); len(segments) != 1 {
+		t.Errorf("Expected consumed segments to be removed, %d left", len(segments))
+	}
+}
+
+// TestSpoolClickQueue_SizeCap tests pushes are rejected once the spool reaches its size cap
+func TestSpoolClickQueue_SizeCap(t *testing.T) {
+	spool := newTestSpool(t, config.AnalyticsConfig{SpoolDir: t.TempDir(), SpoolMaxSize: 300, SpoolFsync: SpoolFsyncNever})
+	defer spool.Close()
+
+	var err error
+	pushed := 0
+	for ; pushed < 100; pushed++ {
+		if err = spool.Push(&models.ClickEvent{ShortCode: "abc123"}); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrQueueFull) || pushed == 0 {
+		t.Fatalf("Expected ErrQueueFull after some pushes, got %v after %d", err, pushed)
+	}
+}
+
+// TestSpoolClickQueue_TornWrite tests an incomplete record at the end of the spool is discarded
+func TestSpoolClickQueue_TornWrite(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.AnalyticsConfig{SpoolDir: t.TempDir(), SpoolFsync: SpoolFsyncNever}
+
+	spool := newTestSpool(t, cfg)
+	spool.Push(&models.ClickEvent{ShortCode: "abc123"})
+	spool.Close()
+
+	// Giả lập process chết giữa lúc ghi bản ghi thứ hai
+	file, _ := os.OpenFile(filepath.Join(cfg.SpoolDir, fmt.Sprintf("%020d%s", 0, spoolSegmentExt)), os.O_WRONLY|os.O_APPEND, 0o644)
+	file.Write([]byte{0, 0, 0, 50, 1, 2})
+	file.Close()
+
+	reopened := newTestSpool(t, cfg)
+	defer reopened.Close()
+
+	reopened.Push(&models.ClickEvent{ShortCode: "def456"})
+	batch, err := reopened.Pop(ctx, 10, 50*time.Millisecond)
+	if err != nil || len(batch.Events) != 2 || batch.Events[1].ShortCode != "def456" {
+		t.Fatalf("Pop = %+v, %v; want abc123 and def456", batch.Events, err)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"url-shortener/interfaces"
+	"url-shortener/models"
+)
+
+// TieredCacheRepository là cache hai tầng: LRU trong process đứng trước Redis
+// Link nóng được trả về mà không cần round trip tới Redis; TTL của tầng local ngắn
+// và việc sửa/xóa link được phát qua bus để các replica khác xóa bản local của mình
+type TieredCacheRepository struct {
+	local  *lruCache
+	remote interfaces.CacheRepository
+	bus    interfaces.CacheInvalidationBus // nil = không đồng bộ giữa các replica
+
+	localHits     uint64
+	localMisses   uint64
+	remoteHits    uint64
+	remoteMisses  uint64
+	invalidations uint64
+}
+
+// NewTieredCacheRepository tạo cache hai tầng
+// size là số link tối đa giữ trong process, ttl là thời gian tối đa một link nằm ở tầng local
+func NewTieredCacheRepository(
+	remote interfaces.CacheRepository,
+	bus interfaces.CacheInvalidationBus,
+	size int,
+	ttl time.Duration,
+) *TieredCacheRepository {
+	return &TieredCacheRepository{
+		local:  newLRUCache(size, ttl),
+		remote: remote,
+		bus:    bus,
+	}
+}
+
+// StartInvalidationListener bắt đầu nhận thông báo xóa cache từ các replica khác
+func (r *TieredCacheRepository) StartInvalidationListener() error {
+	if r.bus == nil {
+		return nil
+	}
+	return r.bus.Subscribe(func(shortCode string) {
+		r.local.delete(shortCode)
+		atomic.AddUint64(&r.invalidations, 1)
+	})
+}
+
+// Close dừng nhận thông báo xóa cache
+func (r *TieredCacheRepository) Close() error {
+	if r.bus == nil {
+		return nil
+	}
+	return r.bus.Close()
+}
+
+// Set ghi URL vào cả hai tầng và báo các replica khác bỏ bản local cũ
+func (r *TieredCacheRepository) Set(ctx context.Context, shortCode string, entry *models.CachedURL) error {
+	if err := r.remote.Set(ctx, shortCode, entry); err != nil {
+		// Không biết Redis đang giữ giá trị nào nên không giữ bản local
+		r.local.delete(shortCode)
+		return err
+	}
+	r.setLocal(shortCode, entry)
+	r.publish(ctx, shortCode)
+	return nil
+}
+
+// SetIfAbsent chỉ lưu URL nếu Redis chưa có key
+// Tầng local chỉ được ghi khi Redis thực sự nhận giá trị, tránh giữ bản cũ hơn Redis
+func (r *TieredCacheRepository) SetIfAbsent(ctx context.Context, shortCode string, entry *models.CachedURL) (bool, error) {
+	stored, err := r.remote.SetIfAbsent(ctx, shortCode, entry)
+	if err != nil || !stored {
+		return stored, err
+	}
+	r.setLocal(shortCode, entry)
+	return true, nil
+}
+
+// SetManyIfAbsent lưu nhiều URL vào Redis
+// Tầng local không được nạp sẵn mà tự đầy dần theo lượt truy cập thực tế
+func (r *TieredCacheRepository) SetManyIfAbsent(ctx context.Context, entries map[string]*models.CachedURL) (int, error) {
+	return r.remote.SetManyIfAbsent(ctx, entries)
+}
+
+// Get lấy URL từ tầng local, nếu không có thì từ Redis rồi lưu lại ở local
+func (r *TieredCacheRepository) Get(ctx context.Context, shortCode string) (*models.CachedURL, error) {
+	if entry, ok := r.local.get(shortCode); ok {
+		atomic.AddUint64(&r.localHits, 1)
+		return entry, nil
+	}
+	atomic.AddUint64(&r.localMisses, 1)
+
+	entry, err := r.remote.Get(ctx, shortCode)
+	if err != nil {
+		if errors.Is(err, ErrCacheMiss) {
+			atomic.AddUint64(&r.remoteMisses, 1)
+		}
+		return nil, err
+	}
+	atomic.AddUint64(&r.remoteHits, 1)
+
+	r.setLocal(shortCode, entry)
+	return entry, nil
+}
+
+// Delete xóa URL khỏi cả hai tầng và báo các replica khác
+func (r *TieredCacheRepository) Delete(ctx context.Context, shortCode string) error {
+	r.local.delete(shortCode)
+	if err := r.remote.Delete(ctx, shortCode); err != nil {
+		return err
+	}
+	r.publish(ctx, shortCode)
+	return nil
+}
+
+// Exists kiểm tra URL có trong cache không
+func (r *TieredCacheRepository) Exists(ctx context.Context, shortCode string) (bool, error) {
+	if _, ok := r.local.get(shortCode); ok {
+		return true, nil
+	}
+	return r.remote.Exists(ctx, shortCode)
+}
+
+// GetStats trả về số hit/miss của từng tầng
+func (r *TieredCacheRepository) GetStats() map[string]interface{} {
+	remote := map[string]interface{}{
+		"hits":   atomic.LoadUint64(&r.remoteHits),
+		"misses": atomic.LoadUint64(&r.remoteMisses),
+	}
+	// Gộp thống kê riêng của tầng Redis (ví dụ circuit breaker) nếu có
+	if stats, ok := r.remote.(interfaces.CacheStats); ok {
+		for key, value := range stats.GetStats() {
+			remote[key] = value
+		}
+	}
+
+	return map[string]interface{}{
+		"local": map[string]interface{}{
+			"hits":     atomic.LoadUint64(&r.localHits),
+			"misses":   atomic.LoadUint64(&r.localMisses),
+			"size":     r.local.len(),
+			"capacity": r.local.capacity,
+			"ttl":      r.local.ttl.String(),
+		},
+		"redis":                  remote,
+		"invalidations_received": atomic.LoadUint64(&r.invalidations),
+	}
+}
+
+// setLocal lưu URL vào tầng local
+// Negative entry chỉ nằm ở Redis để scanner dò short code ngẫu nhiên không đẩy link nóng ra khỏi LRU
+func (r *TieredCacheRepository) setLocal(shortCode string, entry *models.CachedURL) {
+	if entry.NotFound {
+		r.local.delete(shortCode)
+		return
+	}
+	r.local.set(shortCode, entry)
+}
+
+// publish báo các replica khác xóa bản local
+// Nếu lỗi, bản local ở replica khác sẽ tự hết hạn sau TTL ngắn của tầng local
+func (r *TieredCacheRepository) publish(ctx context.Context, shortCode string) {
+	if r.bus == nil {
+		return
+	}
+	if err := r.bus.Publish(ctx, shortCode); err != nil {
+		log.Printf("Warning: failed to publish cache invalidation for %s: %v", shortCode, err)
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+)
+
+// fakeInvalidationBus chuyển thông báo giữa các cache trong cùng process
+type fakeInvalidationBus struct {
+	peers []func(shortCode string)
+}
+
+func (b *fakeInvalidationBus) Publish(ctx context.Context, shortCode string) error {
+	for _, handler := range b.peers {
+		handler(shortCode)
+	}
+	return nil
+}
+
+func (b *fakeInvalidationBus) Subscribe(handler func(shortCode string)) error {
+	b.peers = append(b.peers, handler)
+	return nil
+}
+
+func (b *fakeInvalidationBus) Close() error { return nil }
+
+func TestTieredCacheRepository(t *testing.T) {
+	ctx := context.Background()
+	remote := NewMemoryCacheRepository()
+	cache := NewTieredCacheRepository(remote, nil, 2, time.Minute)
+
+	remote.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com/a"})
+	for i := 0; i < 3; i++ {
+		entry, err := cache.Get(ctx, "abc123")
+		if err != nil || entry.OriginalURL != "https://example.com/a" {
+			t.Fatalf("Get = (%+v, %v)", entry, err)
+		}
+	}
+	if _, err := cache.Get(ctx, "missing"); err != ErrCacheMiss {
+		t.Errorf("Expected ErrCacheMiss, got %v", err)
+	}
+
+	stats := cache.GetStats()
+	local := stats["local"].(map[string]interface{})
+	redis := stats["redis"].(map[string]interface{})
+	if local["hits"] != uint64(2) || local["misses"] != uint64(2) || redis["hits"] != uint64(1) || redis["misses"] != uint64(1) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Vượt sức chứa thì link ít dùng nhất bị loại
+	cache.Set(ctx, "def456", &models.CachedURL{OriginalURL: "https://example.com/d"})
+	cache.Set(ctx, "ghk789", &models.CachedURL{OriginalURL: "https://example.com/g"})
+	if _, ok := cache.local.get("abc123"); ok {
+		t.Errorf("Expected least recently used entry to be evicted")
+	}
+}
+
+func TestTieredCacheRepository_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	remote := NewMemoryCacheRepository()
+	bus := &fakeInvalidationBus{}
+	replicaA := NewTieredCacheRepository(remote, bus, 10, time.Minute)
+	replicaB := NewTieredCacheRepository(remote, bus, 10, time.Minute)
+	replicaB.StartInvalidationListener()
+
+	replicaA.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com/v1"})
+	replicaB.Get(ctx, "abc123")
+
+	// Replica A sửa link, bản local của replica B phải bị xóa
+	replicaA.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com/v2"})
+	if entry, _ := replicaB.Get(ctx, "abc123"); entry == nil || entry.OriginalURL != "https://example.com/v2" {
+		t.Errorf("Expected replica B to read the new destination, got %+v", entry)
+	}
+
+	replicaA.Delete(ctx, "abc123")
+	if _, err := replicaB.Get(ctx, "abc123"); err != ErrCacheMiss {
+		t.Errorf("Expected ErrCacheMiss on replica B after delete, got %v", err)
+	}
+}
@@ -1,33 +1,48 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"url-shortener/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // URLRepositoryImpl là implementation của URLRepository
 type URLRepositoryImpl struct {
-	db *gorm.DB
+	db      *gorm.DB
+	timeout time.Duration // Thời gian tối đa của mỗi truy vấn (0 = không giới hạn)
 }
 
 // NewURLRepository tạo instance mới của URLRepository
-func NewURLRepository(db *gorm.DB) *URLRepositoryImpl {
-	return &URLRepositoryImpl{db: db}
+func NewURLRepository(db *gorm.DB, timeout time.Duration) *URLRepositoryImpl {
+	return &URLRepositoryImpl{db: db, timeout: timeout}
+}
+
+// session trả về DB gắn với ctx, bị hủy khi request kết thúc hoặc quá timeout
+func (r *URLRepositoryImpl) session(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := withTimeout(ctx, r.timeout)
+	return r.db.WithContext(ctx), cancel
 }
 
 // Create tạo mới một URL record
-func (r *URLRepositoryImpl) Create(url *models.URL) error {
-	return r.db.Create(url).Error
+func (r *URLRepositoryImpl) Create(ctx context.Context, url *models.URL) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Create(url).Error
 }
 
 // FindByShortCode tìm URL theo short code
-func (r *URLRepositoryImpl) FindByShortCode(shortCode string) (*models.URL, error) {
+func (r *URLRepositoryImpl) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
 	var url models.URL
-	err := r.db.Where("short_code = ?", shortCode).First(&url).Error
+	err := db.Where("short_code = ?", shortCode).First(&url).Error
 	if err != nil {
 		return nil, err
 	}
@@ -35,9 +50,12 @@ func (r *URLRepositoryImpl) FindByShortCode(shortCode string) (*models.URL, erro
 }
 
 // FindByOriginalURL tìm URL theo original URL
-func (r *URLRepositoryImpl) FindByOriginalURL(originalURL string) (*models.URL, error) {
+func (r *URLRepositoryImpl) FindByOriginalURL(ctx context.Context, originalURL string) (*models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
 	var url models.URL
-	err := r.db.Where("original_url = ?", originalURL).First(&url).Error
+	err := db.Where("original_url = ?", originalURL).First(&url).Error
 	if err != nil {
 		return nil, err
 	}
@@ -45,32 +63,271 @@ func (r *URLRepositoryImpl) FindByOriginalURL(originalURL string) (*models.URL,
 }
 
 // IncrementClickCount tăng số lượt click
-func (r *URLRepositoryImpl) IncrementClickCount(shortCode string) error {
-	return r.db.Model(&models.URL{}).
+func (r *URLRepositoryImpl) IncrementClickCount(ctx context.Context, shortCode string) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Model(&models.URL{}).
 		Where("short_code = ?", shortCode).
 		UpdateColumn("click_count", gorm.Expr("click_count + ?", 1)).Error
 }
 
+// Update khóa dòng của URL (SELECT ... FOR UPDATE), gọi change để sửa original_url, expires_at
+// rồi lưu cùng bản ghi lịch sử trong một transaction. Giá trị cũ được đọc khi đã giữ khóa
+// nên hai update đồng thời không ghi cùng một "giá trị trước" vào lịch sử
+func (r *URLRepositoryImpl) Update(ctx context.Context, shortCode string, change func(url *models.URL) (*models.URLRevision, error), saved func(url *models.URL) error) (*models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var url models.URL
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("short_code = ?", shortCode)
+		// SQLite chỉ dùng một connection nên các transaction vốn đã chạy tuần tự
+		if !isSQLite(tx) {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.First(&url).Error; err != nil {
+			return err
+		}
+
+		previous, err := change(&url)
+		if err != nil {
+			return err
+		}
+
+		url.UpdatedAt = time.Now()
+		err = tx.Model(&models.URL{}).
+			Where("id = ?", url.ID).
+			Updates(map[string]interface{}{
+				"original_url": url.OriginalURL,
+				"expires_at":   url.ExpiresAt,
+				"updated_at":   url.UpdatedAt,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		if previous != nil {
+			if err := tx.Create(previous).Error; err != nil {
+				return err
+			}
+		}
+		if saved != nil {
+			return saved(&url)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// ListRevisions lấy lịch sử thay đổi của URL, mới nhất trước
+func (r *URLRepositoryImpl) ListRevisions(ctx context.Context, urlID uint) ([]models.URLRevision, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var revisions []models.URLRevision
+	err := db.Where("url_id = ?", urlID).Order("id DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// FindRevision tìm một phiên bản cũ của URL
+func (r *URLRepositoryImpl) FindRevision(ctx context.Context, urlID uint, revisionID uint) (*models.URLRevision, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var revision models.URLRevision
+	err := db.Where("id = ? AND url_id = ?", revisionID, urlID).First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
 // Delete xóa URL (soft delete)
-func (r *URLRepositoryImpl) Delete(shortCode string) error {
-	return r.db.Where("short_code = ?", shortCode).Delete(&models.URL{}).Error
+func (r *URLRepositoryImpl) Delete(ctx context.Context, shortCode string) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Where("short_code = ?", shortCode).Delete(&models.URL{}).Error
 }
 
 // ExistsShortCode kiểm tra short code đã tồn tại chưa
-func (r *URLRepositoryImpl) ExistsShortCode(shortCode string) (bool, error) {
+// Tính cả link đã soft delete vì unique index trên short_code vẫn giữ các dòng này
+func (r *URLRepositoryImpl) ExistsShortCode(ctx context.Context, shortCode string) (bool, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
 	var count int64
-	err := r.db.Model(&models.URL{}).Where("short_code = ?", shortCode).Count(&count).Error
+	err := db.Unscoped().Model(&models.URL{}).Where("short_code = ?", shortCode).Count(&count).Error
 	return count > 0, err
 }
 
+// FindDeletedByShortCode tìm link đã bị soft delete theo short code
+func (r *URLRepositoryImpl) FindDeletedByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var url models.URL
+	err := db.Unscoped().
+		Where("short_code = ? AND deleted_at IS NOT NULL", shortCode).
+		First(&url).Error
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// ListDeleted liệt kê link đã bị soft delete, mới xóa trước (keyset theo id)
+func (r *URLRepositoryImpl) ListDeleted(ctx context.Context, limit int, beforeID uint) ([]models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	if beforeID > 0 {
+		db = db.Where("id < ?", beforeID)
+	}
+
+	var urls []models.URL
+	err := db.Order("id DESC").Limit(limit).Find(&urls).Error
+	return urls, err
+}
+
+// Restore khôi phục link đã bị soft delete
+func (r *URLRepositoryImpl) Restore(ctx context.Context, shortCode string) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	result := db.Unscoped().Model(&models.URL{}).
+		Where("short_code = ? AND deleted_at IS NOT NULL", shortCode).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge xóa vĩnh viễn link đã bị soft delete cùng click events, rollup và lịch sử
+// Chỉ link đã nằm trong thùng rác mới có thể purge
+func (r *URLRepositoryImpl) Purge(ctx context.Context, shortCode string, archiveAnalytics bool) error {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var url models.URL
+		err := tx.Unscoped().
+			Where("short_code = ? AND deleted_at IS NOT NULL", shortCode).
+			First(&url).Error
+		if err != nil {
+			return err
+		}
+
+		if archiveAnalytics {
+			err := tx.Exec(`INSERT INTO click_events_archive
+    (id, url_id, short_code, ip_address, user_agent, referer, country, region, city, is_bot, bot_category,
+     device_type, os_family, os_version, browser_family, browser_version, created_at, archived_at)
+SELECT id, url_id, short_code, ip_address, user_agent, referer, country, region, city, is_bot, bot_category,
+     device_type, os_family, os_version, browser_family, browser_version, created_at, ?
+FROM click_events WHERE url_id = ?
+ON CONFLICT (id) DO NOTHING`, time.Now(), url.ID).Error
+			if err != nil {
+				return fmt.Errorf("failed to archive click events: %w", err)
+			}
+		}
+
+		if err := tx.Where("url_id = ?", url.ID).Delete(&models.ClickEvent{}).Error; err != nil {
+			return err
+		}
+		for _, rollup := range []interface{}{&models.ClickRollupHourly{}, &models.ClickRollupDaily{}, &models.ClickDimensionRollup{}} {
+			if err := tx.Where("url_id = ?", url.ID).Delete(rollup).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("url_id = ?", url.ID).Delete(&models.URLRevision{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&url).Error
+	})
+}
+
+// FindExpired tìm link chưa xóa đã hết hạn trước thời điểm before
+func (r *URLRepositoryImpl) FindExpired(ctx context.Context, before time.Time, limit int) ([]models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var urls []models.URL
+	err := db.Where("expires_at IS NOT NULL AND expires_at < ?", before).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&urls).Error
+	return urls, err
+}
+
+// DeleteExpired soft delete các link trong ids vẫn còn hết hạn trước thời điểm before
+// Điều kiện hết hạn được kiểm tra lại trên các dòng đã khóa nên PATCH gia hạn link giữa
+// FindExpired và lần xóa này thắng; chỉ trả về các link thực sự bị xóa
+func (r *URLRepositoryImpl) DeleteExpired(ctx context.Context, ids []uint, before time.Time) ([]models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var urls []models.URL
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("id IN ? AND expires_at IS NOT NULL AND expires_at < ?", ids, before).Order("id ASC")
+		if !isSQLite(tx) {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.Find(&urls).Error; err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+
+		deleted := make([]uint, len(urls))
+		for i, url := range urls {
+			deleted[i] = url.ID
+		}
+		return tx.Where("id IN ? AND expires_at IS NOT NULL AND expires_at < ?", deleted, before).
+			Delete(&models.URL{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// FindPurgeable tìm link đã soft delete trước thời điểm deletedBefore
+func (r *URLRepositoryImpl) FindPurgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	var urls []models.URL
+	err := db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+		Order("deleted_at ASC, id ASC").
+		Limit(limit).
+		Find(&urls).Error
+	return urls, err
+}
+
 // GetStats lấy thống kê của URL
-func (r *URLRepositoryImpl) GetStats(shortCode string) (*models.URLStatsResponse, error) {
-	url, err := r.FindByShortCode(shortCode)
+func (r *URLRepositoryImpl) GetStats(ctx context.Context, shortCode string) (*models.URLStatsResponse, error) {
+	url, err := r.FindByShortCode(ctx, shortCode)
 	if err != nil {
 		return nil, fmt.Errorf("URL not found: %w", err)
 	}
 
 	stats := &models.URLStatsResponse{
+		URLID:       url.ID,
 		ShortCode:   url.ShortCode,
 		OriginalURL: url.OriginalURL,
 		TotalClicks: url.ClickCount,
@@ -79,3 +336,68 @@ func (r *URLRepositoryImpl) GetStats(shortCode string) (*models.URLStatsResponse
 
 	return stats, nil
 }
+
+// List liệt kê URL theo điều kiện lọc, sắp xếp và keyset cursor
+// Keyset (sort_column, id) dùng index idx_urls_<sort_column>_id nên không chậm dần như OFFSET
+func (r *URLRepositoryImpl) List(ctx context.Context, query *models.URLListQuery) ([]models.URL, error) {
+	db, cancel := r.session(ctx)
+	defer cancel()
+
+	sortColumn := "created_at"
+	if query.SortBy == "click_count" {
+		sortColumn = "click_count"
+	}
+
+	order, cmp := "ASC", ">"
+	if query.Descending {
+		order, cmp = "DESC", "<"
+	}
+
+	db = db.Model(&models.URL{})
+
+	if query.Cursor != nil {
+		var sortValue interface{} = query.Cursor.CreatedAt
+		if sortColumn == "click_count" {
+			sortValue = query.Cursor.ClickCount
+		}
+		db = db.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", sortColumn, cmp, sortColumn, cmp),
+			sortValue, sortValue, query.Cursor.ID,
+		)
+	}
+
+	if query.Search != "" {
+		like := likeOperator(db)
+		pattern := likePattern(query.Search)
+		db = db.Where(
+			fmt.Sprintf(`(original_url %s ? ESCAPE '\' OR short_code %s ? ESCAPE '\')`, like, like),
+			pattern, pattern,
+		)
+	}
+
+	if query.Expired != nil {
+		if *query.Expired {
+			db = db.Where("expires_at IS NOT NULL AND expires_at <= ?", query.Now)
+		} else {
+			db = db.Where("(expires_at IS NULL OR expires_at > ?)", query.Now)
+		}
+	}
+
+	if query.Custom != nil {
+		db = db.Where("is_custom = ?", *query.Custom)
+	}
+
+	if query.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *query.CreatedAfter)
+	}
+	if query.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *query.CreatedBefore)
+	}
+
+	var urls []models.URL
+	err := db.Order(fmt.Sprintf("%s %s, id %s", sortColumn, order, order)).
+		Limit(query.Limit).
+		Find(&urls).Error
+
+	return urls, err
+}
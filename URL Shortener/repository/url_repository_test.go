@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/migrations"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB mở SQLite in-memory với schema đầy đủ
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	sqliteDB, err := database.NewSQLiteDB(config.DatabaseConfig{Driver: "sqlite", SQLitePath: ":memory:"})
+	if err != nil {
+		t.Fatalf("NewSQLiteDB returned error: %v", err)
+	}
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	migrator, err := migrations.NewMigrator(sqliteDB.Gorm())
+	if err != nil {
+		t.Fatalf("NewMigrator returned error: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("Up returned error: %v", err)
+	}
+	return sqliteDB.Gorm()
+}
+
+// TestURLRepository_SQLite tests the URL repository on SQLite
+func TestURLRepository_SQLite(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+
+	url := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}
+	if err := repo.Create(ctx, url); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if err := repo.IncrementClickCount(ctx, "abc123"); err != nil {
+		t.Fatalf("IncrementClickCount returned error: %v", err)
+	}
+
+	found, err := repo.FindByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("FindByShortCode returned error: %v", err)
+	}
+	if found.ClickCount != 1 {
+		t.Errorf("ClickCount = %d, want 1", found.ClickCount)
+	}
+
+	if err := repo.Delete(ctx, "abc123"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := repo.FindByShortCode(ctx, "abc123"); err == nil {
+		t.Errorf("Expected deleted URL to be hidden")
+	}
+}
+
+// TestURLRepository_ContextCanceled tests queries stop when the request context is canceled
+func TestURLRepository_ContextCanceled(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+
+	if err := repo.Create(context.Background(), &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.FindByShortCode(ctx, "abc123"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindByShortCode error = %v, want context.Canceled", err)
+	}
+}
+
+// TestURLRepository_List tests keyset pagination, filters and search on SQLite
+func TestURLRepository_List(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+
+	base := time.Now().Add(-time.Hour)
+	expired := time.Now().Add(-time.Minute)
+	seed := []*models.URL{
+		{ShortCode: "aaaa11", OriginalURL: "https://example.com/100%_off", CreatedAt: base, ClickCount: 5},
+		{ShortCode: "bbbb22", OriginalURL: "https://golang.org/doc", CreatedAt: base.Add(time.Minute), ClickCount: 9, IsCustom: true},
+		{ShortCode: "cccc33", OriginalURL: "https://example.com/blog", CreatedAt: base.Add(2 * time.Minute), ExpiresAt: &expired},
+		{ShortCode: "dddd44", OriginalURL: "https://EXAMPLE.com/shop", CreatedAt: base.Add(3 * time.Minute), ClickCount: 5},
+	}
+	for _, url := range seed {
+		if err := repo.Create(ctx, url); err != nil {
+			t.Fatalf("Create returned error: %v", err)
+		}
+	}
+
+	codes := func(urls []models.URL) []string {
+		var result []string
+		for _, url := range urls {
+			result = append(result, url.ShortCode)
+		}
+		return result
+	}
+
+	// Trang 1 và trang 2 theo created_at giảm dần
+	page, err := repo.List(ctx, &models.URLListQuery{SortBy: "created_at", Descending: true, Limit: 2, Now: time.Now()})
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if got := codes(page); len(got) != 2 || got[0] != "dddd44" || got[1] != "cccc33" {
+		t.Fatalf("page 1 = %v, want [dddd44 cccc33]", got)
+	}
+	last := page[len(page)-1]
+	page, _ = repo.List(ctx, &models.URLListQuery{
+		SortBy: "created_at", Descending: true, Limit: 2, Now: time.Now(),
+		Cursor: &models.URLCursor{ID: last.ID, CreatedAt: last.CreatedAt},
+	})
+	if got := codes(page); len(got) != 2 || got[0] != "bbbb22" || got[1] != "aaaa11" {
+		t.Errorf("page 2 = %v, want [bbbb22 aaaa11]", got)
+	}
+
+	// Sắp xếp theo click_count, cùng số click thì theo id
+	page, _ = repo.List(ctx, &models.URLListQuery{SortBy: "click_count", Descending: true, Limit: 10, Now: time.Now()})
+	if got := codes(page); len(got) != 4 || got[0] != "bbbb22" || got[1] != "dddd44" || got[2] != "aaaa11" {
+		t.Errorf("click_count order = %v", got)
+	}
+
+	// Tìm kiếm không phân biệt hoa thường, ký tự % được escape
+	page, _ = repo.List(ctx, &models.URLListQuery{Search: "example.com", Limit: 10, Now: time.Now()})
+	if len(page) != 3 {
+		t.Errorf("search example.com = %v, want 3 results", codes(page))
+	}
+	page, _ = repo.List(ctx, &models.URLListQuery{Search: "100%", Limit: 10, Now: time.Now()})
+	if got := codes(page); len(got) != 1 || got[0] != "aaaa11" {
+		t.Errorf("search 100%% = %v, want [aaaa11]", got)
+	}
+
+	// Lọc theo hết hạn và custom code
+	yes := true
+	page, _ = repo.List(ctx, &models.URLListQuery{Expired: &yes, Limit: 10, Now: time.Now()})
+	if got := codes(page); len(got) != 1 || got[0] != "cccc33" {
+		t.Errorf("expired filter = %v, want [cccc33]", got)
+	}
+	page, _ = repo.List(ctx, &models.URLListQuery{Custom: &yes, Limit: 10, Now: time.Now()})
+	if got := codes(page); len(got) != 1 || got[0] != "bbbb22" {
+		t.Errorf("custom filter = %v, want [bbbb22]", got)
+	}
+}
+
+// TestURLRepository_UpdateWithRevision tests the update and its revision are stored together
+func TestURLRepository_UpdateWithRevision(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+
+	url := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com/old"}
+	if err := repo.Create(ctx, url); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	var savedURL string
+	updated, err := repo.Update(ctx, "abc123", func(current *models.URL) (*models.URLRevision, error) {
+		previous := &models.URLRevision{
+			URLID:       current.ID,
+			ShortCode:   current.ShortCode,
+			OriginalURL: current.OriginalURL,
+			Action:      models.RevisionActionUpdate,
+			ChangedBy:   "alice",
+			CreatedAt:   time.Now(),
+		}
+		current.OriginalURL = "https://example.com/new"
+		return previous, nil
+	}, func(saved *models.URL) error {
+		savedURL = saved.OriginalURL
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if updated.OriginalURL != "https://example.com/new" || savedURL != updated.OriginalURL {
+		t.Errorf("Update = %s, saved callback got %s, want https://example.com/new", updated.OriginalURL, savedURL)
+	}
+
+	found, _ := repo.FindByShortCode(ctx, "abc123")
+	if found.OriginalURL != "https://example.com/new" {
+		t.Errorf("OriginalURL = %s, want https://example.com/new", found.OriginalURL)
+	}
+
+	revisions, err := repo.ListRevisions(ctx, url.ID)
+	if err != nil || len(revisions) != 1 || revisions[0].OriginalURL != "https://example.com/old" {
+		t.Fatalf("ListRevisions = (%+v, %v)", revisions, err)
+	}
+	if _, err := repo.FindRevision(ctx, url.ID+1, revisions[0].ID); err == nil {
+		t.Errorf("Expected FindRevision to be scoped to the URL")
+	}
+
+	// Revision không hợp lệ (vi phạm khóa ngoại) làm rollback cả update
+	_, err = repo.Update(ctx, "abc123", func(current *models.URL) (*models.URLRevision, error) {
+		current.OriginalURL = "https://example.com/rolled-back"
+		return &models.URLRevision{URLID: 999, ShortCode: "abc123", OriginalURL: "x", Action: "update", ChangedBy: "bob", CreatedAt: time.Now()}, nil
+	}, nil)
+	if err == nil {
+		t.Fatalf("Expected Update with an orphan revision to fail")
+	}
+
+	// saved lỗi (không cập nhật được cache) cũng làm rollback
+	_, err = repo.Update(ctx, "abc123", func(current *models.URL) (*models.URLRevision, error) {
+		current.OriginalURL = "https://example.com/rolled-back"
+		return nil, nil
+	}, func(*models.URL) error { return errors.New("cache down") })
+	if err == nil {
+		t.Fatalf("Expected Update to fail when saved fails")
+	}
+	found, _ = repo.FindByShortCode(ctx, "abc123")
+	if found.OriginalURL != "https://example.com/new" {
+		t.Errorf("OriginalURL = %s, update should have been rolled back", found.OriginalURL)
+	}
+
+	if _, err := repo.Update(ctx, "nope42", func(*models.URL) (*models.URLRevision, error) { return nil, nil }, nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update of a missing link = %v, want ErrRecordNotFound", err)
+	}
+}
+
+// TestURLRepository_Trash tests restore and purge of soft-deleted links on SQLite
+func TestURLRepository_Trash(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+	analyticsRepo := NewAnalyticsRepository(db, time.Second)
+
+	url := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}
+	if err := repo.Create(ctx, url); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	analyticsRepo.SaveClickEvent(ctx, &models.ClickEvent{URLID: url.ID, ShortCode: "abc123", CreatedAt: time.Now()})
+
+	if err := repo.Purge(ctx, "abc123", false); err == nil {
+		t.Fatalf("Expected Purge of an active link to fail")
+	}
+
+	repo.Delete(ctx, "abc123")
+	if exists, _ := repo.ExistsShortCode(ctx, "abc123"); !exists {
+		t.Errorf("Expected short code of a deleted link to stay reserved")
+	}
+
+	deleted, err := repo.ListDeleted(ctx, 10, 0)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("ListDeleted = (%v, %v)", deleted, err)
+	}
+
+	if err := repo.Restore(ctx, "abc123"); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+	if _, err := repo.FindByShortCode(ctx, "abc123"); err != nil {
+		t.Errorf("FindByShortCode after restore returned error: %v", err)
+	}
+
+	repo.Delete(ctx, "abc123")
+	if err := repo.Purge(ctx, "abc123", false); err != nil {
+		t.Fatalf("Purge returned error: %v", err)
+	}
+	if exists, _ := repo.ExistsShortCode(ctx, "abc123"); exists {
+		t.Errorf("Expected short code to be free after purge")
+	}
+
+	var clicks int64
+	db.Model(&models.ClickEvent{}).Where("short_code = ?", "abc123").Count(&clicks)
+	if clicks != 0 {
+		t.Errorf("Expected click events to be purged, %d left", clicks)
+	}
+}
+
+func TestURLRepository_ExpireAndArchive(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewURLRepository(db, time.Second)
+	analyticsRepo := NewAnalyticsRepository(db, time.Second)
+
+	past := time.Now().Add(-48 * time.Hour)
+	expired := &models.URL{ShortCode: "old123", OriginalURL: "https://example.com/old", ExpiresAt: &past}
+	active := &models.URL{ShortCode: "new123", OriginalURL: "https://example.com/new"}
+	repo.Create(ctx, expired)
+	repo.Create(ctx, active)
+	analyticsRepo.SaveClickEvent(ctx, &models.ClickEvent{URLID: expired.ID, ShortCode: "old123", CreatedAt: time.Now()})
+
+	found, err := repo.FindExpired(ctx, time.Now().Add(-24*time.Hour), 10)
+	if err != nil || len(found) != 1 || found[0].ShortCode != "old123" {
+		t.Fatalf("FindExpired = (%v, %v)", found, err)
+	}
+
+	// Link vừa được gia hạn sau FindExpired không bị xóa
+	extended := time.Now().Add(time.Hour)
+	active.ExpiresAt = &extended
+	db.Save(active)
+	deleted, err := repo.DeleteExpired(ctx, []uint{expired.ID, active.ID}, time.Now().Add(-24*time.Hour))
+	if err != nil || len(deleted) != 1 || deleted[0].ID != expired.ID {
+		t.Fatalf("DeleteExpired = (%v, %v), want only the expired link", deleted, err)
+	}
+	if _, err := repo.FindByShortCode(ctx, "new123"); err != nil {
+		t.Errorf("Extended link was deleted: %v", err)
+	}
+	if found, _ := repo.FindExpired(ctx, time.Now(), 10); len(found) != 0 {
+		t.Errorf("Expected no expired links after delete, got %d", len(found))
+	}
+
+	purgeable, err := repo.FindPurgeable(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil || len(purgeable) != 1 {
+		t.Fatalf("FindPurgeable = (%v, %v)", purgeable, err)
+	}
+
+	if err := repo.Purge(ctx, "old123", true); err != nil {
+		t.Fatalf("Purge returned error: %v", err)
+	}
+
+	var archived int64
+	db.Table("click_events_archive").Where("short_code = ?", "old123").Count(&archived)
+	if archived != 1 {
+		t.Errorf("Expected 1 archived click event, got %d", archived)
+	}
+	var rollups int64
+	db.Model(&models.ClickRollupDaily{}).Where("url_id = ?", expired.ID).Count(&rollups)
+	if rollups != 0 {
+		t.Errorf("Expected rollups of purged link to be deleted, got %d", rollups)
+	}
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"url-shortener/models"
+)
+
+const (
+	// visitorKeyPrefix là prefix của các HyperLogLog đếm người xem
+	visitorKeyPrefix = "visitors:"
+	// visitorDailyRetention là thời gian giữ bộ đếm theo ngày, dài hơn khoảng 7 ngày của thống kê
+	visitorDailyRetention = 35 * 24 * time.Hour
+	// visitorDateLayout giống định dạng ngày (UTC) của clicks_by_date
+	visitorDateLayout = "2006-01-02"
+)
+
+// visit là một lượt xem đã được băm, dùng để đếm người xem duy nhất
+type visit struct {
+	urlID uint
+	date  string
+	hash  [sha256.Size]byte
+}
+
+// countableVisits chuyển click events thành các lượt xem cần đếm
+// Bỏ qua click từ bot và click chưa gắn với link (event cũ trong queue chưa có url_id)
+func countableVisits(salt string, events []*models.ClickEvent) []visit {
+	visits := make([]visit, 0, len(events))
+	for _, event := range events {
+		if event.IsBot || event.URLID == 0 {
+			continue
+		}
+		visits = append(visits, visit{
+			urlID: event.URLID,
+			date:  event.CreatedAt.UTC().Format(visitorDateLayout),
+			hash:  sha256.Sum256([]byte(salt + "\x00" + event.IPAddress + "\x00" + event.UserAgent)),
+		})
+	}
+	return visits
+}
+
+// id trả về định danh người xem gửi cho Redis (128 bit đầu của hash)
+func (v visit) id() string {
+	return hex.EncodeToString(v.hash[:16])
+}
+
+// hash64 trả về 64 bit đầu của hash cho HyperLogLog trong process
+func (v visit) hash64() uint64 {
+	return binary.BigEndian.Uint64(v.hash[:8])
+}
+
+// visitorTotalKey là key đếm người xem từ trước tới nay của link
+// Dùng id thay vì short code để short code được dùng lại sau khi purge không mang số liệu cũ
+func visitorTotalKey(urlID uint) string {
+	return fmt.Sprintf("%s%d", visitorKeyPrefix, urlID)
+}
+
+// visitorDailyKey là key đếm người xem của link trong một ngày
+func visitorDailyKey(urlID uint, date string) string {
+	return fmt.Sprintf("%s%d:%s", visitorKeyPrefix, urlID, date)
+}
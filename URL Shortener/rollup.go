@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/database"
+	"url-shortener/repository"
+)
+
+// rollupBackfillBatchSize là số link được tính lại trong mỗi transaction
+const rollupBackfillBatchSize = 500
+
+// runRollupCommand xử lý subcommand: url-shortener rollup backfill [AFTER_ID]
+// Tính lại click_rollups_* từ click_events. Migration 0011 đã tính rollup khi nâng cấp, lệnh này dùng để
+// sửa rollup bị lệch; chạy được khi service đang chạy (click worker chờ link đang được tính lại) và chạy lại nhiều lần.
+// AFTER_ID cho phép tiếp tục từ link cuối cùng đã xử lý khi lần chạy trước bị dừng giữa chừng
+func runRollupCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return errors.New("usage: url-shortener rollup backfill [AFTER_ID]")
+	}
+
+	if cfg.Database.Driver == "memory" {
+		return errors.New("rollups are not used by the memory driver")
+	}
+
+	var afterID uint
+	if len(args) > 1 {
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid link id: %s", args[1])
+		}
+		afterID = uint(id)
+	}
+
+	sqlDB, err := database.NewSQLDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	// Mỗi batch quét toàn bộ click events của 500 link, không áp dụng DB_QUERY_TIMEOUT
+	analyticsRepo := repository.NewAnalyticsRepository(sqlDB.Gorm(), 0)
+
+	start := time.Now()
+	total := 0
+	for {
+		lastID, n, err := analyticsRepo.BackfillRollups(context.Background(), afterID, rollupBackfillBatchSize)
+		if err != nil {
+			return fmt.Errorf("backfill stopped after link %d (resume with: rollup backfill %d): %w", afterID, afterID, err)
+		}
+		if n == 0 {
+			break
+		}
+		afterID = lastID
+		total += n
+		log.Printf("Rebuilt rollups of %d links (up to id %d)", total, afterID)
+	}
+
+	log.Printf("✅ Rollups rebuilt for %d links in %v", total, time.Since(start).Round(time.Millisecond))
+	return nil
+}
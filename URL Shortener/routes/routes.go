@@ -7,14 +7,19 @@ import (
 )
 
 // SetupRoutes cấu hình tất cả routes cho ứng dụng
-func SetupRoutes(router *gin.Engine, urlHandler *handlers.URLHandler) {
+func SetupRoutes(
+	router *gin.Engine,
+	urlHandler *handlers.URLHandler,
+	adminHandler *handlers.AdminHandler,
+	healthHandler *handlers.HealthHandler,
+) {
 	// Middleware
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(CORSMiddleware())
 
 	// Health check
-	router.GET("/health", urlHandler.HealthCheck)
+	router.GET("/health", healthHandler.HealthCheck)
 
 	// API routes
 	api := router.Group("/api")
@@ -25,8 +30,33 @@ func SetupRoutes(router *gin.Engine, urlHandler *handlers.URLHandler) {
 		// Lấy thống kê
 		api.GET("/stats/:shortCode", urlHandler.GetURLStats)
 
-		// Xóa URL
+		// Liệt kê, tìm kiếm và phân trang URL
+		api.GET("/urls", urlHandler.ListURLs)
+
+		// Sửa destination và thiết lập của URL
+		api.PATCH("/urls/:shortCode", urlHandler.UpdateURL)
+
+		// Lịch sử thay đổi và rollback
+		api.GET("/urls/:shortCode/revisions", urlHandler.ListRevisions)
+		api.POST("/urls/:shortCode/revisions/:id/restore", urlHandler.RestoreRevision)
+
+		// Xóa URL (chuyển vào thùng rác)
 		api.DELETE("/urls/:shortCode", urlHandler.DeleteURL)
+
+		// Thùng rác: liệt kê, khôi phục, xóa vĩnh viễn
+		api.GET("/trash", urlHandler.ListTrash)
+		api.POST("/trash/:shortCode/restore", urlHandler.RestoreURL)
+		api.DELETE("/trash/:shortCode", urlHandler.PurgeURL)
+	}
+
+	// Admin routes: vận hành các job nền
+	admin := api.Group("/admin")
+	{
+		admin.GET("/janitor", adminHandler.GetJanitorStats)
+		admin.POST("/janitor/run", adminHandler.RunJanitor)
+		admin.GET("/cache", adminHandler.GetCacheStats)
+		admin.POST("/cache/warmup", adminHandler.WarmUpCache)
+		admin.GET("/analytics", adminHandler.GetAnalyticsStats)
 	}
 
 	// Redirect route (phải đặt cuối cùng vì là catch-all)
@@ -42,8 +72,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Actor")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
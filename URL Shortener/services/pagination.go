@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"url-shortener/models"
+)
+
+// Giới hạn số bản ghi mỗi trang của GET /api/urls
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// listCursor là nội dung của cursor trả cho client (base64 JSON).
+// SortBy được lưu kèm để cursor không bị dùng với kiểu sắp xếp khác
+type listCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d"`
+	models.URLCursor
+}
+
+// encodeCursor mã hóa vị trí bản ghi cuối trang thành chuỗi opaque
+func encodeCursor(query *models.URLListQuery, last *models.URL) string {
+	cursor := listCursor{
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		URLCursor:  models.URLCursor{ID: last.ID},
+	}
+	if query.SortBy == "click_count" {
+		cursor.ClickCount = last.ClickCount
+	} else {
+		cursor.CreatedAt = last.CreatedAt
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor giải mã cursor và kiểm tra nó khớp với kiểu sắp xếp hiện tại
+func decodeCursor(raw string, query *models.URLListQuery) (*models.URLCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.SortBy != query.SortBy || cursor.Descending != query.Descending {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor.URLCursor, nil
+}
@@ -1,38 +1,61 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"url-shortener/config"
 	"url-shortener/generator"
+	"url-shortener/interfaces"
 	"url-shortener/models"
 	"url-shortener/repository"
 	"url-shortener/workers"
 
-	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
+// Các lỗi nghiệp vụ để handler map sang HTTP status phù hợp
+var (
+	ErrInvalidURL        = errors.New("URL must start with http:// or https://")
+	ErrInvalidCustomCode = errors.New("invalid custom code format")
+	ErrCustomCodeExists  = errors.New("custom code already exists")
+	ErrURLNotFound       = errors.New("short URL not found")
+	ErrURLExpired        = errors.New("short URL has expired")
+	ErrInvalidCursor     = errors.New("invalid or mismatched cursor")
+	ErrInvalidListQuery  = errors.New("invalid list query")
+	ErrInvalidUpdate     = errors.New("invalid update request")
+	ErrRevisionNotFound  = errors.New("revision not found")
+	ErrNotInTrash        = errors.New("short URL is not in trash")
+)
+
 // URLServiceImpl là implementation của URLService
 type URLServiceImpl struct {
-	urlRepo       *repository.URLRepositoryImpl
-	cacheRepo     *repository.CacheRepositoryImpl
-	analyticsRepo *repository.AnalyticsRepositoryImpl
+	urlRepo       interfaces.URLRepository
+	cacheRepo     interfaces.CacheRepository
+	analyticsRepo interfaces.AnalyticsRepository
 	generator     *generator.ShortCodeGeneratorImpl
 	config        *config.Config
 	clickWorker   *workers.ClickAnalyticsWorker
+	botClassifier interfaces.BotClassifier
+	visitors      interfaces.UniqueVisitorCounter
+	lookups       singleflight.Group // Gộp các lần đọc database khi cache miss
 }
 
 // NewURLService tạo instance mới của URLService
 func NewURLService(
-	urlRepo *repository.URLRepositoryImpl,
-	cacheRepo *repository.CacheRepositoryImpl,
-	analyticsRepo *repository.AnalyticsRepositoryImpl,
+	urlRepo interfaces.URLRepository,
+	cacheRepo interfaces.CacheRepository,
+	analyticsRepo interfaces.AnalyticsRepository,
 	cfg *config.Config,
 	clickWorker *workers.ClickAnalyticsWorker,
+	botClassifier interfaces.BotClassifier,
+	visitors interfaces.UniqueVisitorCounter,
 ) *URLServiceImpl {
 	return &URLServiceImpl{
 		urlRepo:       urlRepo,
@@ -41,13 +64,19 @@ func NewURLService(
 		generator:     generator.NewShortCodeGenerator(cfg.App.ShortCodeLength),
 		config:        cfg,
 		clickWorker:   clickWorker,
+		botClassifier: botClassifier,
+		visitors:      visitors,
 	}
 }
 
 // CreateShortURL tạo short URL mới
-func (s *URLServiceImpl) CreateShortURL(req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
+func (s *URLServiceImpl) CreateShortURL(ctx context.Context, req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
+	if !isValidURL(req.OriginalURL) {
+		return nil, ErrInvalidURL
+	}
+
 	// Kiểm tra URL đã tồn tại chưa (tránh duplicate)
-	existingURL, err := s.urlRepo.FindByOriginalURL(req.OriginalURL)
+	existingURL, err := s.urlRepo.FindByOriginalURL(ctx, req.OriginalURL)
 	if err == nil && existingURL != nil {
 		// URL đã tồn tại, trả về link cũ
 		return &models.CreateURLResponse{
@@ -58,27 +87,31 @@ func (s *URLServiceImpl) CreateShortURL(req *models.CreateURLRequest) (*models.C
 	}
 
 	var shortCode string
+	var isCustom bool
 
 	// Sử dụng custom code nếu được cung cấp
 	if req.CustomCode != "" {
 		// Validate custom code
 		if !s.generator.IsValid(req.CustomCode) {
-			return nil, errors.New("invalid custom code format")
+			return nil, ErrInvalidCustomCode
 		}
 
 		// Kiểm tra custom code đã tồn tại chưa
-		exists, err := s.urlRepo.ExistsShortCode(req.CustomCode)
+		exists, err := s.urlRepo.ExistsShortCode(ctx, req.CustomCode)
 		if err != nil {
 			return nil, fmt.Errorf("failed to check custom code: %w", err)
 		}
 		if exists {
-			return nil, errors.New("custom code already exists")
+			if err := s.reclaimDeletedCode(ctx, req.CustomCode); err != nil {
+				return nil, err
+			}
 		}
 
 		shortCode = req.CustomCode
+		isCustom = true
 	} else {
 		// Generate short code unique
-		shortCode, err = s.generateUniqueShortCode()
+		shortCode, err = s.generateUniqueShortCode(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -89,6 +122,7 @@ func (s *URLServiceImpl) CreateShortURL(req *models.CreateURLRequest) (*models.C
 		ShortCode:   shortCode,
 		OriginalURL: req.OriginalURL,
 		ClickCount:  0,
+		IsCustom:    isCustom,
 	}
 
 	// Set expiration nếu được cung cấp
@@ -98,12 +132,12 @@ func (s *URLServiceImpl) CreateShortURL(req *models.CreateURLRequest) (*models.C
 	}
 
 	// Lưu vào database
-	if err := s.urlRepo.Create(url); err != nil {
+	if err := s.urlRepo.Create(ctx, url); err != nil {
 		return nil, fmt.Errorf("failed to create URL: %w", err)
 	}
 
 	// Cache URL để redirect nhanh
-	if err := s.cacheRepo.Set(shortCode, req.OriginalURL); err != nil {
+	if err := s.cacheRepo.Set(ctx, shortCode, models.NewCachedURL(url)); err != nil {
 		// Log lỗi nhưng không fail request
 		log.Printf("Warning: failed to cache URL: %v", err)
 	}
@@ -121,14 +155,40 @@ func (s *URLServiceImpl) CreateShortURL(req *models.CreateURLRequest) (*models.C
 	return response, nil
 }
 
+// reclaimDeletedCode cho phép dùng lại short code của link đã xóa quá thời gian lưu giữ.
+// Trong thời gian lưu giữ link vẫn có thể khôi phục nên code chưa được cấp lại;
+// sau đó link cũ bị purge (kèm analytics) để nhường code cho link mới
+func (s *URLServiceImpl) reclaimDeletedCode(ctx context.Context, shortCode string) error {
+	deleted, err := s.urlRepo.FindDeletedByShortCode(ctx, shortCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Code đang được một link còn hoạt động sử dụng
+			return ErrCustomCodeExists
+		}
+		return fmt.Errorf("failed to check custom code: %w", err)
+	}
+
+	reusableAt := deleted.DeletedAt.Time.Add(s.config.App.DeletedCodeRetention)
+	if time.Now().Before(reusableAt) {
+		return fmt.Errorf("%w: it belongs to a deleted link and is reusable after %s",
+			ErrCustomCodeExists, reusableAt.Format(time.RFC3339))
+	}
+
+	if err := s.urlRepo.Purge(ctx, shortCode, false); err != nil {
+		return fmt.Errorf("failed to purge deleted link: %w", err)
+	}
+	log.Printf("Purged deleted link %s to reuse its short code", shortCode)
+	return nil
+}
+
 // generateUniqueShortCode tạo short code unique
-func (s *URLServiceImpl) generateUniqueShortCode() (string, error) {
+func (s *URLServiceImpl) generateUniqueShortCode(ctx context.Context) (string, error) {
 	maxAttempts := 10
 
 	for i := 0; i < maxAttempts; i++ {
 		shortCode := s.generator.Generate()
 
-		exists, err := s.urlRepo.ExistsShortCode(shortCode)
+		exists, err := s.urlRepo.ExistsShortCode(ctx, shortCode)
 		if err != nil {
 			return "", fmt.Errorf("failed to check short code: %w", err)
 		}
@@ -141,63 +201,146 @@ func (s *URLServiceImpl) generateUniqueShortCode() (string, error) {
 	return "", errors.New("failed to generate unique short code after max attempts")
 }
 
+// isValidURL kiểm tra URL có hợp lệ không
+func isValidURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
 // GetOriginalURL lấy original URL từ short code
-// Ưu tiên lấy từ cache để tối ưu hiệu năng
-func (s *URLServiceImpl) GetOriginalURL(shortCode string) (string, error) {
+func (s *URLServiceImpl) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
+	entry, err := s.ResolveURL(ctx, shortCode)
+	if err != nil {
+		return "", err
+	}
+	return entry.OriginalURL, nil
+}
+
+// ResolveURL lấy destination và id của link từ short code cho redirect
+// Ưu tiên lấy từ cache để tối ưu hiệu năng; id đi kèm để click event gắn được với link
+func (s *URLServiceImpl) ResolveURL(ctx context.Context, shortCode string) (*models.CachedURL, error) {
 	// 1. Thử lấy từ cache trước (Redis - cực nhanh)
-	originalURL, err := s.cacheRepo.Get(shortCode)
-	if err == nil && originalURL != "" {
+	// Cache entry mang theo expires_at nên fast path vẫn kiểm tra được hết hạn
+	cached, err := s.cacheRepo.Get(ctx, shortCode)
+	if err == nil && cached.NotFound {
 		log.Printf("Cache HIT for short code: %s", shortCode)
-		return originalURL, nil
+		return nil, ErrURLNotFound
+	}
+	if err == nil && cached.OriginalURL != "" {
+		if cached.ID != 0 {
+			log.Printf("Cache HIT for short code: %s", shortCode)
+			if cached.IsExpired() {
+				return nil, ErrURLExpired
+			}
+			return cached, nil
+		}
+
+		// Entry được cache trước khi có id, xóa để nạp lại bản đầy đủ từ database
+		if err := s.cacheRepo.Delete(ctx, shortCode); err != nil {
+			log.Printf("Warning: failed to delete legacy cache entry: %v", err)
+		}
 	}
 
 	// Cache miss hoặc lỗi Redis
-	if err != nil && err != redis.Nil {
+	if err != nil && !errors.Is(err, repository.ErrCacheMiss) {
 		log.Printf("Cache error: %v", err)
 	}
 
 	log.Printf("Cache MISS for short code: %s", shortCode)
 
 	// 2. Fallback: Lấy từ database
-	url, err := s.urlRepo.FindByShortCode(shortCode)
+	// Các request miss đồng thời cho cùng short code dùng chung một lần truy vấn.
+	// Truy vấn không gắn với việc hủy của request đầu tiên để các request đang chờ không bị lỗi theo
+	result, err, _ := s.lookups.Do(shortCode, func() (interface{}, error) {
+		return s.loadURL(context.WithoutCancel(ctx), shortCode)
+	})
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", errors.New("short URL not found")
-		}
-		return "", fmt.Errorf("failed to find URL: %w", err)
+		return nil, err
 	}
+	url := result.(*models.URL)
 
 	// 3. Kiểm tra expiration
 	if url.IsExpired() {
-		return "", errors.New("short URL has expired")
+		return nil, ErrURLExpired
+	}
+
+	return models.NewCachedURL(url), nil
+}
+
+// loadURL đọc URL từ database rồi nạp vào cache
+// Short code không tồn tại được cache ngắn hạn để scanner không dội thẳng vào database
+func (s *URLServiceImpl) loadURL(ctx context.Context, shortCode string) (*models.URL, error) {
+	url, err := s.urlRepo.FindByShortCode(ctx, shortCode)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if _, err := s.cacheRepo.SetIfAbsent(ctx, shortCode, models.NewNotFoundCachedURL(s.config.Cache.NegativeTTL)); err != nil {
+			log.Printf("Warning: failed to cache missing short code: %v", err)
+		}
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find URL: %w", err)
 	}
 
-	// 4. Cache lại để lần sau nhanh hơn
-	if err := s.cacheRepo.Set(shortCode, url.OriginalURL); err != nil {
+	// Cache lại để lần sau nhanh hơn
+	// Dùng SET NX: nếu UpdateURL đã ghi giá trị mới trong lúc ta đọc database,
+	// giá trị cũ ta vừa đọc sẽ không ghi đè lên
+	if _, err := s.cacheRepo.SetIfAbsent(ctx, shortCode, models.NewCachedURL(url)); err != nil {
 		log.Printf("Warning: failed to cache URL: %v", err)
 	}
 
-	return url.OriginalURL, nil
+	return url, nil
 }
 
 // GetStats lấy thống kê của URL
-func (s *URLServiceImpl) GetStats(shortCode string) (*models.URLStatsResponse, error) {
-	// Lấy thông tin cơ bản
-	stats, err := s.urlRepo.GetStats(shortCode)
+// Mặc định click từ bot không được tính, includeBots = true thì tính cả
+func (s *URLServiceImpl) GetStats(ctx context.Context, shortCode string, includeBots bool) (*models.URLStatsResponse, error) {
+	// Lấy thông tin cơ bản (click_count chỉ đếm người dùng thật)
+	stats, err := s.urlRepo.GetStats(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
 
+	botClicks, err := s.analyticsRepo.CountBotClicks(ctx, shortCode)
+	if err != nil {
+		log.Printf("Warning: failed to count bot clicks: %v", err)
+	} else {
+		stats.BotClicks = botClicks
+	}
+	if includeBots {
+		stats.TotalClicks += stats.BotClicks
+		stats.IncludesBots = true
+	}
+
 	// Lấy clicks theo ngày (7 ngày gần nhất)
-	clicksByDate, err := s.analyticsRepo.GetClicksByDate(shortCode, 7)
+	clicksByDate, err := s.analyticsRepo.GetClicksByDate(ctx, shortCode, 7, includeBots)
 	if err != nil {
 		log.Printf("Warning: failed to get clicks by date: %v", err)
 	} else {
 		stats.ClicksByDate = clicksByDate
 	}
 
+	// Lấy clicks theo giờ (24 giờ gần nhất)
+	clicksByHour, err := s.analyticsRepo.GetClicksByHour(ctx, shortCode, 24, includeBots)
+	if err != nil {
+		log.Printf("Warning: failed to get clicks by hour: %v", err)
+	} else {
+		stats.ClicksByHour = clicksByHour
+	}
+
+	// Người xem duy nhất (HyperLogLog, không tính bot) cho cùng các ngày của clicks_by_date
+	dates := make([]string, 0, len(clicksByDate))
+	for date := range clicksByDate {
+		dates = append(dates, date)
+	}
+	uniqueVisitors, uniqueByDate, err := s.visitors.Count(ctx, stats.URLID, dates)
+	if err != nil {
+		log.Printf("Warning: failed to count unique visitors: %v", err)
+	} else {
+		stats.UniqueVisitors = uniqueVisitors
+		stats.UniqueByDate = uniqueByDate
+	}
+
 	// Lấy top referers
-	topReferers, err := s.analyticsRepo.GetTopReferers(shortCode, 5)
+	topReferers, err := s.analyticsRepo.GetTopReferers(ctx, shortCode, 5, includeBots)
 	if err != nil {
 		log.Printf("Warning: failed to get top referers: %v", err)
 	} else {
@@ -205,26 +348,300 @@ func (s *URLServiceImpl) GetStats(shortCode string) (*models.URLStatsResponse, e
 	}
 
 	// Lấy top countries
-	topCountries, err := s.analyticsRepo.GetTopCountries(shortCode, 5)
+	topCountries, err := s.analyticsRepo.GetTopCountries(ctx, shortCode, 5, includeBots)
 	if err != nil {
 		log.Printf("Warning: failed to get top countries: %v", err)
 	} else {
 		stats.TopCountries = topCountries
 	}
 
+	// Phân bố thiết bị, trình duyệt, hệ điều hành
+	topDevices, err := s.analyticsRepo.GetTopDevices(ctx, shortCode, 5, includeBots)
+	if err != nil {
+		log.Printf("Warning: failed to get top devices: %v", err)
+	} else {
+		stats.TopDevices = topDevices
+	}
+
+	topBrowsers, err := s.analyticsRepo.GetTopBrowsers(ctx, shortCode, 5, includeBots)
+	if err != nil {
+		log.Printf("Warning: failed to get top browsers: %v", err)
+	} else {
+		stats.TopBrowsers = topBrowsers
+	}
+
+	topOS, err := s.analyticsRepo.GetTopOS(ctx, shortCode, 5, includeBots)
+	if err != nil {
+		log.Printf("Warning: failed to get top OS: %v", err)
+	} else {
+		stats.TopOS = topOS
+	}
+
 	return stats, nil
 }
 
+// ListURLs liệt kê, tìm kiếm và phân trang URL bằng keyset cursor
+func (s *URLServiceImpl) ListURLs(ctx context.Context, req *models.ListURLsRequest) (*models.ListURLsResponse, error) {
+	query := &models.URLListQuery{
+		SortBy:        req.SortBy,
+		Descending:    true,
+		Limit:         req.Limit,
+		Search:        strings.TrimSpace(req.Search),
+		Expired:       req.Expired,
+		Custom:        req.Custom,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		Now:           time.Now(),
+	}
+
+	switch query.SortBy {
+	case "":
+		query.SortBy = "created_at"
+	case "created_at", "click_count":
+	default:
+		return nil, fmt.Errorf("%w: sort_by must be created_at or click_count", ErrInvalidListQuery)
+	}
+
+	switch req.Order {
+	case "", "desc":
+	case "asc":
+		query.Descending = false
+	default:
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidListQuery)
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit > maxPageSize {
+		query.Limit = maxPageSize
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor, query)
+		if err != nil {
+			return nil, err
+		}
+		query.Cursor = cursor
+	}
+
+	// Lấy thêm một bản ghi để biết còn trang sau hay không
+	pageSize := query.Limit
+	query.Limit++
+
+	urls, err := s.urlRepo.List(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list URLs: %w", err)
+	}
+
+	response := &models.ListURLsResponse{
+		Items: make([]models.URLResponse, 0, pageSize),
+	}
+
+	if len(urls) > pageSize {
+		urls = urls[:pageSize]
+		response.NextCursor = encodeCursor(query, &urls[len(urls)-1])
+	}
+
+	for i := range urls {
+		response.Items = append(response.Items, *s.toURLResponse(&urls[i]))
+	}
+
+	return response, nil
+}
+
+// UpdateURL thay đổi destination và thời hạn của URL mà vẫn giữ nguyên analytics
+// Giá trị cũ được lưu vào lịch sử cùng người thực hiện (actor)
+func (s *URLServiceImpl) UpdateURL(ctx context.Context, shortCode string, req *models.UpdateURLRequest, actor string) (*models.URLResponse, error) {
+	if req.OriginalURL == nil && req.ExpiresIn == nil {
+		return nil, fmt.Errorf("%w: nothing to update", ErrInvalidUpdate)
+	}
+	if req.OriginalURL != nil && !isValidURL(*req.OriginalURL) {
+		return nil, ErrInvalidURL
+	}
+	if req.ExpiresIn != nil && *req.ExpiresIn < 0 {
+		return nil, fmt.Errorf("%w: expires_in must not be negative", ErrInvalidUpdate)
+	}
+
+	url, err := s.saveURL(ctx, shortCode, func(url *models.URL) (*models.URLRevision, error) {
+		previous := newRevision(url, models.RevisionActionUpdate, actor)
+		if req.OriginalURL != nil {
+			url.OriginalURL = *req.OriginalURL
+		}
+		if req.ExpiresIn != nil {
+			if *req.ExpiresIn == 0 {
+				url.ExpiresAt = nil
+			} else {
+				expiresAt := time.Now().Add(time.Duration(*req.ExpiresIn) * time.Hour)
+				url.ExpiresAt = &expiresAt
+			}
+		}
+		return previous, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toURLResponse(url), nil
+}
+
+// ListRevisions lấy lịch sử thay đổi của URL, mới nhất trước
+func (s *URLServiceImpl) ListRevisions(ctx context.Context, shortCode string) ([]models.URLRevisionResponse, error) {
+	url, err := s.findURL(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.urlRepo.ListRevisions(ctx, url.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	response := make([]models.URLRevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		item := models.URLRevisionResponse{
+			ID:          revision.ID,
+			OriginalURL: revision.OriginalURL,
+			Action:      revision.Action,
+			ChangedBy:   revision.ChangedBy,
+			ChangedAt:   revision.CreatedAt.Format(time.RFC3339),
+		}
+		if revision.ExpiresAt != nil {
+			item.ExpiresAt = revision.ExpiresAt.Format(time.RFC3339)
+		}
+		response = append(response, item)
+	}
+
+	return response, nil
+}
+
+// RestoreRevision đưa original_url và expires_at của URL về một phiên bản cũ
+// Bản thân thao tác restore cũng được ghi vào lịch sử nên có thể undo
+func (s *URLServiceImpl) RestoreRevision(ctx context.Context, shortCode string, revisionID uint, actor string) (*models.URLResponse, error) {
+	url, err := s.findURL(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.urlRepo.FindRevision(ctx, url.ID, revisionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("failed to find revision: %w", err)
+	}
+
+	url, err = s.saveURL(ctx, shortCode, func(current *models.URL) (*models.URLRevision, error) {
+		// Short code đã bị purge và dùng lại trong lúc đọc revision
+		if current.ID != revision.URLID {
+			return nil, ErrRevisionNotFound
+		}
+		previous := newRevision(current, models.RevisionActionRestore, actor)
+		current.OriginalURL = revision.OriginalURL
+		current.ExpiresAt = revision.ExpiresAt
+		return previous, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toURLResponse(url), nil
+}
+
+// findURL tìm URL chưa bị xóa theo short code
+func (s *URLServiceImpl) findURL(ctx context.Context, shortCode string) (*models.URL, error) {
+	url, err := s.urlRepo.FindByShortCode(ctx, shortCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrURLNotFound
+		}
+		return nil, fmt.Errorf("failed to find URL: %w", err)
+	}
+	return url, nil
+}
+
+// saveURL khóa URL, áp dụng change và lưu kèm lịch sử rồi ghi đè cache bằng dòng đã lưu
+func (s *URLServiceImpl) saveURL(ctx context.Context, shortCode string, change func(url *models.URL) (*models.URLRevision, error)) (*models.URL, error) {
+	// Client ngắt kết nối giữa chừng không được bỏ dở việc cập nhật cache
+	cacheCtx := context.WithoutCancel(ctx)
+	cached := false
+
+	// Cache được ghi đè bằng một lệnh SET khi transaction còn giữ khóa của dòng:
+	// các update đồng thời ghi cache theo đúng thứ tự commit nên cache không giữ destination của
+	// update thua, và không có khoảng trống nào để replica khác nạp lại destination cũ
+	url, err := s.urlRepo.Update(ctx, shortCode, change, func(url *models.URL) error {
+		cached = true
+		if err := s.cacheRepo.Set(cacheCtx, shortCode, models.NewCachedURL(url)); err != nil {
+			log.Printf("Warning: failed to overwrite cached URL: %v", err)
+
+			// Không ghi được thì xóa key để lần redirect sau đọc từ database
+			if err := s.cacheRepo.Delete(cacheCtx, shortCode); err != nil {
+				return fmt.Errorf("cache invalidation failed, retry the update: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Cache đã nhận giá trị chưa được commit, xóa để lần redirect sau đọc lại từ database
+		if cached {
+			if err := s.cacheRepo.Delete(cacheCtx, shortCode); err != nil {
+				log.Printf("Warning: failed to delete cached URL after failed update: %v", err)
+			}
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrURLNotFound
+		}
+		if errors.Is(err, ErrRevisionNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update URL: %w", err)
+	}
+
+	return url, nil
+}
+
+// newRevision chụp lại giá trị hiện tại của URL trước khi bị thay đổi
+func newRevision(url *models.URL, action string, actor string) *models.URLRevision {
+	return &models.URLRevision{
+		URLID:       url.ID,
+		ShortCode:   url.ShortCode,
+		OriginalURL: url.OriginalURL,
+		ExpiresAt:   url.ExpiresAt,
+		Action:      action,
+		ChangedBy:   actor,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// toURLResponse chuyển model URL thành response trả về cho client
+func (s *URLServiceImpl) toURLResponse(url *models.URL) *models.URLResponse {
+	response := &models.URLResponse{
+		ShortCode:   url.ShortCode,
+		ShortURL:    fmt.Sprintf("%s/%s", s.config.Server.BaseURL, url.ShortCode),
+		OriginalURL: url.OriginalURL,
+		ClickCount:  url.ClickCount,
+		IsCustom:    url.IsCustom,
+		Expired:     url.IsExpired(),
+		CreatedAt:   url.CreatedAt.Format(time.RFC3339),
+	}
+	if url.ExpiresAt != nil {
+		response.ExpiresAt = url.ExpiresAt.Format(time.RFC3339)
+	}
+	return response
+}
+
 // DeleteURL xóa URL
-func (s *URLServiceImpl) DeleteURL(shortCode string) error {
+func (s *URLServiceImpl) DeleteURL(ctx context.Context, shortCode string) error {
 	// Xóa từ database
-	if err := s.urlRepo.Delete(shortCode); err != nil {
+	if err := s.urlRepo.Delete(ctx, shortCode); err != nil {
 		return fmt.Errorf("failed to delete URL: %w", err)
 	}
 
-	// Xóa từ cache
-	if err := s.cacheRepo.Delete(shortCode); err != nil {
-		log.Printf("Warning: failed to delete URL from cache: %v", err)
+	// Ghi đè cache bằng tombstone thay vì xóa key, kể cả khi client đã ngắt kết nối:
+	// request đang nạp link từ database trước khi xóa dùng SET NX nên không ghi lại được bản cũ
+	tombstone := models.NewNotFoundCachedURL(models.DeletedTombstoneTTL)
+	if err := s.cacheRepo.Set(context.WithoutCancel(ctx), shortCode, tombstone); err != nil {
+		log.Printf("Warning: failed to evict URL from cache: %v", err)
 	}
 
 	return nil
@@ -232,17 +649,99 @@ func (s *URLServiceImpl) DeleteURL(shortCode string) error {
 
 // RecordClick ghi nhận click event BẤT ĐỒNG BỘ
 // Sử dụng Goroutine và Channel để không block request chính
-func (s *URLServiceImpl) RecordClick(shortCode string, ipAddress, userAgent, referer string) {
+func (s *URLServiceImpl) RecordClick(click *models.ClickRequest) {
 	// Tạo click event
 	event := &models.ClickEvent{
-		ShortCode: shortCode,
-		IPAddress: ipAddress,
-		UserAgent: userAgent,
-		Referer:   referer,
+		URLID:     click.URLID,
+		ShortCode: click.ShortCode,
+		IPAddress: click.IPAddress,
+		UserAgent: click.UserAgent,
+		Referer:   click.Referer,
 		CreatedAt: time.Now(),
 	}
 
+	// Click từ bot vẫn được lưu (có đánh dấu) nhưng không tính vào click_count
+	if s.botClassifier != nil {
+		event.BotCategory = s.botClassifier.Classify(click)
+		event.IsBot = event.BotCategory != ""
+	}
+
 	// Gửi event vào worker channel (non-blocking)
 	// Worker sẽ xử lý async
 	s.clickWorker.Enqueue(event)
 }
+
+// ListTrash liệt kê các link đã xóa, mới xóa trước
+func (s *URLServiceImpl) ListTrash(ctx context.Context, limit int, cursor string) (*models.ListTrashResponse, error) {
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var beforeID uint
+	if cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil || id == 0 {
+			return nil, ErrInvalidCursor
+		}
+		beforeID = uint(id)
+	}
+
+	urls, err := s.urlRepo.ListDeleted(ctx, limit+1, beforeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	response := &models.ListTrashResponse{
+		Items: make([]models.TrashItemResponse, 0, limit),
+	}
+	if len(urls) > limit {
+		urls = urls[:limit]
+		response.NextCursor = strconv.FormatUint(uint64(urls[len(urls)-1].ID), 10)
+	}
+
+	for i := range urls {
+		url := &urls[i]
+		response.Items = append(response.Items, models.TrashItemResponse{
+			URLResponse: *s.toURLResponse(url),
+			DeletedAt:   url.DeletedAt.Time.Format(time.RFC3339),
+			ReusableAt:  url.DeletedAt.Time.Add(s.config.App.DeletedCodeRetention).Format(time.RFC3339),
+		})
+	}
+
+	return response, nil
+}
+
+// RestoreURL khôi phục link từ thùng rác
+func (s *URLServiceImpl) RestoreURL(ctx context.Context, shortCode string) (*models.URLResponse, error) {
+	if err := s.urlRepo.Restore(ctx, shortCode); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTrash
+		}
+		return nil, fmt.Errorf("failed to restore URL: %w", err)
+	}
+
+	url, err := s.findURL(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cacheRepo.Set(ctx, shortCode, models.NewCachedURL(url)); err != nil {
+		log.Printf("Warning: failed to cache URL: %v", err)
+	}
+
+	return s.toURLResponse(url), nil
+}
+
+// PurgeURL xóa vĩnh viễn link trong thùng rác cùng analytics và lịch sử
+func (s *URLServiceImpl) PurgeURL(ctx context.Context, shortCode string) error {
+	if err := s.urlRepo.Purge(ctx, shortCode, false); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotInTrash
+		}
+		return fmt.Errorf("failed to purge URL: %w", err)
+	}
+	return nil
+}
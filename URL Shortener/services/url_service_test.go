@@ -1,13 +1,42 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"url-shortener/analytics"
+	"url-shortener/config"
 	"url-shortener/models"
+	"url-shortener/repository"
+	"url-shortener/workers"
 )
 
+// newTestService tạo URLService chạy hoàn toàn bằng các repository in-memory
+func newTestService(t *testing.T) (*URLServiceImpl, *repository.MemoryURLRepository, *repository.MemoryCacheRepository) {
+	t.Helper()
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{BaseURL: "http://sho.rt"},
+		Cache:  config.CacheConfig{NegativeTTL: time.Minute},
+		App:    config.AppConfig{ShortCodeLength: 6},
+	}
+
+	urlRepo := repository.NewMemoryURLRepository()
+	cacheRepo := repository.NewMemoryCacheRepository()
+	analyticsRepo := repository.NewMemoryAnalyticsRepository(urlRepo)
+	clickWorker := workers.NewClickAnalyticsWorker(analyticsRepo, repository.NewMemoryClickQueue(100), nil, nil, 1)
+
+	return NewURLService(urlRepo, cacheRepo, analyticsRepo, cfg, clickWorker, analytics.NewBotClassifier(0, 0), repository.NewMemoryVisitorCounter("test")), urlRepo, cacheRepo
+}
+
 // TestCreateURLRequest_Validation tests request validation
 func TestCreateURLRequest_Validation(t *testing.T) {
+	ctx := context.Background()
 	tests := []struct {
 		name    string
 		req     models.CreateURLRequest
@@ -37,18 +66,520 @@ func TestCreateURLRequest_Validation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			isValid := isValidURL(tt.req.OriginalURL)
-			if isValid != tt.isValid {
-				t.Errorf("isValidURL(%s) = %v, want %v", tt.req.OriginalURL, isValid, tt.isValid)
+			service, _, _ := newTestService(t)
+
+			_, err := service.CreateShortURL(ctx, &tt.req)
+			if tt.isValid && err != nil {
+				t.Errorf("CreateShortURL(%s) returned error: %v", tt.req.OriginalURL, err)
+			}
+			if !tt.isValid && !errors.Is(err, ErrInvalidURL) {
+				t.Errorf("CreateShortURL(%s) error = %v, want %v", tt.req.OriginalURL, err, ErrInvalidURL)
 			}
 		})
 	}
 }
 
-// isValidURL helper for testing
-func isValidURL(url string) bool {
-	if len(url) == 0 {
-		return false
+// TestCreateShortURL_Deduplicates tests that the same original URL reuses its short code
+func TestCreateShortURL_Deduplicates(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t)
+
+	first, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/a"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	if first.ShortURL != "http://sho.rt/"+first.ShortCode {
+		t.Errorf("ShortURL = %s, want base URL + short code", first.ShortURL)
+	}
+
+	second, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/a"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	if second.ShortCode != first.ShortCode {
+		t.Errorf("Expected duplicate URL to reuse %s, got %s", first.ShortCode, second.ShortCode)
+	}
+}
+
+// TestCreateShortURL_CustomCode tests custom code validation and conflicts
+func TestCreateShortURL_CustomCode(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{
+		OriginalURL: "https://example.com/custom",
+		CustomCode:  "Summer9",
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	if resp.ShortCode != "Summer9" {
+		t.Errorf("ShortCode = %s, want Summer9", resp.ShortCode)
+	}
+
+	_, err = service.CreateShortURL(ctx, &models.CreateURLRequest{
+		OriginalURL: "https://example.com/other",
+		CustomCode:  "Summer9",
+	})
+	if !errors.Is(err, ErrCustomCodeExists) {
+		t.Errorf("Expected ErrCustomCodeExists, got %v", err)
+	}
+
+	_, err = service.CreateShortURL(ctx, &models.CreateURLRequest{
+		OriginalURL: "https://example.com/other",
+		CustomCode:  "a@",
+	})
+	if !errors.Is(err, ErrInvalidCustomCode) {
+		t.Errorf("Expected ErrInvalidCustomCode, got %v", err)
+	}
+}
+
+// TestGetOriginalURL tests cache hit, cache miss and not found paths
+func TestGetOriginalURL(t *testing.T) {
+	ctx := context.Background()
+	service, _, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/get"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+
+	// Cache hit
+	originalURL, err := service.GetOriginalURL(ctx, resp.ShortCode)
+	if err != nil || originalURL != "https://example.com/get" {
+		t.Errorf("GetOriginalURL = (%s, %v), want https://example.com/get", originalURL, err)
+	}
+
+	// Cache miss: lấy từ repository rồi cache lại
+	cacheRepo.Delete(ctx, resp.ShortCode)
+	originalURL, err = service.GetOriginalURL(ctx, resp.ShortCode)
+	if err != nil || originalURL != "https://example.com/get" {
+		t.Errorf("GetOriginalURL after cache miss = (%s, %v)", originalURL, err)
+	}
+	if exists, _ := cacheRepo.Exists(ctx, resp.ShortCode); !exists {
+		t.Errorf("Expected %s to be cached again after a miss", resp.ShortCode)
+	}
+
+	// Not found
+	if _, err := service.GetOriginalURL(ctx, "nope42"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound, got %v", err)
+	}
+}
+
+// TestResolveURL_ReturnsID tests the redirect path gets the URL id, also from cache entries written before it was cached
+func TestResolveURL_ReturnsID(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/id"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	url, _ := urlRepo.FindByShortCode(ctx, resp.ShortCode)
+
+	entry, err := service.ResolveURL(ctx, resp.ShortCode)
+	if err != nil || entry.ID != url.ID || entry.ID == 0 {
+		t.Fatalf("ResolveURL = (%+v, %v), want id %d", entry, err, url.ID)
+	}
+
+	// Entry cũ không có id được nạp lại từ database
+	cacheRepo.Set(ctx, resp.ShortCode, &models.CachedURL{OriginalURL: "https://example.com/id"})
+	entry, err = service.ResolveURL(ctx, resp.ShortCode)
+	if err != nil || entry.ID != url.ID {
+		t.Fatalf("ResolveURL with legacy cache entry = (%+v, %v), want id %d", entry, err, url.ID)
+	}
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || cached.ID != url.ID {
+		t.Errorf("Expected legacy cache entry to be replaced, got %+v", cached)
+	}
+}
+
+// TestGetStats_UniqueVisitors tests repeat clicks from one visitor and bot clicks are not counted as unique visitors
+func TestGetStats_UniqueVisitors(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, _ := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/unique"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	url, _ := urlRepo.FindByShortCode(ctx, resp.ShortCode)
+
+	now := time.Now()
+	click := func(ip string, isBot bool) *models.ClickEvent {
+		return &models.ClickEvent{URLID: url.ID, ShortCode: url.ShortCode, IPAddress: ip, UserAgent: "Mozilla/5.0", IsBot: isBot, CreatedAt: now}
+	}
+	events := []*models.ClickEvent{click("1.1.1.1", false), click("1.1.1.1", false), click("2.2.2.2", false), click("3.3.3.3", true)}
+	if err := service.analyticsRepo.SaveClickBatch(ctx, events); err != nil {
+		t.Fatalf("SaveClickBatch returned error: %v", err)
+	}
+	service.visitors.Add(ctx, events)
+
+	stats, err := service.GetStats(ctx, resp.ShortCode, false)
+	if err != nil {
+		t.Fatalf("GetStats returned error: %v", err)
+	}
+	today := now.UTC().Format("2006-01-02")
+	if stats.TotalClicks != 3 || stats.UniqueVisitors != 2 {
+		t.Errorf("TotalClicks = %d, UniqueVisitors = %d, want 3 and 2", stats.TotalClicks, stats.UniqueVisitors)
+	}
+	if stats.ClicksByDate[today] != 3 || stats.UniqueByDate[today] != 2 {
+		t.Errorf("ClicksByDate = %v, UniqueByDate = %v, want 3 and 2 for %s", stats.ClicksByDate, stats.UniqueByDate, today)
+	}
+}
+
+// TestGetOriginalURL_Expired tests expired links are rejected
+func TestGetOriginalURL_Expired(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, _ := newTestService(t)
+
+	expiredAt := time.Now().Add(-time.Hour)
+	if err := urlRepo.Create(ctx, &models.URL{
+		ShortCode:   "old123",
+		OriginalURL: "https://example.com/old",
+		ExpiresAt:   &expiredAt,
+	}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if _, err := service.GetOriginalURL(ctx, "old123"); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired, got %v", err)
+	}
+}
+
+// TestGetOriginalURL_ExpiresWhileCached tests a cached link stops redirecting once it expires
+func TestGetOriginalURL_ExpiresWhileCached(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, cacheRepo := newTestService(t)
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	urlRepo.Create(ctx, &models.URL{ShortCode: "soon12", OriginalURL: "https://example.com/soon", ExpiresAt: &expiresAt})
+
+	if originalURL, err := service.GetOriginalURL(ctx, "soon12"); err != nil || originalURL != "https://example.com/soon" {
+		t.Fatalf("GetOriginalURL = (%s, %v)", originalURL, err)
+	}
+	cached, err := cacheRepo.Get(ctx, "soon12")
+	if err != nil || cached.ExpiresAt == nil {
+		t.Fatalf("Expected cache entry to carry expires_at, got (%+v, %v)", cached, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := service.GetOriginalURL(ctx, "soon12"); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("Expected ErrURLExpired after expiry, got %v", err)
+	}
+
+	// Link đã hết hạn không được ghi vào cache
+	expiredAt := time.Now().Add(-time.Minute)
+	cacheRepo.Set(ctx, "old123", &models.CachedURL{OriginalURL: "https://example.com/old", ExpiresAt: &expiredAt})
+	if exists, _ := cacheRepo.Exists(ctx, "old123"); exists {
+		t.Errorf("Expected expired link not to be cached")
+	}
+}
+
+// slowURLRepository đếm và làm chậm các lần đọc database
+type slowURLRepository struct {
+	*repository.MemoryURLRepository
+	lookups int32
+}
+
+func (r *slowURLRepository) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	time.Sleep(20 * time.Millisecond)
+	return r.MemoryURLRepository.FindByShortCode(ctx, shortCode)
+}
+
+// TestGetOriginalURL_NegativeCache tests unknown codes are cached and concurrent misses share one lookup
+func TestGetOriginalURL_NegativeCache(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, cacheRepo := newTestService(t)
+	slowRepo := &slowURLRepository{MemoryURLRepository: urlRepo}
+	service.urlRepo = slowRepo
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.GetOriginalURL(ctx, "Scan42"); !errors.Is(err, ErrURLNotFound) {
+				t.Errorf("Expected ErrURLNotFound, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := service.GetOriginalURL(ctx, "Scan42"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound from negative cache, got %v", err)
+	}
+	if lookups := atomic.LoadInt32(&slowRepo.lookups); lookups != 1 {
+		t.Errorf("Expected 1 database lookup, got %d", lookups)
+	}
+
+	// Tạo link với code đó phải ghi đè negative entry
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/now", CustomCode: "Scan42"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	if originalURL, err := service.GetOriginalURL(ctx, resp.ShortCode); err != nil || originalURL != "https://example.com/now" {
+		t.Errorf("GetOriginalURL = (%s, %v) after create", originalURL, err)
+	}
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || cached.NotFound {
+		t.Errorf("Expected negative cache entry to be replaced, got %+v", cached)
+	}
+}
+
+// TestDeleteURL tests deleting a link removes it from repository and tombstones the cache
+func TestDeleteURL(t *testing.T) {
+	ctx := context.Background()
+	service, _, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/del"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+
+	if err := service.DeleteURL(ctx, resp.ShortCode); err != nil {
+		t.Fatalf("DeleteURL returned error: %v", err)
+	}
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || !cached.NotFound {
+		t.Errorf("cached entry = %+v, want a not-found tombstone", cached)
+	}
+
+	// Redirect đã đọc link từ database trước khi xóa không ghi lại được bản cũ vào cache
+	if stored, _ := cacheRepo.SetIfAbsent(ctx, resp.ShortCode, &models.CachedURL{ID: 1, OriginalURL: "https://example.com/del"}); stored {
+		t.Errorf("Expected the tombstone to block a stale SetIfAbsent")
+	}
+	if _, err := service.GetOriginalURL(ctx, resp.ShortCode); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound after delete, got %v", err)
+	}
+}
+
+// TestListURLs tests paging through all links with the returned cursor
+func TestListURLs(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t)
+
+	for _, path := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/" + path}); err != nil {
+			t.Fatalf("CreateShortURL returned error: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	req := &models.ListURLsRequest{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("Too many pages, cursor is not advancing")
+		}
+
+		resp, err := service.ListURLs(ctx, req)
+		if err != nil {
+			t.Fatalf("ListURLs returned error: %v", err)
+		}
+		for _, item := range resp.Items {
+			if seen[item.ShortCode] {
+				t.Errorf("Duplicate item %s across pages", item.ShortCode)
+			}
+			seen[item.ShortCode] = true
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		req.Cursor = resp.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Errorf("Listed %d links, want 5", len(seen))
+	}
+
+	// Cursor không dùng được với kiểu sắp xếp khác
+	first, _ := service.ListURLs(ctx, &models.ListURLsRequest{Limit: 1})
+	_, err := service.ListURLs(ctx, &models.ListURLsRequest{Limit: 1, SortBy: "click_count", Cursor: first.NextCursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+
+	if _, err := service.ListURLs(ctx, &models.ListURLsRequest{SortBy: "name"}); !errors.Is(err, ErrInvalidListQuery) {
+		t.Errorf("Expected ErrInvalidListQuery, got %v", err)
+	}
+}
+
+// TestUpdateURL tests updating the destination overwrites the cached redirect
+func TestUpdateURL(t *testing.T) {
+	ctx := context.Background()
+	service, _, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/typo"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+
+	newURL := "https://example.com/fixed"
+	expiresIn := 2
+	updated, err := service.UpdateURL(ctx, resp.ShortCode, &models.UpdateURLRequest{OriginalURL: &newURL, ExpiresIn: &expiresIn}, "tester")
+	if err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+	if updated.OriginalURL != newURL || updated.ExpiresAt == "" {
+		t.Errorf("UpdateURL = %+v, want new destination with expiry", updated)
+	}
+
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || cached.OriginalURL != newURL || cached.ExpiresAt == nil {
+		t.Errorf("cached URL = %+v, want %s with expiry", cached, newURL)
+	}
+
+	// Một request đọc database trước khi update commit không được ghi đè cache
+	cacheRepo.SetIfAbsent(ctx, resp.ShortCode, &models.CachedURL{OriginalURL: "https://example.com/typo"})
+	if originalURL, _ := service.GetOriginalURL(ctx, resp.ShortCode); originalURL != newURL {
+		t.Errorf("GetOriginalURL = %s, want %s", originalURL, newURL)
+	}
+
+	// Bỏ thời hạn
+	noExpiry := 0
+	updated, err = service.UpdateURL(ctx, resp.ShortCode, &models.UpdateURLRequest{ExpiresIn: &noExpiry}, "tester")
+	if err != nil || updated.ExpiresAt != "" {
+		t.Errorf("UpdateURL(no expiry) = (%+v, %v)", updated, err)
+	}
+
+	if _, err := service.UpdateURL(ctx, "nope42", &models.UpdateURLRequest{OriginalURL: &newURL}, "tester"); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("Expected ErrURLNotFound, got %v", err)
+	}
+	if _, err := service.UpdateURL(ctx, resp.ShortCode, &models.UpdateURLRequest{}, "tester"); !errors.Is(err, ErrInvalidUpdate) {
+		t.Errorf("Expected ErrInvalidUpdate, got %v", err)
+	}
+}
+
+// TestUpdateURL_Concurrent tests concurrent updates each record a distinct previous value
+// and the cache ends up with the destination that was committed last
+func TestUpdateURL_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	service, urlRepo, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/v0"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := 1; i <= updates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			destination := fmt.Sprintf("https://example.com/v%d", i)
+			if _, err := service.UpdateURL(ctx, resp.ShortCode, &models.UpdateURLRequest{OriginalURL: &destination}, "tester"); err != nil {
+				t.Errorf("UpdateURL returned error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	revisions, _ := service.ListRevisions(ctx, resp.ShortCode)
+	seen := make(map[string]bool)
+	for _, revision := range revisions {
+		if seen[revision.OriginalURL] {
+			t.Errorf("previous value %s recorded twice", revision.OriginalURL)
+		}
+		seen[revision.OriginalURL] = true
+	}
+	if len(revisions) != updates || !seen["https://example.com/v0"] {
+		t.Errorf("got %d revisions, want %d starting from v0", len(revisions), updates)
+	}
+
+	stored, _ := urlRepo.FindByShortCode(ctx, resp.ShortCode)
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || cached.OriginalURL != stored.OriginalURL {
+		t.Errorf("cached URL = %+v, want the committed destination %s", cached, stored.OriginalURL)
+	}
+}
+
+// TestRevisions tests that updates are recorded and can be rolled back
+func TestRevisions(t *testing.T) {
+	ctx := context.Background()
+	service, _, cacheRepo := newTestService(t)
+
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/v1"})
+	if err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+
+	v2 := "https://example.com/v2"
+	if _, err := service.UpdateURL(ctx, resp.ShortCode, &models.UpdateURLRequest{OriginalURL: &v2}, "alice"); err != nil {
+		t.Fatalf("UpdateURL returned error: %v", err)
+	}
+
+	revisions, err := service.ListRevisions(ctx, resp.ShortCode)
+	if err != nil {
+		t.Fatalf("ListRevisions returned error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].OriginalURL != "https://example.com/v1" || revisions[0].ChangedBy != "alice" {
+		t.Fatalf("ListRevisions = %+v, want the v1 snapshot changed by alice", revisions)
+	}
+
+	restored, err := service.RestoreRevision(ctx, resp.ShortCode, revisions[0].ID, "bob")
+	if err != nil {
+		t.Fatalf("RestoreRevision returned error: %v", err)
+	}
+	if restored.OriginalURL != "https://example.com/v1" {
+		t.Errorf("RestoreRevision = %s, want https://example.com/v1", restored.OriginalURL)
+	}
+	if cached, _ := cacheRepo.Get(ctx, resp.ShortCode); cached == nil || cached.OriginalURL != "https://example.com/v1" {
+		t.Errorf("cached URL = %+v after restore", cached)
+	}
+
+	// Restore cũng được ghi lại nên có thể undo
+	revisions, _ = service.ListRevisions(ctx, resp.ShortCode)
+	if len(revisions) != 2 || revisions[0].Action != models.RevisionActionRestore || revisions[0].OriginalURL != v2 {
+		t.Errorf("ListRevisions after restore = %+v", revisions)
+	}
+
+	if _, err := service.RestoreRevision(ctx, resp.ShortCode, 999, "bob"); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("Expected ErrRevisionNotFound, got %v", err)
+	}
+}
+
+// TestTrash tests restoring, purging and the short code reuse policy
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestService(t)
+	service.config.App.DeletedCodeRetention = time.Hour
+
+	if _, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/trash", CustomCode: "Trash9"}); err != nil {
+		t.Fatalf("CreateShortURL returned error: %v", err)
+	}
+	if err := service.DeleteURL(ctx, "Trash9"); err != nil {
+		t.Fatalf("DeleteURL returned error: %v", err)
+	}
+
+	trash, err := service.ListTrash(ctx, 10, "")
+	if err != nil || len(trash.Items) != 1 || trash.Items[0].ShortCode != "Trash9" {
+		t.Fatalf("ListTrash = (%+v, %v)", trash, err)
+	}
+
+	// Trong thời gian lưu giữ, code chưa thể cấp lại
+	_, err = service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/new", CustomCode: "Trash9"})
+	if !errors.Is(err, ErrCustomCodeExists) {
+		t.Errorf("Expected ErrCustomCodeExists during retention, got %v", err)
+	}
+
+	restored, err := service.RestoreURL(ctx, "Trash9")
+	if err != nil || restored.OriginalURL != "https://example.com/trash" {
+		t.Fatalf("RestoreURL = (%+v, %v)", restored, err)
+	}
+	if originalURL, err := service.GetOriginalURL(ctx, "Trash9"); err != nil || originalURL != "https://example.com/trash" {
+		t.Errorf("GetOriginalURL after restore = (%s, %v)", originalURL, err)
+	}
+	if _, err := service.RestoreURL(ctx, "Trash9"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("Expected ErrNotInTrash for an active link, got %v", err)
+	}
+	if err := service.PurgeURL(ctx, "Trash9"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("Expected active links to be protected from purge, got %v", err)
+	}
+
+	// Hết thời gian lưu giữ: link cũ bị purge và code được cấp cho link mới
+	service.DeleteURL(ctx, "Trash9")
+	service.config.App.DeletedCodeRetention = 0
+	resp, err := service.CreateShortURL(ctx, &models.CreateURLRequest{OriginalURL: "https://example.com/new", CustomCode: "Trash9"})
+	if err != nil || resp.ShortCode != "Trash9" {
+		t.Fatalf("CreateShortURL after retention = (%+v, %v)", resp, err)
+	}
+	if trash, _ := service.ListTrash(ctx, 10, ""); len(trash.Items) != 0 {
+		t.Errorf("Expected trash to be empty after the code was reclaimed, got %+v", trash.Items)
 	}
-	return len(url) > 7 && (url[:7] == "http://" || url[:8] == "https://")
 }
@@ -0,0 +1,103 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/interfaces"
+	"url-shortener/models"
+)
+
+// warmUpChunkSize là số link ghi vào cache trong một pipeline
+const warmUpChunkSize = 500
+
+// CacheWarmUpReport là kết quả của một lần nạp sẵn cache
+type CacheWarmUpReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	Duration   string    `json:"duration"`
+	Candidates int       `json:"candidates"` // Số link nóng đọc được từ database
+	Cached     int       `json:"cached"`     // Số link vừa được ghi vào cache
+	Skipped    int       `json:"skipped"`    // Số link đã có sẵn trong cache
+}
+
+// CacheWarmer nạp sẵn các link được click nhiều nhất vào cache
+// Dùng sau khi deploy hoặc Redis khởi động lại để lượt truy cập đầu tiên không dồn về database
+type CacheWarmer struct {
+	urlRepo   interfaces.URLRepository
+	cacheRepo interfaces.CacheRepository
+
+	runMu      sync.Mutex // Chỉ cho phép một lần warm-up tại một thời điểm
+	mu         sync.Mutex
+	lastReport *CacheWarmUpReport
+}
+
+// NewCacheWarmer tạo CacheWarmer mới
+func NewCacheWarmer(urlRepo interfaces.URLRepository, cacheRepo interfaces.CacheRepository) *CacheWarmer {
+	return &CacheWarmer{
+		urlRepo:   urlRepo,
+		cacheRepo: cacheRepo,
+	}
+}
+
+// WarmUp nạp limit link có click_count cao nhất, chưa hết hạn vào cache
+// Dùng SET NX nên không ghi đè giá trị mới hơn đã có trong cache
+func (w *CacheWarmer) WarmUp(ctx context.Context, limit int) (*CacheWarmUpReport, error) {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	report := &CacheWarmUpReport{StartedAt: time.Now()}
+
+	notExpired := false
+	urls, err := w.urlRepo.List(ctx, &models.URLListQuery{
+		SortBy:     "click_count",
+		Descending: true,
+		Limit:      limit,
+		Expired:    &notExpired,
+		Now:        report.StartedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load top links: %w", err)
+	}
+	report.Candidates = len(urls)
+
+	for start := 0; start < len(urls); start += warmUpChunkSize {
+		end := start + warmUpChunkSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+
+		entries := make(map[string]*models.CachedURL, end-start)
+		for i := start; i < end; i++ {
+			entries[urls[i].ShortCode] = models.NewCachedURL(&urls[i])
+		}
+
+		stored, err := w.cacheRepo.SetManyIfAbsent(ctx, entries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to warm up cache: %w", err)
+		}
+		report.Cached += stored
+		report.Skipped += len(entries) - stored
+	}
+
+	report.Duration = time.Since(report.StartedAt).String()
+
+	w.mu.Lock()
+	w.lastReport = report
+	w.mu.Unlock()
+
+	log.Printf("🔥 Cache warm-up: %d links cached, %d already cached in %s",
+		report.Cached, report.Skipped, report.Duration)
+
+	return report, nil
+}
+
+// LastReport trả về kết quả lần warm-up gần nhất (nil nếu chưa chạy)
+func (w *CacheWarmer) LastReport() *CacheWarmUpReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastReport
+}
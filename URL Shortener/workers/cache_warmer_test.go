@@ -0,0 +1,45 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+	"url-shortener/repository"
+)
+
+func TestCacheWarmer_WarmUp(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := repository.NewMemoryURLRepository()
+	cacheRepo := repository.NewMemoryCacheRepository()
+
+	expiredAt := time.Now().Add(-time.Hour)
+	urlRepo.Create(ctx, &models.URL{ShortCode: "hot123", OriginalURL: "https://example.com/hot", ClickCount: 500})
+	urlRepo.Create(ctx, &models.URL{ShortCode: "warm12", OriginalURL: "https://example.com/warm", ClickCount: 50})
+	urlRepo.Create(ctx, &models.URL{ShortCode: "cold12", OriginalURL: "https://example.com/cold", ClickCount: 1})
+	urlRepo.Create(ctx, &models.URL{ShortCode: "gone12", OriginalURL: "https://example.com/gone", ClickCount: 900, ExpiresAt: &expiredAt})
+
+	// Giá trị mới hơn trong cache không bị ghi đè
+	cacheRepo.Set(ctx, "warm12", &models.CachedURL{OriginalURL: "https://example.com/updated"})
+
+	report, err := NewCacheWarmer(urlRepo, cacheRepo).WarmUp(ctx, 2)
+	if err != nil {
+		t.Fatalf("WarmUp returned error: %v", err)
+	}
+	if report.Candidates != 2 || report.Cached != 1 || report.Skipped != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	if cached, _ := cacheRepo.Get(ctx, "hot123"); cached == nil || cached.OriginalURL != "https://example.com/hot" {
+		t.Errorf("Expected hottest link to be cached, got %+v", cached)
+	}
+	if cached, _ := cacheRepo.Get(ctx, "warm12"); cached == nil || cached.OriginalURL != "https://example.com/updated" {
+		t.Errorf("Expected existing cache entry to be kept, got %+v", cached)
+	}
+	for _, shortCode := range []string{"cold12", "gone12"} {
+		if exists, _ := cacheRepo.Exists(ctx, shortCode); exists {
+			t.Errorf("Expected %s not to be warmed up", shortCode)
+		}
+	}
+}
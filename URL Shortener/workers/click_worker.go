@@ -1,52 +1,92 @@
 package workers
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"url-shortener/analytics"
+	"url-shortener/interfaces"
 	"url-shortener/models"
 	"url-shortener/repository"
 )
 
+// defaultDrainTimeout là thời gian tối đa Stop chờ xử lý nốt các event còn trong queue
+const defaultDrainTimeout = 10 * time.Second
+
 // ClickAnalyticsWorker xử lý click events bất đồng bộ
-// Sử dụng Goroutines và Channels để không làm chậm request chính
+// Sử dụng Goroutines và queue (channel in-memory hoặc spool trên đĩa) để không làm chậm request chính
 type ClickAnalyticsWorker struct {
-	eventChannel  chan *models.ClickEvent
-	urlRepo       *repository.URLRepositoryImpl
-	analyticsRepo *repository.AnalyticsRepositoryImpl
+	queue         interfaces.ClickQueue
+	analyticsRepo interfaces.AnalyticsRepository
+	geoIP         interfaces.GeoIPResolver        // nil = không tra vị trí
+	visitors      interfaces.UniqueVisitorCounter // nil = không đếm người xem duy nhất
 	workerCount   int
 	batchSize     int
 	flushInterval time.Duration
+	maxAttempts   int           // Số lần ghi batch trước khi chờ flushInterval rồi thử lại
+	retryBackoff  time.Duration // Thời gian chờ sau lần ghi lỗi đầu tiên, gấp đôi sau mỗi lần
 	wg            sync.WaitGroup
-	quit          chan struct{}
 	isRunning     bool
-	mu            sync.Mutex
+	mu            sync.RWMutex
+
+	// ctx bị hủy khi dừng để các worker thoát khỏi vòng chờ queue
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// accepting = false sau khi bắt đầu dừng, Enqueue từ chối thay vì ghi vào queue
+	accepting bool
+	// drainCtx giới hạn thời gian xử lý nốt queue khi dừng
+	drainCtx context.Context
+	// writeCtx dùng cho các lệnh ghi database, bị hủy khi drainCtx hết hạn
+	// để database treo không giữ Shutdown quá thời gian drain
+	writeCtx    context.Context
+	abortWrites context.CancelFunc
+
+	dropped      uint64 // Số event bị bỏ do queue đầy hoặc lỗi
+	rejected     uint64 // Số event bị từ chối vì worker đang dừng hoặc đã dừng
+	deadLettered uint64 // Số event bị database từ chối và chuyển sang dead-letter
 }
 
-// NewClickAnalyticsWorker tạo worker mới
+// NewClickAnalyticsWorker tạo worker mới đọc events từ queue
+// Worker sở hữu queue và đóng queue khi dừng; geoIP = nil thì click không có vị trí,
+// visitors = nil thì không đếm người xem duy nhất
 func NewClickAnalyticsWorker(
-	urlRepo *repository.URLRepositoryImpl,
-	analyticsRepo *repository.AnalyticsRepositoryImpl,
+	analyticsRepo interfaces.AnalyticsRepository,
+	queue interfaces.ClickQueue,
+	geoIP interfaces.GeoIPResolver,
+	visitors interfaces.UniqueVisitorCounter,
 	workerCount int,
-	bufferSize int,
 ) *ClickAnalyticsWorker {
+	ctx, cancel := context.WithCancel(context.Background())
+	writeCtx, abortWrites := context.WithCancel(context.Background())
+
 	return &ClickAnalyticsWorker{
-		eventChannel:  make(chan *models.ClickEvent, bufferSize),
-		urlRepo:       urlRepo,
+		queue:         queue,
 		analyticsRepo: analyticsRepo,
+		geoIP:         geoIP,
+		visitors:      visitors,
 		workerCount:   workerCount,
 		batchSize:     100,             // Batch 100 events
 		flushInterval: 5 * time.Second, // Flush mỗi 5 giây
-		quit:          make(chan struct{}),
+		maxAttempts:   3,
+		retryBackoff:  200 * time.Millisecond,
+		ctx:           ctx,
+		cancel:        cancel,
+		writeCtx:      writeCtx,
+		abortWrites:   abortWrites,
 		isRunning:     false,
+		accepting:     true,
 	}
 }
 
 // Start khởi động worker pool
 func (w *ClickAnalyticsWorker) Start() {
 	w.mu.Lock()
-	if w.isRunning {
+	if w.isRunning || !w.accepting {
 		w.mu.Unlock()
 		return
 	}
@@ -64,139 +104,298 @@ func (w *ClickAnalyticsWorker) Start() {
 	log.Println("✅ Analytics workers started successfully")
 }
 
-// Stop dừng tất cả workers gracefully
+// Stop dừng tất cả workers gracefully, chờ xử lý nốt queue tối đa defaultDrainTimeout
 func (w *ClickAnalyticsWorker) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDrainTimeout)
+	defer cancel()
+
+	if err := w.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// Shutdown ngừng nhận event mới, xử lý hết các event còn trong queue rồi đóng queue
+// Khi ctx hết hạn, lệnh ghi database đang chạy bị hủy và workers thoát; queue in-memory bỏ
+// phần còn lại, spool và stream giữ lại để xử lý ở lần khởi động sau
+func (w *ClickAnalyticsWorker) Shutdown(ctx context.Context) error {
 	w.mu.Lock()
-	if !w.isRunning {
+	if !w.accepting {
 		w.mu.Unlock()
-		return
+		return nil
 	}
+	// Chờ các Enqueue đang chạy xong (giữ RLock) nên sau đây không còn ai ghi vào queue
+	w.accepting = false
+	w.drainCtx = ctx
+	running := w.isRunning
 	w.mu.Unlock()
 
-	log.Println("🛑 Stopping analytics workers...")
+	// Hết thời gian drain thì hủy cả lệnh ghi đang chạy (batch đang giữ, dead-letter)
+	stop := context.AfterFunc(ctx, w.abortWrites)
+	defer stop()
 
-	// Đóng quit channel để signal stop
-	close(w.quit)
+	if running {
+		log.Printf("🛑 Stopping analytics workers, draining %d queued events...", w.queue.Len())
 
-	// Đợi tất cả workers hoàn thành
-	w.wg.Wait()
+		// Hủy ctx để workers thoát vòng chờ, xử lý nốt queue rồi thoát
+		w.cancel()
 
-	// Đóng event channel
-	close(w.eventChannel)
+		// Đợi tất cả workers hoàn thành
+		w.wg.Wait()
 
-	w.mu.Lock()
-	w.isRunning = false
-	w.mu.Unlock()
+		w.mu.Lock()
+		w.isRunning = false
+		w.mu.Unlock()
+	}
+
+	if err := w.queue.Close(); err != nil {
+		return fmt.Errorf("analytics workers stopped: %w", err)
+	}
 
 	log.Println("✅ Analytics workers stopped")
+	return nil
 }
 
 // Enqueue thêm event vào queue (non-blocking)
-func (w *ClickAnalyticsWorker) Enqueue(event *models.ClickEvent) {
-	// Non-blocking send với select
-	select {
-	case w.eventChannel <- event:
-		// Event được enqueue thành công
-	default:
-		// Channel đầy, log warning nhưng không block
-		log.Printf("⚠️ Analytics queue full, dropping event for: %s", event.ShortCode)
+// Trả về false nếu event bị bỏ do queue đầy hoặc worker đã dừng
+func (w *ClickAnalyticsWorker) Enqueue(event *models.ClickEvent) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.accepting {
+		atomic.AddUint64(&w.rejected, 1)
+		return false
+	}
+
+	if err := w.queue.Push(event); err != nil {
+		// Queue đầy, log warning nhưng không block
+		atomic.AddUint64(&w.dropped, 1)
+		log.Printf("⚠️ Analytics queue rejected event for %s, dropping: %v", event.ShortCode, err)
+		return false
 	}
+	return true
 }
 
-// worker xử lý events từ channel
+// worker đọc từng batch từ queue và ghi vào database
 func (w *ClickAnalyticsWorker) worker(id int) {
 	defer w.wg.Done()
 
 	log.Printf("Worker %d started", id)
 
-	batch := make([]*models.ClickEvent, 0, w.batchSize)
-	ticker := time.NewTicker(w.flushInterval)
-	defer ticker.Stop()
+	for w.ctx.Err() == nil {
+		// Chờ tối đa flushInterval để gom đủ batch
+		batch, err := w.queue.Pop(w.ctx, w.batchSize, w.flushInterval)
+		if err != nil && w.ctx.Err() == nil {
+			log.Printf("Worker %d: failed to read click queue: %v", id, err)
+			w.wait(w.ctx, w.flushInterval)
+		}
+		if batch != nil && len(batch.Events) > 0 {
+			w.handleBatch(w.ctx, batch, id)
+		}
+	}
+
+	// Xử lý nốt queue trước khi thoát
+	w.drain(id)
+	log.Printf("Worker %d stopped", id)
+}
 
-	for {
-		select {
-		case <-w.quit:
-			// Flush remaining batch trước khi thoát
-			if len(batch) > 0 {
-				w.processBatch(batch, id)
-			}
-			log.Printf("Worker %d stopped", id)
+// drain đọc hết các event còn trong queue cho tới khi queue rỗng hoặc hết thời gian drain
+func (w *ClickAnalyticsWorker) drain(id int) {
+	w.mu.RLock()
+	ctx := w.drainCtx
+	w.mu.RUnlock()
+
+	for ctx.Err() == nil {
+		// Enqueue đã bị chặn trước khi dừng nên queue rỗng nghĩa là đã drain xong
+		batch, err := w.queue.Pop(ctx, w.batchSize, 0)
+		if err != nil || batch == nil || len(batch.Events) == 0 {
 			return
+		}
+		w.handleBatch(ctx, batch, id)
+	}
+}
 
-		case event := <-w.eventChannel:
-			if event == nil {
-				continue
+// handleBatch ghi batch, đếm người xem của các event đã ghi rồi Ack, các event lỗi tạm thời được
+// thử lại cho tới khi ctx bị hủy. Batch chưa Ack vẫn nằm trong spool/stream và được xử lý lại
+// ở lần khởi động sau
+func (w *ClickAnalyticsWorker) handleBatch(ctx context.Context, batch *models.ClickBatch, id int) {
+	w.enrichEvents(batch.Events)
+
+	events := batch.Events
+	var saved []*models.ClickEvent
+	for {
+		written, remaining, err := w.processBatch(ctx, events, id)
+		saved = append(saved, written...)
+		if len(remaining) == 0 {
+			// Event bị chuyển sang dead-letter không được tính là người xem
+			w.countVisitors(saved, id)
+			if err := w.queue.Ack(batch); err != nil {
+				log.Printf("Worker %d: failed to ack click batch: %v", id, err)
 			}
+			return
+		}
 
-			batch = append(batch, event)
+		log.Printf("⚠️ Worker %d: failed to save %d click events, retrying in %v: %v",
+			id, len(remaining), w.flushInterval, err)
+		// Batch vẫn đang được xử lý, không để consumer khác nhận lại và tính thêm một lần giao
+		if err := w.queue.Renew(batch); err != nil {
+			log.Printf("Worker %d: failed to renew click batch: %v", id, err)
+		}
+		if !w.wait(ctx, w.flushInterval) {
+			return
+		}
+		events = remaining
+	}
+}
 
-			// Flush khi batch đầy
-			if len(batch) >= w.batchSize {
-				w.processBatch(batch, id)
-				batch = make([]*models.ClickEvent, 0, w.batchSize)
+// enrichEvents phân tích User-Agent thành thiết bị, hệ điều hành, trình duyệt và tra vị trí theo IP
+// Làm ở worker thay vì trên request để redirect không tốn thêm thời gian
+func (w *ClickAnalyticsWorker) enrichEvents(events []*models.ClickEvent) {
+	for _, event := range events {
+		if event.DeviceType == "" {
+			info := analytics.ParseUserAgent(event.UserAgent)
+			event.DeviceType = info.DeviceType
+			if event.IsBot {
+				event.DeviceType = analytics.DeviceBot
 			}
+			event.OSFamily = info.OSFamily
+			event.OSVersion = info.OSVersion
+			event.BrowserFamily = info.BrowserFamily
+			event.BrowserVersion = info.BrowserVersion
+		}
 
-		case <-ticker.C:
-			// Flush theo interval
-			if len(batch) > 0 {
-				w.processBatch(batch, id)
-				batch = make([]*models.ClickEvent, 0, w.batchSize)
+		if w.geoIP != nil && event.Country == "" && event.IPAddress != "" {
+			if location, ok := w.geoIP.Lookup(event.IPAddress); ok {
+				event.Country = location.Country
+				event.Region = location.Region
+				event.City = location.City
 			}
 		}
 	}
 }
 
-// processBatch xử lý một batch events
-func (w *ClickAnalyticsWorker) processBatch(batch []*models.ClickEvent, workerID int) {
-	if len(batch) == 0 {
+// countVisitors ghi nhận người xem duy nhất của các event đã ghi vào database
+// Batch được xử lý lại (chưa Ack khi restart) không làm sai số đếm vì HyperLogLog bỏ qua phần tử trùng
+func (w *ClickAnalyticsWorker) countVisitors(events []*models.ClickEvent, workerID int) {
+	if w.visitors == nil || len(events) == 0 {
 		return
 	}
+	// writeCtx dừng lệnh đếm khi hết thời gian drain để Redis treo không giữ shutdown lại
+	if err := w.visitors.Add(w.writeCtx, events); err != nil {
+		log.Printf("Worker %d: failed to count unique visitors: %v", workerID, err)
+	}
+}
+
+// wait chờ một khoảng thời gian, trả về false nếu ctx bị hủy trước đó
+func (w *ClickAnalyticsWorker) wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// processBatch ghi cả batch trong một transaction
+// Nếu dữ liệu của batch bị database từ chối, ghi lại từng event để tách event lỗi sang dead-letter.
+// Trả về các event đã ghi và các event chưa ghi được vì lỗi tạm thời (mất kết nối, timeout) để thử lại sau
+func (w *ClickAnalyticsWorker) processBatch(ctx context.Context, events []*models.ClickEvent, workerID int) ([]*models.ClickEvent, []*models.ClickEvent, error) {
+	if len(events) == 0 {
+		return nil, nil, nil
+	}
 
 	start := time.Now()
-	successCount := 0
-	errorCount := 0
-
-	// Group events theo short_code để update click count hiệu quả
-	clickCounts := make(map[string]int)
-
-	for _, event := range batch {
-		// Lưu click event vào database
-		if err := w.analyticsRepo.SaveClickEvent(event); err != nil {
-			log.Printf("Error saving click event: %v", err)
-			errorCount++
-			continue
-		}
 
-		successCount++
-		clickCounts[event.ShortCode]++
+	err := w.saveWithRetry(ctx, events)
+	if err == nil {
+		log.Printf("Worker %d: Processed batch of %d events in %v", workerID, len(events), time.Since(start))
+		return events, nil, nil
+	}
+	if !repository.IsDataError(err) {
+		return nil, events, err
+	}
+	if len(events) == 1 {
+		remaining, err := w.deadLetter(events[0], err)
+		return nil, remaining, err
 	}
 
-	// Batch update click counts
-	for shortCode, count := range clickCounts {
-		for i := 0; i < count; i++ {
-			if err := w.urlRepo.IncrementClickCount(shortCode); err != nil {
-				log.Printf("Error incrementing click count for %s: %v", shortCode, err)
-			}
+	// Một event lỗi làm rollback cả batch, ghi lại từng event để giữ các event hợp lệ
+	var saved, remaining []*models.ClickEvent
+	var lastErr error
+	for _, event := range events {
+		written, left, err := w.processBatch(ctx, []*models.ClickEvent{event}, workerID)
+		if err != nil {
+			lastErr = err
 		}
+		saved = append(saved, written...)
+		remaining = append(remaining, left...)
 	}
+	return saved, remaining, lastErr
+}
 
-	elapsed := time.Since(start)
-	log.Printf("Worker %d: Processed batch of %d events (%d success, %d errors) in %v",
-		workerID, len(batch), successCount, errorCount, elapsed)
+// saveWithRetry ghi batch, thử lại với backoff tăng dần khi gặp lỗi tạm thời
+func (w *ClickAnalyticsWorker) saveWithRetry(ctx context.Context, events []*models.ClickEvent) error {
+	backoff := w.retryBackoff
+
+	var err error
+	for attempt := 1; attempt <= w.maxAttempts; attempt++ {
+		// Batch không gắn với request nào; timeout của repository giới hạn từng truy vấn,
+		// writeCtx dừng lệnh ghi khi hết thời gian drain
+		err = w.analyticsRepo.SaveClickBatch(w.writeCtx, events)
+		if err == nil || repository.IsDataError(err) {
+			return err
+		}
+		if attempt == w.maxAttempts || !w.wait(ctx, backoff) {
+			break
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// deadLetter chuyển event bị database từ chối sang bảng dead-letter
+// Trả về event nếu chưa ghi được dead-letter để thử lại sau
+func (w *ClickAnalyticsWorker) deadLetter(event *models.ClickEvent, cause error) ([]*models.ClickEvent, error) {
+	if err := w.analyticsRepo.SaveDeadLetter(w.writeCtx, event, cause.Error()); err != nil {
+		return []*models.ClickEvent{event}, fmt.Errorf("failed to dead-letter click event: %w", err)
+	}
+
+	atomic.AddUint64(&w.deadLettered, 1)
+	log.Printf("⚠️ Click event for %s moved to dead-letter: %v", event.ShortCode, cause)
+	return nil, nil
 }
 
 // GetQueueSize trả về số events đang chờ trong queue
 func (w *ClickAnalyticsWorker) GetQueueSize() int {
-	return len(w.eventChannel)
+	return w.queue.Len()
 }
 
 // GetStats trả về thống kê của worker
 func (w *ClickAnalyticsWorker) GetStats() map[string]interface{} {
-	return map[string]interface{}{
-		"queue_size":     w.GetQueueSize(),
-		"worker_count":   w.workerCount,
-		"batch_size":     w.batchSize,
-		"flush_interval": w.flushInterval.String(),
-		"is_running":     w.isRunning,
+	w.mu.RLock()
+	isRunning := w.isRunning
+	accepting := w.accepting
+	w.mu.RUnlock()
+
+	stats := map[string]interface{}{
+		"queue_size":      w.GetQueueSize(),
+		"worker_count":    w.workerCount,
+		"batch_size":      w.batchSize,
+		"flush_interval":  w.flushInterval.String(),
+		"is_running":      isRunning,
+		"accepting":       accepting,
+		"dropped_events":  atomic.LoadUint64(&w.dropped),
+		"rejected_events": atomic.LoadUint64(&w.rejected),
+		"dead_lettered":   atomic.LoadUint64(&w.deadLettered),
+		"queue":           w.queue.GetStats(),
+	}
+	if w.geoIP != nil {
+		stats["geoip"] = w.geoIP.GetStats()
+	}
+	if w.visitors != nil {
+		stats["unique_visitors"] = w.visitors.GetStats()
 	}
+	return stats
 }
@@ -0,0 +1,214 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"url-shortener/models"
+	"url-shortener/repository"
+
+	"gorm.io/gorm"
+)
+
+func TestClickAnalyticsWorker_ShutdownDrainsQueue(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := repository.NewMemoryURLRepository()
+	analyticsRepo := repository.NewMemoryAnalyticsRepository(urlRepo)
+	urlRepo.Create(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+
+	worker := NewClickAnalyticsWorker(analyticsRepo, repository.NewMemoryClickQueue(1000), nil, nil, 2)
+	for i := 0; i < 250; i++ {
+		if !worker.Enqueue(&models.ClickEvent{ShortCode: "abc123", CreatedAt: time.Now()}) {
+			t.Fatalf("Enqueue %d rejected", i)
+		}
+	}
+	worker.Start()
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := worker.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	url, err := urlRepo.FindByShortCode(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("FindByShortCode returned error: %v", err)
+	}
+	if url.ClickCount != 250 {
+		t.Errorf("ClickCount = %d, want 250 after drain", url.ClickCount)
+	}
+
+	// User-Agent rỗng vẫn được gắn loại thiết bị khi ghi
+	devices, _ := analyticsRepo.GetTopDevices(ctx, "abc123", 5, false)
+	if len(devices) != 1 || devices[0].DeviceType != "unknown" || devices[0].Count != 250 {
+		t.Errorf("GetTopDevices = %+v, want 250 unknown", devices)
+	}
+
+	// Enqueue sau khi dừng bị từ chối thay vì panic
+	if worker.Enqueue(&models.ClickEvent{ShortCode: "abc123"}) {
+		t.Errorf("Expected Enqueue after Shutdown to be rejected")
+	}
+	stats := worker.GetStats()
+	if stats["rejected_events"] != uint64(1) || stats["is_running"] != false {
+		t.Errorf("Unexpected stats after shutdown: %v", stats)
+	}
+}
+
+// rejectingAnalyticsRepository từ chối mọi batch chứa short code bị cấm như một vi phạm ràng buộc
+type rejectingAnalyticsRepository struct {
+	*repository.MemoryAnalyticsRepository
+	rejected string
+
+	mu          sync.Mutex
+	deadLetters []string
+}
+
+func (r *rejectingAnalyticsRepository) SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error {
+	for _, event := range events {
+		if event.ShortCode == r.rejected {
+			return fmt.Errorf("insert click event: %w", gorm.ErrForeignKeyViolated)
+		}
+	}
+	return r.MemoryAnalyticsRepository.SaveClickBatch(ctx, events)
+}
+
+func (r *rejectingAnalyticsRepository) SaveDeadLetter(ctx context.Context, event *models.ClickEvent, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadLetters = append(r.deadLetters, event.ShortCode)
+	return nil
+}
+
+func TestClickAnalyticsWorker_DeadLettersRejectedEvents(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := repository.NewMemoryURLRepository()
+	urlRepo.Create(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+	analyticsRepo := &rejectingAnalyticsRepository{
+		MemoryAnalyticsRepository: repository.NewMemoryAnalyticsRepository(urlRepo),
+		rejected:                  "gone",
+	}
+
+	visitors := repository.NewMemoryVisitorCounter("salt")
+	worker := NewClickAnalyticsWorker(analyticsRepo, repository.NewMemoryClickQueue(100), nil, visitors, 1)
+	for i := 0; i < 10; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		worker.Enqueue(&models.ClickEvent{URLID: 1, ShortCode: "abc123", IPAddress: ip, CreatedAt: time.Now()})
+		if i%5 == 0 {
+			worker.Enqueue(&models.ClickEvent{URLID: 2, ShortCode: "gone", IPAddress: ip, CreatedAt: time.Now()})
+		}
+	}
+	worker.Start()
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := worker.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	// Event bị từ chối không làm mất các event hợp lệ cùng batch
+	url, _ := urlRepo.FindByShortCode(ctx, "abc123")
+	if url.ClickCount != 10 {
+		t.Errorf("ClickCount = %d, want 10", url.ClickCount)
+	}
+	if len(analyticsRepo.deadLetters) != 2 {
+		t.Errorf("Expected 2 dead-lettered events, got %v", analyticsRepo.deadLetters)
+	}
+	if stats := worker.GetStats(); stats["dead_lettered"] != uint64(2) {
+		t.Errorf("dead_lettered = %v, want 2", stats["dead_lettered"])
+	}
+
+	// Chỉ event đã ghi được tính là người xem
+	if saved, _, _ := visitors.Count(ctx, 1, nil); saved != 10 {
+		t.Errorf("unique visitors of saved link = %d, want 10", saved)
+	}
+	if dead, _, _ := visitors.Count(ctx, 2, nil); dead != 0 {
+		t.Errorf("unique visitors of dead-lettered clicks = %d, want 0", dead)
+	}
+}
+
+// renewCountingQueue đếm số lần worker gia hạn batch đang xử lý
+type renewCountingQueue struct {
+	*repository.MemoryClickQueue
+	renewed int32
+}
+
+func (q *renewCountingQueue) Renew(batch *models.ClickBatch) error {
+	atomic.AddInt32(&q.renewed, 1)
+	return nil
+}
+
+// outageAnalyticsRepository giả lập database mất kết nối trong failures lần ghi đầu tiên
+type outageAnalyticsRepository struct {
+	*repository.MemoryAnalyticsRepository
+	failures int32
+}
+
+func (r *outageAnalyticsRepository) SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error {
+	if atomic.AddInt32(&r.failures, -1) >= 0 {
+		return errors.New("dial tcp: connection refused")
+	}
+	return r.MemoryAnalyticsRepository.SaveClickBatch(ctx, events)
+}
+
+func TestClickAnalyticsWorker_RenewsBatchWhileRetrying(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := repository.NewMemoryURLRepository()
+	urlRepo.Create(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"})
+	analyticsRepo := &outageAnalyticsRepository{
+		MemoryAnalyticsRepository: repository.NewMemoryAnalyticsRepository(urlRepo),
+		failures:                  6,
+	}
+	queue := &renewCountingQueue{MemoryClickQueue: repository.NewMemoryClickQueue(10)}
+
+	worker := NewClickAnalyticsWorker(analyticsRepo, queue, nil, nil, 1)
+	worker.flushInterval = 10 * time.Millisecond
+	worker.retryBackoff = time.Millisecond
+
+	queue.Push(&models.ClickEvent{ShortCode: "abc123", CreatedAt: time.Now()})
+	batch, _ := queue.Pop(ctx, 10, 0)
+	worker.handleBatch(ctx, batch, 0)
+
+	// Hai lượt ghi (mỗi lượt maxAttempts lần) thất bại, mỗi lượt gia hạn batch một lần
+	if renewed := atomic.LoadInt32(&queue.renewed); renewed != 2 {
+		t.Errorf("renewed = %d, want 2", renewed)
+	}
+	if url, _ := urlRepo.FindByShortCode(ctx, "abc123"); url.ClickCount != 1 {
+		t.Errorf("ClickCount = %d, want 1 after the database recovers", url.ClickCount)
+	}
+}
+
+// hungAnalyticsRepository giả lập database treo: lệnh ghi chỉ kết thúc khi ctx bị hủy
+type hungAnalyticsRepository struct {
+	*repository.MemoryAnalyticsRepository
+}
+
+func (r *hungAnalyticsRepository) SaveClickBatch(ctx context.Context, events []*models.ClickEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestClickAnalyticsWorker_ShutdownAbortsHungWrites(t *testing.T) {
+	urlRepo := repository.NewMemoryURLRepository()
+	analyticsRepo := &hungAnalyticsRepository{MemoryAnalyticsRepository: repository.NewMemoryAnalyticsRepository(urlRepo)}
+
+	worker := NewClickAnalyticsWorker(analyticsRepo, repository.NewMemoryClickQueue(10), nil, nil, 1)
+	worker.flushInterval = 10 * time.Millisecond
+	worker.Enqueue(&models.ClickEvent{ShortCode: "abc123", CreatedAt: time.Now()})
+	worker.Start()
+	time.Sleep(50 * time.Millisecond)
+
+	// Shutdown trả về ngay khi hết thời gian drain thay vì chờ database
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	worker.Shutdown(shutdownCtx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v with a hung database, want it bounded by the drain timeout", elapsed)
+	}
+}
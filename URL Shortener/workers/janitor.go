@@ -0,0 +1,264 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/interfaces"
+	"url-shortener/models"
+
+	"gorm.io/gorm"
+)
+
+// JanitorReport là kết quả của một lần quét
+type JanitorReport struct {
+	StartedAt    time.Time `json:"started_at"`
+	Duration     string    `json:"duration"`
+	Expired      int       `json:"expired"`       // Số link hết hạn đã chuyển vào thùng rác
+	Purged       int       `json:"purged"`        // Số link trong thùng rác đã xóa vĩnh viễn
+	CacheEvicted int       `json:"cache_evicted"` // Số cache key đã xóa
+	Archived     bool      `json:"archived"`      // Click events có được chép sang archive trước khi purge
+	Errors       []string  `json:"errors,omitempty"`
+}
+
+// ExpiredLinkJanitor định kỳ dọn dẹp link hết hạn chạy nền
+// Lượt 1: link hết hạn quá grace period bị soft delete và xóa khỏi cache
+// Lượt 2: link đã nằm trong thùng rác quá thời gian giữ code bị purge vĩnh viễn
+type ExpiredLinkJanitor struct {
+	urlRepo          interfaces.URLRepository
+	cacheRepo        interfaces.CacheRepository
+	interval         time.Duration
+	gracePeriod      time.Duration
+	purgeAfter       time.Duration
+	batchSize        int
+	archiveAnalytics bool
+
+	wg        sync.WaitGroup
+	quit      chan struct{}
+	isRunning bool
+	mu        sync.Mutex
+
+	// ctx bị hủy khi Stop để lần quét đang chạy dừng sớm
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	runMu      sync.Mutex // Chỉ cho phép một lần quét tại một thời điểm
+	lastReport *JanitorReport
+	totalRuns  int64
+}
+
+// NewExpiredLinkJanitor tạo janitor mới
+func NewExpiredLinkJanitor(
+	urlRepo interfaces.URLRepository,
+	cacheRepo interfaces.CacheRepository,
+	cfg *config.Config,
+) *ExpiredLinkJanitor {
+	batchSize := cfg.Janitor.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	// time.NewTicker panic với interval không dương
+	interval := cfg.Janitor.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &ExpiredLinkJanitor{
+		ctx:              ctx,
+		cancel:           cancel,
+		urlRepo:          urlRepo,
+		cacheRepo:        cacheRepo,
+		interval:         interval,
+		gracePeriod:      cfg.Janitor.GracePeriod,
+		purgeAfter:       cfg.App.DeletedCodeRetention,
+		batchSize:        batchSize,
+		archiveAnalytics: cfg.Janitor.ArchiveAnalytics,
+		quit:             make(chan struct{}),
+	}
+}
+
+// Start khởi động goroutine quét định kỳ
+func (j *ExpiredLinkJanitor) Start() {
+	j.mu.Lock()
+	if j.isRunning {
+		j.mu.Unlock()
+		return
+	}
+	j.isRunning = true
+	j.mu.Unlock()
+
+	log.Printf("🧹 Starting link janitor (interval: %v, grace period: %v)", j.interval, j.gracePeriod)
+
+	j.wg.Add(1)
+	go j.loop()
+}
+
+// Stop dừng janitor, hủy lần quét đang chạy (nếu có) và chờ goroutine kết thúc
+func (j *ExpiredLinkJanitor) Stop() {
+	j.mu.Lock()
+	if !j.isRunning {
+		j.mu.Unlock()
+		return
+	}
+	j.mu.Unlock()
+
+	log.Println("🛑 Stopping link janitor...")
+
+	close(j.quit)
+	j.cancel()
+	j.wg.Wait()
+
+	j.mu.Lock()
+	j.isRunning = false
+	j.mu.Unlock()
+
+	log.Println("✅ Link janitor stopped")
+}
+
+// loop chạy RunOnce theo interval cho tới khi nhận tín hiệu dừng
+func (j *ExpiredLinkJanitor) loop() {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.quit:
+			return
+		case <-ticker.C:
+			j.RunOnce(j.ctx)
+		}
+	}
+}
+
+// RunOnce quét một lần và trả về báo cáo
+// Nhiều replica cùng chạy vẫn an toàn: link đã được replica khác xử lý sẽ được bỏ qua
+func (j *ExpiredLinkJanitor) RunOnce(ctx context.Context) *JanitorReport {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
+	report := &JanitorReport{
+		StartedAt: time.Now(),
+		Archived:  j.archiveAnalytics,
+	}
+
+	j.sweepExpired(ctx, report)
+	j.purgeDeleted(ctx, report)
+
+	report.Duration = time.Since(report.StartedAt).String()
+
+	j.mu.Lock()
+	j.lastReport = report
+	j.totalRuns++
+	j.mu.Unlock()
+
+	if report.Expired > 0 || report.Purged > 0 || len(report.Errors) > 0 {
+		log.Printf("🧹 Janitor: %d expired, %d purged, %d cache keys evicted, %d errors in %s",
+			report.Expired, report.Purged, report.CacheEvicted, len(report.Errors), report.Duration)
+	}
+
+	return report
+}
+
+// sweepExpired chuyển link hết hạn quá grace period vào thùng rác theo từng batch
+func (j *ExpiredLinkJanitor) sweepExpired(ctx context.Context, report *JanitorReport) {
+	cutoff := report.StartedAt.Add(-j.gracePeriod)
+
+	for {
+		urls, err := j.urlRepo.FindExpired(ctx, cutoff, j.batchSize)
+		if err != nil {
+			report.Errors = append(report.Errors, "find expired: "+err.Error())
+			return
+		}
+		if len(urls) == 0 {
+			return
+		}
+
+		ids := make([]uint, 0, len(urls))
+		for _, url := range urls {
+			ids = append(ids, url.ID)
+		}
+		// Link được gia hạn sau FindExpired không bị xóa và giữ nguyên cache
+		deleted, err := j.urlRepo.DeleteExpired(ctx, ids, cutoff)
+		if err != nil {
+			report.Errors = append(report.Errors, "delete expired: "+err.Error())
+			return
+		}
+		report.Expired += len(deleted)
+
+		// Tombstone thay vì xóa key để redirect đang nạp bản cũ từ database không ghi lại vào cache
+		for _, url := range deleted {
+			tombstone := models.NewNotFoundCachedURL(models.DeletedTombstoneTTL)
+			if err := j.cacheRepo.Set(ctx, url.ShortCode, tombstone); err != nil {
+				report.Errors = append(report.Errors, "evict "+url.ShortCode+": "+err.Error())
+				continue
+			}
+			report.CacheEvicted++
+		}
+
+		if len(urls) < j.batchSize {
+			return
+		}
+	}
+}
+
+// purgeDeleted xóa vĩnh viễn link đã nằm trong thùng rác quá thời gian giữ code
+func (j *ExpiredLinkJanitor) purgeDeleted(ctx context.Context, report *JanitorReport) {
+	cutoff := report.StartedAt.Add(-j.purgeAfter)
+
+	for {
+		urls, err := j.urlRepo.FindPurgeable(ctx, cutoff, j.batchSize)
+		if err != nil {
+			report.Errors = append(report.Errors, "find purgeable: "+err.Error())
+			return
+		}
+		if len(urls) == 0 {
+			return
+		}
+
+		failed := 0
+		for _, url := range urls {
+			err := j.urlRepo.Purge(ctx, url.ShortCode, j.archiveAnalytics)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Đã được khôi phục hoặc purge bởi request/replica khác
+				continue
+			}
+			if err != nil {
+				report.Errors = append(report.Errors, "purge "+url.ShortCode+": "+err.Error())
+				failed++
+				continue
+			}
+			report.Purged++
+		}
+
+		// Dừng nếu cả batch đều lỗi để tránh lặp vô hạn trên cùng các bản ghi
+		if len(urls) < j.batchSize || failed == len(urls) {
+			return
+		}
+	}
+}
+
+// GetStats trả về thống kê của janitor
+func (j *ExpiredLinkJanitor) GetStats() map[string]interface{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return map[string]interface{}{
+		"is_running":        j.isRunning,
+		"interval":          j.interval.String(),
+		"grace_period":      j.gracePeriod.String(),
+		"purge_after":       j.purgeAfter.String(),
+		"batch_size":        j.batchSize,
+		"archive_analytics": j.archiveAnalytics,
+		"total_runs":        j.totalRuns,
+		"last_run":          j.lastReport,
+	}
+}
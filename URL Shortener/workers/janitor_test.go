@@ -0,0 +1,98 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"url-shortener/config"
+	"url-shortener/models"
+	"url-shortener/repository"
+)
+
+func TestExpiredLinkJanitor_RunOnce(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := repository.NewMemoryURLRepository()
+	cacheRepo := repository.NewMemoryCacheRepository()
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	recently := time.Now().Add(-time.Hour)
+	urlRepo.Create(ctx, &models.URL{ShortCode: "old123", OriginalURL: "https://example.com/old", ExpiresAt: &longAgo})
+	urlRepo.Create(ctx, &models.URL{ShortCode: "new123", OriginalURL: "https://example.com/new", ExpiresAt: &recently})
+	cacheRepo.Set(ctx, "old123", &models.CachedURL{OriginalURL: "https://example.com/old"})
+
+	cfg := &config.Config{
+		Janitor: config.JanitorConfig{Interval: time.Hour, GracePeriod: 24 * time.Hour, BatchSize: 1},
+		App:     config.AppConfig{DeletedCodeRetention: 24 * time.Hour},
+	}
+	janitor := NewExpiredLinkJanitor(urlRepo, cacheRepo, cfg)
+
+	report := janitor.RunOnce(ctx)
+	if report.Expired != 1 || report.CacheEvicted != 1 || report.Purged != 0 || len(report.Errors) != 0 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if _, err := urlRepo.FindByShortCode(ctx, "old123"); err == nil {
+		t.Errorf("Expected link past grace period to be moved to trash")
+	}
+	if _, err := urlRepo.FindByShortCode(ctx, "new123"); err != nil {
+		t.Errorf("Expected link within grace period to stay: %v", err)
+	}
+	if cached, _ := cacheRepo.Get(ctx, "old123"); cached == nil || !cached.NotFound {
+		t.Errorf("cached entry = %+v, want a not-found tombstone", cached)
+	}
+
+	// Hết thời gian giữ code thì link trong thùng rác bị purge
+	janitor.purgeAfter = 0
+	report = janitor.RunOnce(ctx)
+	if report.Purged != 1 {
+		t.Fatalf("Expected 1 purged link, got %+v", report)
+	}
+	if exists, _ := urlRepo.ExistsShortCode(ctx, "old123"); exists {
+		t.Errorf("Expected short code to be free after purge")
+	}
+}
+
+// extendingURLRepository giả lập PATCH gia hạn link xen giữa FindExpired và DeleteExpired
+type extendingURLRepository struct {
+	*repository.MemoryURLRepository
+	shortCode string
+}
+
+func (r *extendingURLRepository) FindExpired(ctx context.Context, before time.Time, limit int) ([]models.URL, error) {
+	urls, err := r.MemoryURLRepository.FindExpired(ctx, before, limit)
+	r.Update(ctx, r.shortCode, func(url *models.URL) (*models.URLRevision, error) {
+		extended := time.Now().Add(time.Hour)
+		url.ExpiresAt = &extended
+		return &models.URLRevision{}, nil
+	}, func(url *models.URL) error { return nil })
+	return urls, err
+}
+
+// TestExpiredLinkJanitor_SkipsExtendedLinks tests a link extended during the sweep keeps its data and cache
+func TestExpiredLinkJanitor_SkipsExtendedLinks(t *testing.T) {
+	ctx := context.Background()
+	urlRepo := &extendingURLRepository{MemoryURLRepository: repository.NewMemoryURLRepository(), shortCode: "abc123"}
+	cacheRepo := repository.NewMemoryCacheRepository()
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	urlRepo.Create(ctx, &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com", ExpiresAt: &longAgo})
+	cacheRepo.Set(ctx, "abc123", &models.CachedURL{OriginalURL: "https://example.com"})
+
+	// Interval không dương dùng giá trị mặc định thay vì làm ticker panic
+	cfg := &config.Config{Janitor: config.JanitorConfig{GracePeriod: time.Hour, BatchSize: 10}}
+	janitor := NewExpiredLinkJanitor(urlRepo, cacheRepo, cfg)
+	if janitor.interval <= 0 {
+		t.Errorf("interval = %v, want the default", janitor.interval)
+	}
+
+	report := janitor.RunOnce(ctx)
+	if report.Expired != 0 || report.CacheEvicted != 0 || len(report.Errors) != 0 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if _, err := urlRepo.FindByShortCode(ctx, "abc123"); err != nil {
+		t.Errorf("Extended link was deleted: %v", err)
+	}
+	if cached, _ := cacheRepo.Get(ctx, "abc123"); cached == nil || cached.NotFound {
+		t.Errorf("cached entry = %+v, want the link kept in cache", cached)
+	}
+}